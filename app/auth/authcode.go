@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultRedirectURL — адрес локального callback-сервера по умолчанию.
+// Он должен быть указан в OAuth Redirect URLs приложения в консоли Twitch.
+const DefaultRedirectURL = "http://localhost:3000/callback"
+
+const callbackShutdownTimeout = 5 * time.Second
+
+// ErrStateMismatch возвращается, если state из callback не совпал с отправленным.
+var ErrStateMismatch = errors.New("twitch oauth: state mismatch")
+
+// AuthorizeURL возвращает ссылку, по которой пользователь разрешает доступ приложению.
+func (c *Client) AuthorizeURL(redirectURL string, scopes []string, state string) string {
+	query := url.Values{}
+	query.Set("client_id", c.clientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("response_type", "code")
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	return c.endpoint("/authorize") + "?" + query.Encode()
+}
+
+// ExchangeCode обменивает code из callback на user access token.
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectURL string) (UserToken, error) {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+
+	payload, err := c.requestToken(ctx, form)
+	if err != nil {
+		return UserToken{}, err
+	}
+
+	return payload.userToken(), nil
+}
+
+// LoginUser проводит пользователя через authorization code flow: поднимает
+// временный HTTP сервер на адресе redirectURL, передаёт ссылку на авторизацию
+// в openURL, ждёт callback, проверяет state и обменивает code на токен.
+// Порт 0 в redirectURL означает любой свободный порт.
+func (c *Client) LoginUser(ctx context.Context, redirectURL string, scopes []string, openURL func(string)) (UserToken, error) {
+	redirect := redirectURL
+	if strings.TrimSpace(redirect) == "" {
+		redirect = DefaultRedirectURL
+	}
+
+	callback, err := url.Parse(redirect)
+	if err != nil || callback.Scheme != "http" || callback.Host == "" {
+		return UserToken{}, fmt.Errorf("twitch oauth: invalid redirect url %q", redirect)
+	}
+
+	listener, err := net.Listen("tcp", callback.Host)
+	if err != nil {
+		return UserToken{}, fmt.Errorf("twitch oauth: listen callback: %w", err)
+	}
+	if callback.Port() == "0" {
+		callback.Host = listener.Addr().String()
+	}
+	if callback.Path == "" {
+		callback.Path = "/"
+	}
+	redirect = callback.String()
+
+	state, err := randomState()
+	if err != nil {
+		listener.Close()
+		return UserToken{}, err
+	}
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callback.Path, func(w http.ResponseWriter, r *http.Request) {
+		result := readCallback(r.URL.Query(), state)
+		if result.err != nil {
+			http.Error(w, "Авторизация не удалась: "+result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Авторизация завершена, окно можно закрыть.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = server.Serve(listener) }()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), callbackShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	openURL(c.AuthorizeURL(redirect, scopes, state))
+
+	var result callbackResult
+	select {
+	case <-ctx.Done():
+		return UserToken{}, ctx.Err()
+	case result = <-results:
+	}
+	if result.err != nil {
+		return UserToken{}, result.err
+	}
+
+	return c.ExchangeCode(ctx, result.code, redirect)
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// readCallback разбирает параметры callback: code и state или ошибку от Twitch.
+func readCallback(query url.Values, state string) callbackResult {
+	if reason := query.Get("error"); reason != "" {
+		return callbackResult{err: fmt.Errorf("twitch oauth: authorization denied: %s: %s", reason, query.Get("error_description"))}
+	}
+	if query.Get("state") != state {
+		return callbackResult{err: ErrStateMismatch}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("twitch oauth: callback without code")}
+	}
+	return callbackResult{code: code}
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("twitch oauth: generate state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeOAuthServer отвечает на /token как Twitch и запоминает последнюю форму.
+func newFakeOAuthServer(t *testing.T, forms chan<- url.Values) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/token" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		forms <- r.PostForm
+		if r.PostForm.Get("code") != "good-code" {
+			http.Error(w, `{"status":400,"message":"Invalid authorization code"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "user-access",
+			"refresh_token": "user-refresh",
+			"expires_in":    14400,
+			"scope":         []string{"chat:read", "chat:edit"},
+			"token_type":    "bearer",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// browser имитирует пользователя: открывает ссылку авторизации и вызывает
+// redirect_uri с переданными параметрами, подменяя state при необходимости.
+func browser(t *testing.T, params url.Values, opened chan<- *url.URL) func(string) {
+	return func(link string) {
+		authorize, err := url.Parse(link)
+		if err != nil {
+			t.Errorf("parse authorize url: %v", err)
+			return
+		}
+		opened <- authorize
+
+		query := authorize.Query()
+		callback := url.Values{}
+		for key, values := range params {
+			callback[key] = values
+		}
+		if callback.Get("state") == "" {
+			callback.Set("state", query.Get("state"))
+		}
+
+		go func() {
+			resp, err := http.Get(query.Get("redirect_uri") + "?" + callback.Encode())
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+}
+
+const testRedirectURL = "http://127.0.0.1:0/callback"
+
+var testScopes = []string{"chat:read", "chat:edit"}
+
+func newTestClient(serverURL string) *Client {
+	return NewClient(Config{ClientID: "client", ClientSecret: "secret", BaseURL: serverURL + "/oauth2"})
+}
+
+func TestLoginUserExchangesCode(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	server := newFakeOAuthServer(t, forms)
+	opened := make(chan *url.URL, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := newTestClient(server.URL).LoginUser(ctx, testRedirectURL, testScopes, browser(t, url.Values{"code": {"good-code"}}, opened))
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	if token.AccessToken != "user-access" || token.RefreshToken != "user-refresh" || token.ExpiresIn != 4*time.Hour {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	authorize := <-opened
+	if authorize.Path != "/oauth2/authorize" {
+		t.Fatalf("unexpected authorize path: %s", authorize.Path)
+	}
+	query := authorize.Query()
+	if query.Get("client_id") != "client" || query.Get("response_type") != "code" || query.Get("scope") != "chat:read chat:edit" {
+		t.Fatalf("unexpected authorize query: %v", query)
+	}
+	if strings.HasSuffix(query.Get("redirect_uri"), ":0/callback") {
+		t.Fatalf("redirect_uri must contain the real port: %s", query.Get("redirect_uri"))
+	}
+
+	form := <-forms
+	if form.Get("grant_type") != "authorization_code" || form.Get("client_secret") != "secret" {
+		t.Fatalf("unexpected token form: %v", form)
+	}
+	if form.Get("redirect_uri") != query.Get("redirect_uri") {
+		t.Fatalf("redirect_uri mismatch: %q vs %q", form.Get("redirect_uri"), query.Get("redirect_uri"))
+	}
+}
+
+func TestLoginUserRejectsStateMismatch(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	server := newFakeOAuthServer(t, forms)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	params := url.Values{"code": {"good-code"}, "state": {"forged"}}
+	_, err := newTestClient(server.URL).LoginUser(ctx, testRedirectURL, testScopes, browser(t, params, make(chan *url.URL, 1)))
+	if !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("expected ErrStateMismatch, got %v", err)
+	}
+	if len(forms) != 0 {
+		t.Fatal("code must not be exchanged when state does not match")
+	}
+}
+
+func TestLoginUserReportsDeniedAccess(t *testing.T) {
+	server := newFakeOAuthServer(t, make(chan url.Values, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	params := url.Values{"error": {"access_denied"}, "error_description": {"The user denied you access"}}
+	_, err := newTestClient(server.URL).LoginUser(ctx, testRedirectURL, testScopes, browser(t, params, make(chan *url.URL, 1)))
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("expected access_denied error, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultOAuthURL — базовый адрес OAuth сервера Twitch.
+	DefaultOAuthURL     = "https://id.twitch.tv/oauth2"
+	oauthRequestTimeout = 10 * time.Second
+
+	defaultMaxRetries = 3
+	retryBaseDelay    = 500 * time.Millisecond
+	retryMaxDelay     = 30 * time.Second
+)
+
+// Ошибки Twitch, которые вызывающему коду нужно различать. Сравниваются через
+// errors.Is с *Error.
+var (
+	ErrInvalidClient       = errors.New("twitch oauth: invalid client")
+	ErrInvalidRefreshToken = errors.New("twitch oauth: invalid refresh token")
+	ErrInvalidToken        = errors.New("twitch oauth: token is invalid or revoked")
+	ErrRateLimited         = errors.New("twitch oauth: rate limited")
+)
+
+// Error — ответ OAuth сервера с кодом не 2xx. Message берётся из JSON тела
+// Twitch вида {"status":400,"message":"invalid client"}.
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("twitch oauth: unexpected status %s: %s", e.Status, e.Body)
+}
+
+// Is сопоставляет ответ Twitch с ErrInvalidClient, ErrInvalidRefreshToken,
+// ErrInvalidToken и ErrRateLimited.
+func (e *Error) Is(target error) bool {
+	message := strings.ToLower(e.Message)
+	switch target {
+	case ErrInvalidClient:
+		return strings.HasPrefix(message, "invalid client")
+	case ErrInvalidRefreshToken:
+		return message == "invalid refresh token"
+	case ErrInvalidToken:
+		return e.StatusCode == http.StatusUnauthorized || message == "invalid access token"
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Config — параметры клиента OAuth. Пустые поля заменяются значениями по умолчанию.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// BaseURL — адрес OAuth сервера, например мок-сервер Twitch CLI.
+	BaseURL string
+	// HTTPClient позволяет подставить прокси, транспорт или тестовый сервер.
+	HTTPClient *http.Client
+	// MaxRetries — сколько раз повторять запрос на 5xx и 429; 0 — по умолчанию (3).
+	MaxRetries int
+}
+
+// Client обращается к OAuth серверу Twitch от имени одного приложения.
+type Client struct {
+	clientID     string
+	clientSecret string
+	baseURL      string
+	httpClient   *http.Client
+	maxRetries   int
+	slowDown     time.Duration // прибавка к интервалу опроса Device Code Grant на slow_down
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewClient создаёт клиент OAuth.
+func NewClient(cfg Config) *Client {
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = DefaultOAuthURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: oauthRequestTimeout}
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	return &Client{
+		clientID:     strings.TrimSpace(cfg.ClientID),
+		clientSecret: strings.TrimSpace(cfg.ClientSecret),
+		baseURL:      baseURL,
+		httpClient:   httpClient,
+		maxRetries:   maxRetries,
+		slowDown:     defaultDeviceSlowDown,
+		sleep:        sleep,
+	}
+}
+
+func (c *Client) endpoint(path string) string {
+	return c.baseURL + path
+}
+
+// postForm отправляет форму на OAuth endpoint и декодирует JSON ответа в out.
+func (c *Client) postForm(ctx context.Context, path string, form url.Values, out any) error {
+	body := form.Encode()
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(path), strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}, out)
+}
+
+// do выполняет запрос, повторяя его на 5xx и 429, и декодирует JSON ответа
+// в out; out == nil означает, что тело ответа не нужно. newRequest вызывается
+// на каждую попытку, чтобы тело запроса читалось заново.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error), out any) error {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return fmt.Errorf("twitch oauth: create request: %w", err)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("twitch oauth: request failed: %w", err)
+		}
+
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			err := decodeResponse(resp, out)
+			resp.Body.Close()
+			return err
+		}
+
+		apiErr := readError(resp)
+		resp.Body.Close()
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= c.maxRetries {
+			return apiErr
+		}
+		if err := c.sleep(ctx, retryDelay(resp, attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("twitch oauth: decode response: %w", err)
+	}
+	return nil
+}
+
+func readError(resp *http.Response) *Error {
+	body, _ := io.ReadAll(resp.Body)
+	var payload struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    payload.Message,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// retryDelay возвращает паузу перед повтором: для 429 — до момента из
+// заголовка Ratelimit-Reset, иначе экспоненциальную задержку.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if reset, err := strconv.ParseInt(resp.Header.Get("Ratelimit-Reset"), 10, 64); err == nil {
+		delay := time.Until(time.Unix(reset, 0))
+		if delay < 0 {
+			delay = 0
+		}
+		return min(delay, retryMaxDelay)
+	}
+
+	return min(retryBaseDelay<<attempt, retryMaxDelay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordSleeps подменяет ожидание между повторами и запоминает паузы.
+func recordSleeps(client *Client) *[]time.Duration {
+	var sleeps []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return &sleeps
+}
+
+func writeAppToken(w http.ResponseWriter) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "app-token",
+		"expires_in":   5000000,
+		"token_type":   "bearer",
+	})
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, `{"status":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("client_secret") != "secret" {
+			t.Errorf("request body was not resent on retry: %v", r.PostForm)
+		}
+		writeAppToken(w)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{ClientID: "client", ClientSecret: "secret", BaseURL: server.URL})
+	sleeps := recordSleeps(client)
+
+	token, expiresIn, err := client.AppToken(context.Background())
+	if err != nil {
+		t.Fatalf("AppToken: %v", err)
+	}
+	if token != "app-token" || expiresIn != 5000000*time.Second {
+		t.Fatalf("unexpected token %q, %s", token, expiresIn)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls.Load())
+	}
+	if len(*sleeps) != 2 || (*sleeps)[0] != retryBaseDelay || (*sleeps)[1] != 2*retryBaseDelay {
+		t.Fatalf("unexpected backoff: %v", *sleeps)
+	}
+}
+
+func TestClientHonorsRatelimitReset(t *testing.T) {
+	reset := time.Now().Add(20 * time.Second)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			http.Error(w, `{"status":429,"message":"Too Many Requests"}`, http.StatusTooManyRequests)
+			return
+		}
+		writeAppToken(w)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{ClientID: "client", ClientSecret: "secret", BaseURL: server.URL})
+	sleeps := recordSleeps(client)
+
+	if _, _, err := client.AppToken(context.Background()); err != nil {
+		t.Fatalf("AppToken: %v", err)
+	}
+	if len(*sleeps) != 1 || (*sleeps)[0] < 18*time.Second || (*sleeps)[0] > 20*time.Second {
+		t.Fatalf("expected wait until Ratelimit-Reset, got %v", *sleeps)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, `{"status":429,"message":"Too Many Requests"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{BaseURL: server.URL, MaxRetries: 2})
+	recordSleeps(client)
+
+	_, _, err := client.AppToken(context.Background())
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 1 call and 2 retries, got %d calls", calls.Load())
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"invalid client", http.StatusBadRequest, `{"status":400,"message":"invalid client"}`, ErrInvalidClient},
+		{"invalid client secret", http.StatusForbidden, `{"status":403,"message":"invalid client secret"}`, ErrInvalidClient},
+		{"invalid refresh token", http.StatusBadRequest, `{"error":"Bad Request","status":400,"message":"Invalid refresh token"}`, ErrInvalidRefreshToken},
+		{"invalid access token", http.StatusUnauthorized, `{"status":401,"message":"invalid access token"}`, ErrInvalidToken},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(Config{ClientID: "client", BaseURL: server.URL})
+			_, err := client.RefreshUserToken(context.Background(), "refresh")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.status {
+				t.Fatalf("expected *Error with status %d, got %#v", tc.status, err)
+			}
+			if calls.Load() != 1 {
+				t.Fatalf("client errors must not be retried, got %d calls", calls.Load())
+			}
+		})
+	}
+}
+
+func TestClientUsesInjectedHTTPClientAndContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "injected" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+			return
+		}
+		writeAppToken(w)
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: headerTransport{}}
+	client := NewClient(Config{BaseURL: server.URL, HTTPClient: httpClient})
+
+	if _, _, err := client.AppToken(context.Background()); err != nil {
+		t.Fatalf("AppToken: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := client.AppToken(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+type headerTransport struct{}
+
+func (headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Test", "injected")
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	deviceGrantType       = "urn:ietf:params:oauth:grant-type:device_code"
+	defaultDeviceInterval = 5 * time.Second
+	// defaultDeviceSlowDown — на сколько увеличивать интервал опроса после ответа slow_down.
+	defaultDeviceSlowDown = 5 * time.Second
+)
+
+// ErrDeviceCodeExpired возвращается, если пользователь не подтвердил вход до истечения кода.
+var ErrDeviceCodeExpired = errors.New("twitch oauth: device code expired")
+
+// DeviceCode — ответ /oauth2/device: код для пользователя и параметры опроса.
+type DeviceCode struct {
+	DeviceCode      string
+	UserCode        string
+	VerificationURI string
+	ExpiresIn       time.Duration
+	Interval        time.Duration
+}
+
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// RequestDeviceCode начинает Device Code Grant: Twitch возвращает user code,
+// который пользователь вводит на VerificationURI с любого устройства.
+func (c *Client) RequestDeviceCode(ctx context.Context, scopes []string) (DeviceCode, error) {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	form.Set("scopes", strings.Join(scopes, " "))
+
+	var payload deviceCodeResponse
+	if err := c.postForm(ctx, "/device", form, &payload); err != nil {
+		return DeviceCode{}, err
+	}
+
+	interval := time.Duration(payload.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+
+	return DeviceCode{
+		DeviceCode:      payload.DeviceCode,
+		UserCode:        payload.UserCode,
+		VerificationURI: payload.VerificationURI,
+		ExpiresIn:       time.Duration(payload.ExpiresIn) * time.Second,
+		Interval:        interval,
+	}, nil
+}
+
+// PollDeviceToken опрашивает token endpoint с интервалом из code, пока
+// пользователь не подтвердит вход. На slow_down интервал увеличивается.
+// Client Secret можно не задавать для публичных приложений.
+func (c *Client) PollDeviceToken(ctx context.Context, scopes []string, code DeviceCode) (UserToken, error) {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	if c.clientSecret != "" {
+		form.Set("client_secret", c.clientSecret)
+	}
+	form.Set("scopes", strings.Join(scopes, " "))
+	form.Set("device_code", code.DeviceCode)
+	form.Set("grant_type", deviceGrantType)
+
+	interval := code.Interval
+	deadline := time.Now().Add(code.ExpiresIn)
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return UserToken{}, ctx.Err()
+		case <-timer.C:
+		}
+
+		payload, err := c.requestToken(ctx, form)
+		if err == nil {
+			return payload.userToken(), nil
+		}
+
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			return UserToken{}, err
+		}
+		switch apiErr.Message {
+		case "authorization_pending":
+		case "slow_down":
+			interval += c.slowDown
+		case "invalid device code":
+			return UserToken{}, ErrDeviceCodeExpired
+		default:
+			return UserToken{}, err
+		}
+
+		if code.ExpiresIn > 0 && time.Now().Add(interval).After(deadline) {
+			return UserToken{}, ErrDeviceCodeExpired
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDeviceServer выдаёт device code и отвечает на опрос по заданному сценарию.
+type fakeDeviceServer struct {
+	mu        sync.Mutex
+	responses []string
+	polls     []url.Values
+}
+
+func (f *fakeDeviceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/oauth2/device":
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "device-123",
+			"user_code":        "ABCDEFGH",
+			"verification_uri": "https://www.twitch.tv/activate?device-code=ABCDEFGH",
+			"expires_in":       1800,
+			"interval":         5,
+		})
+	case "/oauth2/token":
+		f.mu.Lock()
+		f.polls = append(f.polls, r.PostForm)
+		next := "ok"
+		if len(f.responses) > 0 {
+			next, f.responses = f.responses[0], f.responses[1:]
+		}
+		f.mu.Unlock()
+
+		if next != "ok" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]any{"status": 400, "message": next})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "device-access",
+			"refresh_token": "device-refresh",
+			"expires_in":    14400,
+			"scope":         []string{"chat:read"},
+			"token_type":    "bearer",
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDeviceCodeGrantPollsUntilAuthorized(t *testing.T) {
+	fake := &fakeDeviceServer{responses: []string{"authorization_pending", "slow_down", "authorization_pending"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewClient(Config{ClientID: "client", BaseURL: server.URL + "/oauth2"})
+	client.slowDown = 20 * time.Millisecond
+	code, err := client.RequestDeviceCode(context.Background(), []string{"chat:read"})
+	if err != nil {
+		t.Fatalf("RequestDeviceCode: %v", err)
+	}
+	if code.UserCode != "ABCDEFGH" || code.Interval != 5*time.Second || code.ExpiresIn != 30*time.Minute {
+		t.Fatalf("unexpected device code: %+v", code)
+	}
+
+	code.Interval = 10 * time.Millisecond
+	started := time.Now()
+	token, err := client.PollDeviceToken(context.Background(), []string{"chat:read"}, code)
+	if err != nil {
+		t.Fatalf("PollDeviceToken: %v", err)
+	}
+	if token.AccessToken != "device-access" || token.RefreshToken != "device-refresh" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	// Четыре опроса: два по 10ms, после slow_down — два по 30ms.
+	if elapsed := time.Since(started); elapsed < 80*time.Millisecond {
+		t.Fatalf("slow_down was not honored, polling took %s", elapsed)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.polls) != 4 {
+		t.Fatalf("expected 4 polls, got %d", len(fake.polls))
+	}
+	form := fake.polls[0]
+	if form.Get("grant_type") != deviceGrantType || form.Get("device_code") != "device-123" || form.Has("client_secret") {
+		t.Fatalf("unexpected poll form: %v", form)
+	}
+}
+
+func TestDeviceCodeGrantStopsOnExpiredCode(t *testing.T) {
+	fake := &fakeDeviceServer{responses: []string{"invalid device code"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	code := DeviceCode{DeviceCode: "device-123", Interval: time.Millisecond, ExpiresIn: time.Minute}
+	client := NewClient(Config{ClientID: "client", BaseURL: server.URL + "/oauth2"})
+	_, err := client.PollDeviceToken(context.Background(), nil, code)
+	if !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Fatalf("expected ErrDeviceCodeExpired, got %v", err)
+	}
+}
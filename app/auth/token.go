@@ -1,52 +1,75 @@
 package auth
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
 	"net/url"
 	"strings"
 	"time"
 )
 
-const (
-	twitchOAuthTokenURL = "https://id.twitch.tv/oauth2/token"
-	oauthRequestTimeout = 10 * time.Second
-)
+// UserToken — ответ Twitch на выдачу или обновление user access token.
+type UserToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	Scopes       []string
+}
+
+// tokenResponse — тело ответа /oauth2/token для всех grant-ов.
+type tokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int64    `json:"expires_in"`
+	Scope        []string `json:"scope"`
+	TokenType    string   `json:"token_type"`
+}
 
-// GetAppToken запрашивает OAuth токен приложения у Twitch.
-func GetAppToken(clientID, clientSecret string) (accessToken string, expiresIn time.Duration, err error) {
+// AppToken запрашивает OAuth токен приложения у Twitch (grant client_credentials).
+func (c *Client) AppToken(ctx context.Context) (accessToken string, expiresIn time.Duration, err error) {
 	form := url.Values{}
-	form.Set("client_id", strings.TrimSpace(clientID))
-	form.Set("client_secret", strings.TrimSpace(clientSecret))
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
 	form.Set("grant_type", "client_credentials")
 
-	req, err := http.NewRequest(http.MethodPost, twitchOAuthTokenURL, strings.NewReader(form.Encode()))
+	payload, err := c.requestToken(ctx, form)
 	if err != nil {
-		return "", 0, fmt.Errorf("twitch oauth: create request: %w", err)
+		return "", 0, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{Timeout: oauthRequestTimeout}
-	resp, err := client.Do(req)
+	return payload.AccessToken, time.Duration(payload.ExpiresIn) * time.Second, nil
+}
+
+// RefreshUserToken обновляет user access token через grant refresh_token.
+// Twitch может вернуть новый refresh token — его нужно сохранить вместо старого.
+func (c *Client) RefreshUserToken(ctx context.Context, refreshToken string) (UserToken, error) {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", strings.TrimSpace(refreshToken))
+
+	payload, err := c.requestToken(ctx, form)
 	if err != nil {
-		return "", 0, fmt.Errorf("twitch oauth: request failed: %w", err)
+		return UserToken{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		body, _ := io.ReadAll(resp.Body)
-		return "", 0, fmt.Errorf("twitch oauth: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
-	}
+	return payload.userToken(), nil
+}
 
-	var payload struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int64  `json:"expires_in"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return "", 0, fmt.Errorf("twitch oauth: decode response: %w", err)
+func (payload tokenResponse) userToken() UserToken {
+	return UserToken{
+		AccessToken:  payload.AccessToken,
+		RefreshToken: payload.RefreshToken,
+		ExpiresIn:    time.Duration(payload.ExpiresIn) * time.Second,
+		Scopes:       payload.Scope,
 	}
+}
 
-	return payload.AccessToken, time.Duration(payload.ExpiresIn) * time.Second, nil
+// requestToken отправляет форму на token endpoint и разбирает ответ.
+func (c *Client) requestToken(ctx context.Context, form url.Values) (tokenResponse, error) {
+	var payload tokenResponse
+	if err := c.postForm(ctx, "/token", form, &payload); err != nil {
+		return tokenResponse{}, err
+	}
+	return payload, nil
 }
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TokenInfo — ответ /oauth2/validate. Для токена приложения Login и UserID пустые.
+type TokenInfo struct {
+	ClientID  string
+	Login     string
+	UserID    string
+	Scopes    []string
+	ExpiresIn time.Duration
+}
+
+type validateResponse struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	UserID    string   `json:"user_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+// ValidateToken проверяет токен на сервере Twitch. Twitch требует проверять
+// user token при запуске и затем раз в час. Истёкший или отозванный токен
+// даёт ошибку, совпадающую с ErrInvalidToken.
+func (c *Client) ValidateToken(ctx context.Context, accessToken string) (TokenInfo, error) {
+	authorization := "OAuth " + strings.TrimPrefix(strings.TrimSpace(accessToken), "oauth:")
+
+	var payload validateResponse
+	err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/validate"), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", authorization)
+		return req, nil
+	}, &payload)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	return TokenInfo{
+		ClientID:  payload.ClientID,
+		Login:     payload.Login,
+		UserID:    payload.UserID,
+		Scopes:    payload.Scopes,
+		ExpiresIn: time.Duration(payload.ExpiresIn) * time.Second,
+	}, nil
+}
+
+// RevokeToken отзывает access token. Токен должен быть выдан приложению клиента.
+func (c *Client) RevokeToken(ctx context.Context, accessToken string) error {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	form.Set("token", strings.TrimPrefix(strings.TrimSpace(accessToken), "oauth:"))
+
+	return c.postForm(ctx, "/revoke", form, nil)
+}
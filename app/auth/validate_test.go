@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/validate" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "OAuth good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":401,"message":"invalid access token"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"client_id":  "client",
+			"login":      "mybot",
+			"user_id":    "42",
+			"scopes":     []string{"chat:read"},
+			"expires_in": 3600,
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{ClientID: "client", BaseURL: server.URL + "/oauth2"})
+
+	info, err := client.ValidateToken(context.Background(), "oauth:good")
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if info.Login != "mybot" || info.UserID != "42" || info.ExpiresIn != time.Hour || len(info.Scopes) != 1 {
+		t.Fatalf("unexpected token info: %+v", info)
+	}
+
+	if _, err := client.ValidateToken(context.Background(), "revoked"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/revoke" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		_ = r.ParseForm()
+		form = map[string]string{"client_id": r.PostForm.Get("client_id"), "token": r.PostForm.Get("token")}
+		if form["token"] != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":400,"message":"Invalid token"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{ClientID: "client", BaseURL: server.URL + "/oauth2"})
+
+	if err := client.RevokeToken(context.Background(), "oauth:good"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if form["client_id"] != "client" || form["token"] != "good" {
+		t.Fatalf("unexpected revoke form: %v", form)
+	}
+
+	if err := client.RevokeToken(context.Background(), "unknown"); err == nil {
+		t.Fatal("expected error for unknown token")
+	}
+}
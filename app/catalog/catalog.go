@@ -0,0 +1,446 @@
+// Package catalog — справочник значков и эмоутов чата: загружает глобальные
+// наборы и наборы каналов из Helix и сторонних источников (7TV, BetterTTV,
+// FrankerFaceZ), хранит их в базе и отвечает на запросы по id, имени и версии
+// без обращения к Twitch.
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+const (
+	// GlobalScope — область глобальных значков и эмоутов; у наборов канала
+	// область — его room-id.
+	GlobalScope = "global"
+
+	// Виды наборов в Store.
+	KindBadges = "badges"
+	KindEmotes = "emotes"
+)
+
+// Source возвращает значки и эмоуты из Helix; его реализует helix.Client.
+type Source interface {
+	GetGlobalBadges(ctx context.Context) ([]helix.BadgeSet, error)
+	GetChannelBadges(ctx context.Context, broadcasterID string) ([]helix.BadgeSet, error)
+	GetGlobalEmotes(ctx context.Context) ([]helix.Emote, error)
+	GetChannelEmotes(ctx context.Context, broadcasterID string) ([]helix.Emote, error)
+}
+
+// Store хранит наборы значков и эмоутов вместе с хэшем содержимого, по
+// которому Catalog решает, нужно ли перезаписывать набор. Ключ хэша —
+// SetKey(kind, provider, scope).
+type Store interface {
+	LoadBadges(ctx context.Context) ([]model.Badge, error)
+	LoadEmotes(ctx context.Context) ([]model.Emote, error)
+	LoadHashes(ctx context.Context) (map[string]string, error)
+	ReplaceBadges(ctx context.Context, scope, hash string, badges []model.Badge) error
+	ReplaceEmotes(ctx context.Context, provider, scope, hash string, emotes []model.Emote) error
+}
+
+// SetKey — ключ набора в Store: вид, источник и область.
+func SetKey(kind, provider, scope string) string {
+	return kind + ":" + provider + ":" + scope
+}
+
+// RoomsFunc возвращает room-id каналов, наборы которых нужно загружать.
+type RoomsFunc func(ctx context.Context) ([]string, error)
+
+// Catalog держит значки и эмоуты в памяти и периодически обновляет их.
+// Методы поиска безопасны для конкурентного вызова.
+type Catalog struct {
+	source    Source
+	store     Store
+	rooms     RoomsFunc
+	interval  time.Duration
+	providers []Provider
+	order     []string // источники эмоутов в порядке приоритета при поиске по имени
+	logger    *slog.Logger
+
+	mu     sync.RWMutex
+	hashes map[string]string
+	badges map[string]map[string]model.Badge            // область -> "set/version"
+	emotes map[string]model.Emote                       // "provider:id" -> эмоут
+	byName map[string]map[string]map[string]model.Emote // область -> источник -> имя
+}
+
+// New создаёт каталог, обновляющий наборы раз в interval. Эмоуты сторонних
+// источников providers загружаются вместе с эмоутами Twitch; при совпадении
+// имён побеждает Twitch, затем источники в переданном порядке.
+func New(source Source, store Store, rooms RoomsFunc, interval time.Duration, providers ...Provider) *Catalog {
+	order := []string{model.EmoteProviderTwitch}
+	for _, provider := range providers {
+		order = append(order, provider.Name())
+	}
+	return &Catalog{
+		source:    source,
+		store:     store,
+		rooms:     rooms,
+		interval:  interval,
+		providers: providers,
+		order:     order,
+		logger:    slog.Default().With("component", "catalog"),
+		hashes:    make(map[string]string),
+		badges:    make(map[string]map[string]model.Badge),
+		emotes:    make(map[string]model.Emote),
+		byName:    make(map[string]map[string]map[string]model.Emote),
+	}
+}
+
+// Run загружает сохранённые наборы и обновляет их из Helix и сторонних
+// источников до отмены контекста.
+func (c *Catalog) Run(ctx context.Context) error {
+	if err := c.Load(ctx); err != nil {
+		c.logger.Error("не удалось загрузить сохранённые значки и эмоуты", "err", err)
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Load заполняет каталог наборами из Store.
+func (c *Catalog) Load(ctx context.Context) error {
+	hashes, err := c.store.LoadHashes(ctx)
+	if err != nil {
+		return err
+	}
+	badges, err := c.store.LoadBadges(ctx)
+	if err != nil {
+		return err
+	}
+	emotes, err := c.store.LoadEmotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, hash := range hashes {
+		c.hashes[key] = hash
+	}
+	for _, badge := range badges {
+		c.putBadgeLocked(badge)
+	}
+	for _, emote := range emotes {
+		c.putEmoteLocked(emote)
+	}
+	return nil
+}
+
+// Refresh загружает глобальные наборы и наборы каналов и перезаписывает в
+// Store те, что изменились. Ошибки отдельных наборов пишутся в лог.
+func (c *Catalog) Refresh(ctx context.Context) {
+	scopes := []string{GlobalScope}
+	rooms, err := c.rooms(ctx)
+	if err != nil {
+		c.logError(ctx, "не удалось получить список каналов", err)
+	}
+	scopes = append(scopes, rooms...)
+
+	for _, scope := range scopes {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.refreshBadges(ctx, scope); err != nil {
+			c.logError(ctx, "не удалось обновить значки "+scope, err)
+		}
+		if err := c.refreshEmotes(ctx, scope); err != nil {
+			c.logError(ctx, "не удалось обновить эмоуты "+scope, err)
+		}
+		for _, provider := range c.providers {
+			if err := c.refreshProviderEmotes(ctx, provider, scope); err != nil {
+				c.logError(ctx, "не удалось обновить эмоуты "+provider.Name()+" "+scope, err)
+			}
+		}
+	}
+}
+
+// Badge возвращает версию значка: сначала из значков канала roomID, затем из глобальных.
+func (c *Catalog) Badge(roomID, setID, version string) (model.Badge, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key := setID + "/" + version
+	if badge, ok := c.badges[roomID][key]; ok {
+		return badge, true
+	}
+	badge, ok := c.badges[GlobalScope][key]
+	return badge, ok
+}
+
+// Badges раскрывает бэйджи сообщения (model.ChatMessage.Badges) в значки
+// каталога, отсортированные по имени набора. Неизвестные значки пропускаются.
+func (c *Catalog) Badges(roomID string, badges map[string]int) []model.Badge {
+	names := make([]string, 0, len(badges))
+	for name := range badges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]model.Badge, 0, len(names))
+	for _, name := range names {
+		if badge, ok := c.Badge(roomID, name, strconv.Itoa(badges[name])); ok {
+			out = append(out, badge)
+		}
+	}
+	return out
+}
+
+// Emote возвращает эмоут источника provider по id.
+func (c *Catalog) Emote(provider, id string) (model.Emote, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	emote, ok := c.emotes[provider+":"+id]
+	return emote, ok
+}
+
+// EmoteByName возвращает эмоут, доступный в канале roomID под именем name:
+// сначала эмоуты канала, затем глобальные; в каждой области — Twitch, затем
+// сторонние источники в порядке настройки.
+func (c *Catalog) EmoteByName(roomID, name string) (model.Emote, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.emoteByNameLocked(roomID, name)
+}
+
+// Tokenize находит в тексте сообщения эмоуты сторонних источников и считает
+// их использования. Слова, уже размеченные Twitch как эмоуты, и эмоуты Twitch,
+// найденные по имени, пропускаются: их размечает сам Twitch.
+func (c *Catalog) Tokenize(msg model.ChatMessage) []model.EmoteUsage {
+	if len(c.providers) == 0 {
+		return nil
+	}
+
+	native := make(map[string]bool, len(msg.Emotes))
+	for _, usage := range msg.Emotes {
+		native[usage.Name] = true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var usages []model.EmoteUsage
+	index := make(map[string]int)
+	for _, word := range strings.Fields(msg.Text) {
+		if native[word] {
+			continue
+		}
+		emote, ok := c.emoteByNameLocked(msg.RoomID, word)
+		if !ok || emote.Provider == model.EmoteProviderTwitch {
+			continue
+		}
+		key := emote.Provider + ":" + emote.ID
+		if i, ok := index[key]; ok {
+			usages[i].Count++
+			continue
+		}
+		index[key] = len(usages)
+		usages = append(usages, model.EmoteUsage{Provider: emote.Provider, ID: emote.ID, Name: emote.Name, Count: 1})
+	}
+	return usages
+}
+
+func (c *Catalog) emoteByNameLocked(roomID, name string) (model.Emote, bool) {
+	for _, scope := range []string{roomID, GlobalScope} {
+		if scope == "" {
+			continue
+		}
+		for _, provider := range c.order {
+			if emote, ok := c.byName[scope][provider][name]; ok {
+				return emote, true
+			}
+		}
+	}
+	return model.Emote{}, false
+}
+
+func (c *Catalog) refreshBadges(ctx context.Context, scope string) error {
+	var sets []helix.BadgeSet
+	var err error
+	if scope == GlobalScope {
+		sets, err = c.source.GetGlobalBadges(ctx)
+	} else {
+		sets, err = c.source.GetChannelBadges(ctx, scope)
+	}
+	if err != nil {
+		return err
+	}
+
+	var badges []model.Badge
+	for _, set := range sets {
+		for _, version := range set.Versions {
+			badges = append(badges, model.Badge{
+				Scope:       scope,
+				SetID:       set.SetID,
+				Version:     version.ID,
+				Title:       version.Title,
+				Description: version.Description,
+				ImageURL1x:  version.ImageURL1x,
+				ImageURL2x:  version.ImageURL2x,
+				ImageURL4x:  version.ImageURL4x,
+			})
+		}
+	}
+	sort.Slice(badges, func(i, j int) bool {
+		if badges[i].SetID != badges[j].SetID {
+			return badges[i].SetID < badges[j].SetID
+		}
+		return badges[i].Version < badges[j].Version
+	})
+
+	key := SetKey(KindBadges, model.EmoteProviderTwitch, scope)
+	hash := contentHash(badges)
+	if !c.changed(key, hash) {
+		return nil
+	}
+	if err := c.store.ReplaceBadges(ctx, scope, hash, badges); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[key] = hash
+	delete(c.badges, scope)
+	for _, badge := range badges {
+		c.putBadgeLocked(badge)
+	}
+	c.logger.Info("значки обновлены", "scope", scope, "count", len(badges))
+	return nil
+}
+
+func (c *Catalog) refreshEmotes(ctx context.Context, scope string) error {
+	var fetched []helix.Emote
+	var err error
+	if scope == GlobalScope {
+		fetched, err = c.source.GetGlobalEmotes(ctx)
+	} else {
+		fetched, err = c.source.GetChannelEmotes(ctx, scope)
+	}
+	if err != nil {
+		return err
+	}
+
+	emotes := make([]model.Emote, 0, len(fetched))
+	for _, emote := range fetched {
+		emotes = append(emotes, model.Emote{
+			Scope:      scope,
+			Provider:   model.EmoteProviderTwitch,
+			ID:         emote.ID,
+			Name:       emote.Name,
+			Type:       emote.EmoteType,
+			ImageURL1x: emote.Images.URL1x,
+			ImageURL2x: emote.Images.URL2x,
+			ImageURL4x: emote.Images.URL4x,
+		})
+	}
+	return c.replaceEmotes(ctx, model.EmoteProviderTwitch, scope, emotes)
+}
+
+func (c *Catalog) refreshProviderEmotes(ctx context.Context, provider Provider, scope string) error {
+	var emotes []model.Emote
+	var err error
+	if scope == GlobalScope {
+		emotes, err = provider.GlobalEmotes(ctx)
+	} else {
+		emotes, err = provider.ChannelEmotes(ctx, scope)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range emotes {
+		emotes[i].Scope = scope
+		emotes[i].Provider = provider.Name()
+	}
+	return c.replaceEmotes(ctx, provider.Name(), scope, emotes)
+}
+
+// replaceEmotes сохраняет набор эмоутов источника provider, если он изменился.
+func (c *Catalog) replaceEmotes(ctx context.Context, provider, scope string, emotes []model.Emote) error {
+	sort.Slice(emotes, func(i, j int) bool { return emotes[i].ID < emotes[j].ID })
+
+	key := SetKey(KindEmotes, provider, scope)
+	hash := contentHash(emotes)
+	if !c.changed(key, hash) {
+		return nil
+	}
+	if err := c.store.ReplaceEmotes(ctx, provider, scope, hash, emotes); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[key] = hash
+	c.dropEmotesLocked(provider, scope)
+	for _, emote := range emotes {
+		c.putEmoteLocked(emote)
+	}
+	c.logger.Info("эмоуты обновлены", "provider", provider, "scope", scope, "count", len(emotes))
+	return nil
+}
+
+func (c *Catalog) changed(key, hash string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hashes[key] != hash
+}
+
+func (c *Catalog) putBadgeLocked(badge model.Badge) {
+	if c.badges[badge.Scope] == nil {
+		c.badges[badge.Scope] = make(map[string]model.Badge)
+	}
+	c.badges[badge.Scope][badge.SetID+"/"+badge.Version] = badge
+}
+
+func (c *Catalog) putEmoteLocked(emote model.Emote) {
+	c.emotes[emote.Provider+":"+emote.ID] = emote
+	if c.byName[emote.Scope] == nil {
+		c.byName[emote.Scope] = make(map[string]map[string]model.Emote)
+	}
+	if c.byName[emote.Scope][emote.Provider] == nil {
+		c.byName[emote.Scope][emote.Provider] = make(map[string]model.Emote)
+	}
+	c.byName[emote.Scope][emote.Provider][emote.Name] = emote
+}
+
+func (c *Catalog) dropEmotesLocked(provider, scope string) {
+	for key, emote := range c.emotes {
+		if emote.Provider == provider && emote.Scope == scope {
+			delete(c.emotes, key)
+		}
+	}
+	delete(c.byName[scope], provider)
+}
+
+func (c *Catalog) logError(ctx context.Context, msg string, err error) {
+	if ctx.Err() == nil {
+		c.logger.Error(msg, "err", err)
+	}
+}
+
+// contentHash — хэш содержимого набора для сравнения с сохранённым.
+func contentHash(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+	"twitch-chat-logger/tokens"
+)
+
+// memoryStore — Store в памяти, считающий перезаписи наборов.
+type memoryStore struct {
+	mu       sync.Mutex
+	badges   []model.Badge
+	emotes   []model.Emote
+	hashes   map[string]string
+	replaced []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{hashes: make(map[string]string)}
+}
+
+func (s *memoryStore) LoadBadges(context.Context) ([]model.Badge, error) { return s.badges, nil }
+func (s *memoryStore) LoadEmotes(context.Context) ([]model.Emote, error) { return s.emotes, nil }
+
+func (s *memoryStore) LoadHashes(context.Context) (map[string]string, error) {
+	return s.hashes, nil
+}
+
+func (s *memoryStore) ReplaceBadges(_ context.Context, scope, hash string, badges []model.Badge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[SetKey(KindBadges, model.EmoteProviderTwitch, scope)] = hash
+	s.replaced = append(s.replaced, "badges:"+scope)
+	return nil
+}
+
+func (s *memoryStore) ReplaceEmotes(_ context.Context, provider, scope, hash string, emotes []model.Emote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[SetKey(KindEmotes, provider, scope)] = hash
+	s.replaced = append(s.replaced, "emotes:"+provider+":"+scope)
+	return nil
+}
+
+// newFakeHelix отдаёт значки и эмоуты; channelTitle меняет название значка канала.
+func newFakeHelix(t *testing.T, channelTitle *atomic.Value) *httptest.Server {
+	t.Helper()
+	write := func(w http.ResponseWriter, data any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat/badges/global":
+			write(w, []helix.BadgeSet{{SetID: "moderator", Versions: []helix.BadgeVersion{{ID: "1", Title: "Moderator", ImageURL1x: "https://example.test/mod"}}}})
+		case "/chat/badges":
+			if r.URL.Query().Get("broadcaster_id") != "1337" {
+				t.Errorf("unexpected broadcaster %q", r.URL.Query().Get("broadcaster_id"))
+			}
+			write(w, []helix.BadgeSet{{SetID: "subscriber", Versions: []helix.BadgeVersion{{ID: "12", Title: channelTitle.Load().(string)}}}})
+		case "/chat/emotes/global":
+			write(w, []helix.Emote{{ID: "25", Name: "Kappa", Images: helix.EmoteImages{URL1x: "https://example.test/25"}}})
+		case "/chat/emotes":
+			write(w, []helix.Emote{{ID: "emotesv2_1", Name: "chan1Hype", EmoteType: "subscriptions"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestCatalog(t *testing.T, store Store, channelTitle *atomic.Value) *Catalog {
+	srv := newFakeHelix(t, channelTitle)
+	client := helix.NewClient(helix.Config{ClientID: "client", BaseURL: srv.URL}, tokens.StaticToken{Access: "token"})
+	rooms := func(context.Context) ([]string, error) { return []string{"1337"}, nil }
+	return New(client, store, rooms, 0)
+}
+
+func TestCatalogResolvesBadgesAndEmotes(t *testing.T) {
+	var title atomic.Value
+	title.Store("1-Year Subscriber")
+	catalog := newTestCatalog(t, newMemoryStore(), &title)
+	catalog.Refresh(context.Background())
+
+	badges := catalog.Badges("1337", map[string]int{"subscriber": 12, "moderator": 1, "unknown": 1})
+	if len(badges) != 2 || badges[0].Title != "Moderator" || badges[0].ImageURL1x != "https://example.test/mod" || badges[1].Title != "1-Year Subscriber" {
+		t.Fatalf("unexpected badges: %+v", badges)
+	}
+	if _, ok := catalog.Badge("42", "subscriber", "12"); ok {
+		t.Fatal("channel badge must not resolve in another channel")
+	}
+
+	if emote, ok := catalog.Emote(model.EmoteProviderTwitch, "25"); !ok || emote.Name != "Kappa" || emote.Scope != GlobalScope {
+		t.Fatalf("unexpected emote by id: %+v, %v", emote, ok)
+	}
+	if emote, ok := catalog.EmoteByName("1337", "chan1Hype"); !ok || emote.Type != "subscriptions" {
+		t.Fatalf("unexpected channel emote: %+v, %v", emote, ok)
+	}
+	if emote, ok := catalog.EmoteByName("1337", "Kappa"); !ok || emote.ID != "25" {
+		t.Fatalf("global emote must be available in a channel: %+v, %v", emote, ok)
+	}
+}
+
+func TestCatalogRewritesOnlyChangedSets(t *testing.T) {
+	var title atomic.Value
+	title.Store("1-Year Subscriber")
+	store := newMemoryStore()
+	catalog := newTestCatalog(t, store, &title)
+
+	catalog.Refresh(context.Background())
+	if len(store.replaced) != 4 {
+		t.Fatalf("expected all four sets on first refresh, got %v", store.replaced)
+	}
+
+	catalog.Refresh(context.Background())
+	if len(store.replaced) != 4 {
+		t.Fatalf("unchanged sets must not be rewritten, got %v", store.replaced)
+	}
+
+	title.Store("Founder")
+	catalog.Refresh(context.Background())
+	if len(store.replaced) != 5 || store.replaced[4] != "badges:1337" {
+		t.Fatalf("expected only the channel badges to be rewritten, got %v", store.replaced)
+	}
+	if badge, ok := catalog.Badge("1337", "subscriber", "12"); !ok || badge.Title != "Founder" {
+		t.Fatalf("lookup must see the refreshed badge, got %+v", badge)
+	}
+
+	// Новый каталог поверх того же хранилища не перезаписывает наборы после перезапуска.
+	restarted := newTestCatalog(t, store, &title)
+	if err := restarted.Load(context.Background()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	restarted.Refresh(context.Background())
+	if len(store.replaced) != 5 {
+		t.Fatalf("sets saved before restart must not be rewritten, got %v", store.replaced)
+	}
+}
+
+func TestCatalogTokenizesThirdPartyEmotes(t *testing.T) {
+	var title atomic.Value
+	title.Store("1-Year Subscriber")
+	helixSrv := newFakeHelix(t, &title)
+	providerSrv := newFakeProviders(t)
+
+	client := helix.NewClient(helix.Config{ClientID: "client", BaseURL: helixSrv.URL}, tokens.StaticToken{Access: "token"})
+	rooms := func(context.Context) ([]string, error) { return []string{"1337"}, nil }
+	catalog := New(client, newMemoryStore(), rooms, 0,
+		newTestProvider(t, providerSrv, model.EmoteProviderSevenTV),
+		newTestProvider(t, providerSrv, model.EmoteProviderBTTV),
+		newTestProvider(t, providerSrv, model.EmoteProviderFFZ),
+	)
+	catalog.Refresh(context.Background())
+
+	// Эмоут канала важнее глобального: EZ в канале 1337 — общий эмоут BTTV,
+	// а в другом канале — глобальный эмоут 7TV.
+	msg := model.ChatMessage{
+		RoomID: "1337",
+		Text:   "Kappa EZ catJAM EZ OMEGALUL chan1Hype ZreknarF Hidden",
+		Emotes: []model.EmoteUsage{{Provider: model.EmoteProviderTwitch, ID: "25", Name: "Kappa", Count: 1}},
+	}
+	got := catalog.Tokenize(msg)
+	expected := []model.EmoteUsage{
+		{Provider: model.EmoteProviderBTTV, ID: "bs", Name: "EZ", Count: 2},
+		{Provider: model.EmoteProviderSevenTV, ID: "7c", Name: "catJAM", Count: 1},
+		{Provider: model.EmoteProviderFFZ, ID: "11", Name: "OMEGALUL", Count: 1},
+		{Provider: model.EmoteProviderFFZ, ID: "9", Name: "ZreknarF", Count: 1},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %+v, got %+v", expected, got)
+		}
+	}
+
+	msg.RoomID = "42"
+	if got := catalog.Tokenize(msg); len(got) != 2 || got[0].Provider != model.EmoteProviderSevenTV || got[0].ID != "7g" || got[0].Count != 2 {
+		t.Fatalf("global emotes expected outside the channel, got %+v", got)
+	}
+}
@@ -0,0 +1,266 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"twitch-chat-logger/model"
+)
+
+const providerRequestTimeout = 10 * time.Second
+
+// errNoChannel — у канала нет набора у источника (API ответил 404).
+var errNoChannel = errors.New("catalog: channel not found")
+
+// Provider загружает эмоуты стороннего источника: глобальные и канала по
+// его room-id. Канал без набора у источника — пустой список, а не ошибка.
+type Provider interface {
+	Name() string
+	GlobalEmotes(ctx context.Context) ([]model.Emote, error)
+	ChannelEmotes(ctx context.Context, roomID string) ([]model.Emote, error)
+}
+
+// NewProvider создаёт источник по имени (model.EmoteProviderSevenTV,
+// EmoteProviderBTTV, EmoteProviderFFZ) с API по адресу baseURL. Адреса по
+// умолчанию задаёт конфигурация.
+func NewProvider(name, baseURL string, httpClient *http.Client) (Provider, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: providerRequestTimeout}
+	}
+	api := jsonAPI{baseURL: strings.TrimRight(strings.TrimSpace(baseURL), "/"), httpClient: httpClient}
+
+	var provider Provider
+	switch name {
+	case model.EmoteProviderSevenTV:
+		provider = sevenTV{api}
+	case model.EmoteProviderBTTV:
+		provider = bttv{api}
+	case model.EmoteProviderFFZ:
+		provider = ffz{api}
+	default:
+		return nil, fmt.Errorf("catalog: unknown emote provider %q", name)
+	}
+	if api.baseURL == "" {
+		return nil, fmt.Errorf("catalog: %s: base url is required", name)
+	}
+	return provider, nil
+}
+
+// jsonAPI выполняет GET запросы к JSON API источника.
+type jsonAPI struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func (a jsonAPI) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("catalog: create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("catalog: request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNoChannel
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("catalog: unexpected status %s for %s: %s", resp.Status, path, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("catalog: decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// channelGet — get для набора канала: отсутствие канала у источника не ошибка.
+func (a jsonAPI) channelGet(ctx context.Context, path string, out any) (bool, error) {
+	err := a.get(ctx, path, out)
+	if errors.Is(err, errNoChannel) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sevenTV — эмоуты 7TV (API v3).
+type sevenTV struct{ api jsonAPI }
+
+type sevenTVEmote struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Data struct {
+		Animated bool `json:"animated"`
+		Host     struct {
+			URL string `json:"url"`
+		} `json:"host"`
+	} `json:"data"`
+}
+
+func (p sevenTV) Name() string { return model.EmoteProviderSevenTV }
+
+func (p sevenTV) GlobalEmotes(ctx context.Context) ([]model.Emote, error) {
+	var set struct {
+		Emotes []sevenTVEmote `json:"emotes"`
+	}
+	if err := p.api.get(ctx, "/emote-sets/global", &set); err != nil {
+		return nil, err
+	}
+	return p.convert(set.Emotes), nil
+}
+
+func (p sevenTV) ChannelEmotes(ctx context.Context, roomID string) ([]model.Emote, error) {
+	var user struct {
+		EmoteSet *struct {
+			Emotes []sevenTVEmote `json:"emotes"`
+		} `json:"emote_set"`
+	}
+	if ok, err := p.api.channelGet(ctx, "/users/twitch/"+roomID, &user); !ok || user.EmoteSet == nil {
+		return nil, err
+	}
+	return p.convert(user.EmoteSet.Emotes), nil
+}
+
+func (p sevenTV) convert(emotes []sevenTVEmote) []model.Emote {
+	out := make([]model.Emote, 0, len(emotes))
+	for _, emote := range emotes {
+		host := emote.Data.Host.URL
+		if strings.HasPrefix(host, "//") {
+			host = "https:" + host
+		}
+		kind := "static"
+		if emote.Data.Animated {
+			kind = "animated"
+		}
+		out = append(out, model.Emote{
+			ID:         emote.ID,
+			Name:       emote.Name,
+			Type:       kind,
+			ImageURL1x: host + "/1x.webp",
+			ImageURL2x: host + "/2x.webp",
+			ImageURL4x: host + "/4x.webp",
+		})
+	}
+	return out
+}
+
+// bttv — эмоуты BetterTTV.
+type bttv struct{ api jsonAPI }
+
+type bttvEmote struct {
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	ImageType string `json:"imageType"`
+}
+
+func (p bttv) Name() string { return model.EmoteProviderBTTV }
+
+func (p bttv) GlobalEmotes(ctx context.Context) ([]model.Emote, error) {
+	var emotes []bttvEmote
+	if err := p.api.get(ctx, "/cached/emotes/global", &emotes); err != nil {
+		return nil, err
+	}
+	return p.convert(emotes, "global"), nil
+}
+
+func (p bttv) ChannelEmotes(ctx context.Context, roomID string) ([]model.Emote, error) {
+	var user struct {
+		ChannelEmotes []bttvEmote `json:"channelEmotes"`
+		SharedEmotes  []bttvEmote `json:"sharedEmotes"`
+	}
+	if ok, err := p.api.channelGet(ctx, "/cached/users/twitch/"+roomID, &user); !ok {
+		return nil, err
+	}
+	return append(p.convert(user.ChannelEmotes, "channel"), p.convert(user.SharedEmotes, "shared")...), nil
+}
+
+func (p bttv) convert(emotes []bttvEmote, kind string) []model.Emote {
+	out := make([]model.Emote, 0, len(emotes))
+	for _, emote := range emotes {
+		base := "https://cdn.betterttv.net/emote/" + emote.ID
+		out = append(out, model.Emote{
+			ID:         emote.ID,
+			Name:       emote.Code,
+			Type:       kind,
+			ImageURL1x: base + "/1x",
+			ImageURL2x: base + "/2x",
+			ImageURL4x: base + "/3x",
+		})
+	}
+	return out
+}
+
+// ffz — эмоуты FrankerFaceZ.
+type ffz struct{ api jsonAPI }
+
+type ffzSet struct {
+	Emoticons []struct {
+		ID   int               `json:"id"`
+		Name string            `json:"name"`
+		URLs map[string]string `json:"urls"`
+	} `json:"emoticons"`
+}
+
+func (p ffz) Name() string { return model.EmoteProviderFFZ }
+
+func (p ffz) GlobalEmotes(ctx context.Context) ([]model.Emote, error) {
+	var global struct {
+		DefaultSets []int             `json:"default_sets"`
+		Sets        map[string]ffzSet `json:"sets"`
+	}
+	if err := p.api.get(ctx, "/set/global", &global); err != nil {
+		return nil, err
+	}
+
+	var out []model.Emote
+	for _, id := range global.DefaultSets {
+		out = append(out, p.convert(global.Sets[strconv.Itoa(id)])...)
+	}
+	return out, nil
+}
+
+func (p ffz) ChannelEmotes(ctx context.Context, roomID string) ([]model.Emote, error) {
+	var room struct {
+		Room struct {
+			Set int `json:"set"`
+		} `json:"room"`
+		Sets map[string]ffzSet `json:"sets"`
+	}
+	if ok, err := p.api.channelGet(ctx, "/room/id/"+roomID, &room); !ok {
+		return nil, err
+	}
+	return p.convert(room.Sets[strconv.Itoa(room.Room.Set)]), nil
+}
+
+func (p ffz) convert(set ffzSet) []model.Emote {
+	out := make([]model.Emote, 0, len(set.Emoticons))
+	for _, emote := range set.Emoticons {
+		out = append(out, model.Emote{
+			ID:         strconv.Itoa(emote.ID),
+			Name:       emote.Name,
+			ImageURL1x: absoluteURL(emote.URLs["1"]),
+			ImageURL2x: absoluteURL(emote.URLs["2"]),
+			ImageURL4x: absoluteURL(emote.URLs["4"]),
+		})
+	}
+	return out
+}
+
+// absoluteURL дополняет протокол у адресов вида //cdn.frankerfacez.com/...
+func absoluteURL(url string) string {
+	if strings.HasPrefix(url, "//") {
+		return "https:" + url
+	}
+	return url
+}
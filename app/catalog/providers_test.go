@@ -0,0 +1,116 @@
+package catalog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"twitch-chat-logger/model"
+)
+
+// newFakeProviders отдаёт глобальные наборы и наборы канала 1337 всех трёх
+// источников; для остальных каналов отвечает 404.
+func newFakeProviders(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/7tv/emote-sets/global":
+			_, _ = w.Write([]byte(`{"emotes":[{"id":"7g","name":"EZ","data":{"animated":false,"host":{"url":"//cdn.7tv.app/emote/7g"}}}]}`))
+		case "/7tv/users/twitch/1337":
+			_, _ = w.Write([]byte(`{"emote_set":{"emotes":[{"id":"7c","name":"catJAM","data":{"animated":true,"host":{"url":"//cdn.7tv.app/emote/7c"}}}]}}`))
+		case "/bttv/cached/emotes/global":
+			_, _ = w.Write([]byte(`[{"id":"bg","code":"FeelsGoodMan","imageType":"png"}]`))
+		case "/bttv/cached/users/twitch/1337":
+			_, _ = w.Write([]byte(`{"channelEmotes":[{"id":"bc","code":"chanPog"}],"sharedEmotes":[{"id":"bs","code":"EZ"}]}`))
+		case "/ffz/set/global":
+			_, _ = w.Write([]byte(`{"default_sets":[3],"sets":{"3":{"emoticons":[{"id":9,"name":"ZreknarF","urls":{"1":"//cdn.frankerfacez.com/emote/9/1","4":"//cdn.frankerfacez.com/emote/9/4"}}]},"4":{"emoticons":[{"id":10,"name":"Hidden"}]}}}`))
+		case "/ffz/room/id/1337":
+			_, _ = w.Write([]byte(`{"room":{"set":77},"sets":{"77":{"emoticons":[{"id":11,"name":"OMEGALUL","urls":{"1":"https://cdn.frankerfacez.com/emote/11/1"}}]}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestProvider(t *testing.T, srv *httptest.Server, name string) Provider {
+	t.Helper()
+	provider, err := NewProvider(name, srv.URL+"/"+name+"/", srv.Client())
+	if err != nil {
+		t.Fatalf("NewProvider(%s): %v", name, err)
+	}
+	return provider
+}
+
+func TestProvidersParseEmoteSets(t *testing.T) {
+	srv := newFakeProviders(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		provider string
+		global   model.Emote
+		channel  []string
+	}{
+		{
+			provider: model.EmoteProviderSevenTV,
+			global:   model.Emote{ID: "7g", Name: "EZ", Type: "static", ImageURL1x: "https://cdn.7tv.app/emote/7g/1x.webp", ImageURL2x: "https://cdn.7tv.app/emote/7g/2x.webp", ImageURL4x: "https://cdn.7tv.app/emote/7g/4x.webp"},
+			channel:  []string{"catJAM"},
+		},
+		{
+			provider: model.EmoteProviderBTTV,
+			global:   model.Emote{ID: "bg", Name: "FeelsGoodMan", Type: "global", ImageURL1x: "https://cdn.betterttv.net/emote/bg/1x", ImageURL2x: "https://cdn.betterttv.net/emote/bg/2x", ImageURL4x: "https://cdn.betterttv.net/emote/bg/3x"},
+			channel:  []string{"chanPog", "EZ"},
+		},
+		{
+			provider: model.EmoteProviderFFZ,
+			global:   model.Emote{ID: "9", Name: "ZreknarF", ImageURL1x: "https://cdn.frankerfacez.com/emote/9/1", ImageURL4x: "https://cdn.frankerfacez.com/emote/9/4"},
+			channel:  []string{"OMEGALUL"},
+		},
+	}
+
+	for _, tc := range cases {
+		provider := newTestProvider(t, srv, tc.provider)
+		if provider.Name() != tc.provider {
+			t.Fatalf("unexpected provider name %q", provider.Name())
+		}
+
+		global, err := provider.GlobalEmotes(ctx)
+		if err != nil {
+			t.Fatalf("%s global: %v", tc.provider, err)
+		}
+		if len(global) != 1 || global[0] != tc.global {
+			t.Fatalf("%s global: unexpected emotes %+v", tc.provider, global)
+		}
+
+		channel, err := provider.ChannelEmotes(ctx, "1337")
+		if err != nil {
+			t.Fatalf("%s channel: %v", tc.provider, err)
+		}
+		if len(channel) != len(tc.channel) {
+			t.Fatalf("%s channel: unexpected emotes %+v", tc.provider, channel)
+		}
+		for i, name := range tc.channel {
+			if channel[i].Name != name {
+				t.Fatalf("%s channel: unexpected emotes %+v", tc.provider, channel)
+			}
+		}
+
+		// Канал без набора у источника — пустой список без ошибки.
+		if missing, err := provider.ChannelEmotes(ctx, "42"); err != nil || len(missing) != 0 {
+			t.Fatalf("%s: unknown channel must be empty, got %+v, %v", tc.provider, missing, err)
+		}
+	}
+}
+
+func TestNewProviderRejectsUnknownNameAndEmptyURL(t *testing.T) {
+	if _, err := NewProvider("emoji", "https://example.test", nil); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+	// Адреса по умолчанию задаёт конфигурация, у каталога своих нет.
+	if _, err := NewProvider(model.EmoteProviderBTTV, " ", nil); err == nil {
+		t.Fatal("expected error for empty base url")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"twitch-chat-logger/config"
+)
+
+// runConfig выполняет подкоманду config. `config print` выводит действующую
+// конфигурацию (значения по умолчанию, файл, окружение и флаги -set) в
+// формате файла конфигурации со скрытыми секретами, а затем все найденные
+// проблемы; код выхода 1, если конфигурация некорректна.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "использование: chat-logger config print [-config файл] [-set key=value ...]")
+		return 2
+	}
+
+	cfg, err := config.Resolve(args[1:])
+	var invalid *config.ValidationError
+	if err != nil && !errors.As(err, &invalid) {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 2
+	}
+
+	if err := cfg.WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 1
+	}
+	if invalid != nil {
+		fmt.Fprintln(os.Stderr, "проблемы конфигурации:")
+		for _, problem := range invalid.Problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		return 1
+	}
+	return 0
+}
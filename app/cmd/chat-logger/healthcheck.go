@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"twitch-chat-logger/config"
+)
+
+// runHealthcheck запрашивает /readyz (или /healthz с -live) у запущенного
+// процесса и возвращает код выхода для HEALTHCHECK: 0 — готов, 1 — нет.
+// В distroless-образе нет curl, поэтому проверку выполняет сам бинарь.
+func runHealthcheck(args []string) int {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	live := flags.Bool("live", false, "проверять только, что процесс жив (/healthz)")
+	target := flags.String("url", "", "адрес проверки; по умолчанию http://127.0.0.1 с портом из HTTP_ADDR")
+	timeout := flags.Duration("timeout", 3*time.Second, "таймаут запроса")
+	file := flags.String("config", "", "YAML файл конфигурации; по умолчанию CONFIG_FILE")
+	_ = flags.Parse(args)
+
+	url := *target
+	if url == "" {
+		cfg, err := config.LoadHTTP(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+			return 1
+		}
+		base, err := localURL(cfg.Addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+			return 1
+		}
+		url = base + "/readyz"
+		if *live {
+			url = base + "/healthz"
+		}
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(os.Stdout, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck: %s ответил %s\n", url, resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// localURL превращает адрес прослушивания (":8080", "0.0.0.0:8080") в адрес
+// для запроса изнутри контейнера.
+func localURL(addr string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("HTTP_ADDR не задан, HTTP сервер выключен")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("некорректный HTTP_ADDR %q: %w", addr, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
@@ -3,48 +3,351 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"twitch-chat-logger/auth"
+	"twitch-chat-logger/catalog"
 	"twitch-chat-logger/config"
+	"twitch-chat-logger/eventsub"
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/metrics"
+	"twitch-chat-logger/model"
 	"twitch-chat-logger/service"
 	"twitch-chat-logger/storage"
+	"twitch-chat-logger/tokens"
 	"twitch-chat-logger/twitch"
 )
 
 func main() {
-	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+
+	started := time.Now()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("config load failed: %v", err)
+		configFailed(err)
 	}
 
+	logger := newLogger(cfg.Log)
+	slog.SetDefault(logger)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
 	pool, err := pgxpool.New(ctx, cfg.Postgres.DSN())
 	if err != nil {
-		log.Fatalf("pgxpool.New: %v", err)
+		fatal("не удалось создать пул PostgreSQL", err)
 	}
 	defer pool.Close()
 
+	registry := loadRegistry(ctx, pool, cfg.Batch.FlushTimeout)
+	cfg.Twitch.Channels = enabledChannels(cfg.Twitch.Channels, registry)
+
+	oauth := auth.NewClient(auth.Config{
+		ClientID:     cfg.Auth.ClientID,
+		ClientSecret: cfg.Auth.ClientSecret,
+		BaseURL:      cfg.Auth.OAuthURL,
+	})
+
+	// Метрики собираются, только если включён HTTP сервер, который их отдаёт.
+	var appMetrics *metrics.Metrics
+	var flushObserver storage.FlushObserver
+	var noticeObserver service.NoticeObserver
+	if cfg.HTTP.Addr != "" {
+		appMetrics = metrics.New()
+		flushObserver, noticeObserver = appMetrics, appMetrics
+	}
+
+	// Helix с токеном приложения нужен трекеру трансляций, снимкам каналов и каталогу.
+	var runners []service.Runner
+	var helixClient *helix.Client
+	if cfg.Streams.Enabled || cfg.Snapshots.Enabled || cfg.Catalog.Enabled {
+		store, err := newCredentialStore(cfg, pool)
+		if err != nil {
+			fatal("не удалось открыть хранилище токена приложения", err)
+		}
+		appTokens := tokens.NewAppTokenManager(tokens.AppTokens(store, cfg.Auth.ClientID), oauth.AppToken, tokens.AppTokenManagerConfig{})
+		helixClient = helix.NewClient(helix.Config{ClientID: cfg.Auth.ClientID, BaseURL: cfg.EventSub.HelixURL}, appTokens)
+		if appMetrics != nil {
+			appTokens.OnRefresh(func(token tokens.Token) {
+				appMetrics.SetTokenExpiry(tokens.AppTokenKind, token.ExpiresAt)
+			})
+		}
+		runners = append(runners, appTokens)
+	}
+
+	var streams *service.StreamTracker
+	var streamResolver storage.StreamResolver
+	if cfg.Streams.Enabled {
+		streams = service.NewStreamTracker(helixClient, storage.NewStreamStore(pool, cfg.Batch.FlushTimeout), cfg.Twitch.Channels, cfg.Streams.PollInterval)
+		streamResolver = streams
+		runners = append(runners, streams)
+	}
+	if cfg.Snapshots.Enabled {
+		// Снимки берут трансляции из опроса трекера, если он включён.
+		var live service.LiveStreamSource
+		if streams != nil {
+			live = streams
+		}
+		runners = append(runners, service.NewChannelSnapshotter(helixClient, live, storage.NewSnapshotStore(pool, cfg.Batch.FlushTimeout),
+			cfg.Twitch.Channels, cfg.Snapshots.Interval, cfg.Snapshots.ViewerSample))
+	}
+	var emotes service.EmoteTokenizer
+	if cfg.Catalog.Enabled {
+		providers, err := emoteProviders(cfg.Catalog)
+		if err != nil {
+			fatal("не удалось создать источники эмоутов", err)
+		}
+		emoteCatalog := catalog.New(helixClient, storage.NewCatalogStore(pool, cfg.Batch.FlushTimeout),
+			registryRooms(pool, cfg.Batch.FlushTimeout), cfg.Catalog.RefreshInterval, providers...)
+		emotes = emoteCatalog
+		runners = append(runners, emoteCatalog)
+	}
+
 	batcher := storage.NewBatcher(ctx, pool, storage.BatchConfig{
 		MaxBatch:      cfg.Batch.MaxBatch,
 		FlushEvery:    cfg.Batch.FlushEvery,
 		ChanBuffer:    cfg.Batch.ChanBuffer,
 		StatsLogEvery: cfg.Batch.StatsLogEvery,
 		FlushTimeout:  cfg.Batch.FlushTimeout,
-	})
+	}, streamResolver, flushObserver, logger)
+
+	// EventSub по WebSocket принимает только user token — используем токен бота.
+	var userToken tokens.TokenSource = tokens.StaticToken{Access: strings.TrimPrefix(cfg.Twitch.OAuthToken, "oauth:")}
 
-	handler := service.NewHandler(batcher, pool, cfg.Batch.FlushTimeout)
-	client := twitch.NewClient(cfg.Twitch, handler)
-	srv := service.New(client)
+	var refresher *tokens.UserTokenRefresher
+	if cfg.Auth.RefreshUserToken {
+		refresher, err = newUserTokenRefresher(cfg, oauth, pool)
+		if err != nil {
+			fatal("не удалось создать обновление токена бота", err)
+		}
+		token, err := refresher.Current(ctx)
+		if err != nil {
+			fatal("не удалось получить токен бота", err)
+		}
+		cfg.Twitch.OAuthToken = token.Access
+		userToken = refresher.AccessTokens()
+		if appMetrics != nil {
+			appMetrics.SetTokenExpiry(tokens.UserTokenKind, token.ExpiresAt)
+			refresher.OnRefresh(func(token tokens.UserToken) {
+				appMetrics.SetTokenExpiry(tokens.UserTokenKind, token.ExpiresAt)
+			})
+		}
+	}
+
+	handler := service.NewHandler(batcher, pool, cfg.Batch.FlushTimeout, registry, streams, emotes, noticeObserver, logger)
+	client := twitch.NewClient(cfg.Twitch, handler, logger)
+
+	if appMetrics != nil {
+		appMetrics.WatchClient(client)
+		appMetrics.WatchQueue(batcher)
+
+		readiness := service.NewReadiness(client, pool, batcher, cfg.HTTP.ReadyMaxQueue, cfg.HTTP.ReadyMaxFlushAge)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", appMetrics.Handler())
+		mux.Handle("/healthz", service.LivenessHandler(started))
+		mux.Handle("/readyz", readiness.Handler())
+		runners = append(runners, service.NewHTTPServer(cfg.HTTP.Addr, mux))
+	}
+
+	runners = append(runners, service.NewStatsLogger(client, cfg.Batch.StatsLogEvery))
+	runners = append(runners, service.NewRetentionPurger(storage.NewRetentionStore(pool, cfg.Batch.FlushTimeout), service.DefaultRetentionInterval))
+	if refresher != nil {
+		refresher.OnRefresh(func(token tokens.UserToken) {
+			client.SetToken(token.Access)
+		})
+		runners = append(runners, refresher)
+	}
+	runners = append(runners, tokens.NewValidator(userToken, validateUserToken(oauth, refresher), tokens.DefaultValidateInterval))
+	if cfg.EventSub.Enabled {
+		// Подписки WebSocket создаются только с токеном пользователя.
+		userHelix := helix.NewClient(helix.Config{ClientID: cfg.EventSub.ClientID, BaseURL: cfg.EventSub.HelixURL}, userToken)
+		runners = append(runners, eventsub.NewClient(cfg.EventSub, cfg.Twitch.Channels, cfg.Twitch.Reconnect, userHelix, handler))
+	}
+
+	srv := service.New(client, runners...)
 
 	if err := srv.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
-		log.Fatalf("service run failed: %v", err)
+		fatal("сервис остановлен с ошибкой", err)
 	}
 
-	log.Println("shutting down...")
+	logger.Info("завершение работы")
+}
+
+// newUserTokenRefresher собирает refresher токена бота поверх таблицы
+// twitch_tokens (TWITCH_TOKEN_STORE=postgres) или файлового хранилища,
+// зашифрованного, если задан TWITCH_TOKEN_KEY или TWITCH_TOKEN_KEY_FILE.
+// Токен хранится под ключом TWITCH_CLIENT_ID и TWITCH_USERNAME.
+// Если токена ещё нет, он создаётся из TWITCH_OAUTH_TOKEN и
+// TWITCH_REFRESH_TOKEN с немедленным обновлением.
+func newUserTokenRefresher(cfg config.Config, oauth *auth.Client, pool *pgxpool.Pool) (*tokens.UserTokenRefresher, error) {
+	store, err := newCredentialStore(cfg, pool)
+	if err != nil {
+		return nil, err
+	}
+	userTokens := tokens.UserTokens(store, cfg.Auth.ClientID, cfg.Twitch.Username)
+	refresher := tokens.NewUserTokenRefresher(userTokens, func(ctx context.Context, refreshToken string) (tokens.UserToken, error) {
+		token, err := oauth.RefreshUserToken(ctx, refreshToken)
+		if err != nil {
+			return tokens.UserToken{}, err
+		}
+		return tokens.UserToken{
+			Access:    token.AccessToken,
+			Refresh:   token.RefreshToken,
+			Scopes:    token.Scopes,
+			ExpiresAt: time.Now().Add(token.ExpiresIn),
+		}, nil
+	}, cfg.Auth.RefreshMargin)
+
+	if cfg.Auth.RefreshToken != "" {
+		seed := tokens.UserToken{
+			Access:  strings.TrimPrefix(cfg.Twitch.OAuthToken, "oauth:"),
+			Refresh: cfg.Auth.RefreshToken,
+		}
+		if err := refresher.Seed(seed); err != nil {
+			return nil, err
+		}
+	}
+
+	return refresher, nil
+}
+
+// loadRegistry читает реестр каналов channels. Если реестр недоступен,
+// каналы подключаются без его настроек.
+func loadRegistry(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) []model.ChannelSettings {
+	registry, err := storage.LoadChannels(ctx, pool, timeout)
+	if err != nil {
+		slog.Warn("реестр каналов недоступен, подключаемся ко всем каналам", "err", err)
+		return nil
+	}
+	return registry
+}
+
+// enabledChannels убирает из TWITCH_CHANNELS каналы, выключенные в реестре.
+func enabledChannels(configured []string, registry []model.ChannelSettings) []string {
+	disabled := make(map[string]bool)
+	for _, channel := range registry {
+		if !channel.Enabled {
+			disabled[channel.Login] = true
+		}
+	}
+
+	channels := make([]string, 0, len(configured))
+	for _, channel := range configured {
+		if disabled[strings.ToLower(channel)] {
+			slog.Info("канал выключен в реестре каналов", "channel", channel)
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// newLogger создаёт логгер с уровнем и форматом из конфигурации.
+func newLogger(cfg config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.Format == config.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// configFailed сообщает обо всех проблемах конфигурации и завершает процесс.
+func configFailed(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			slog.Error("ошибка конфигурации", "problem", problem)
+		}
+		os.Exit(1)
+	}
+	fatal("не удалось загрузить конфигурацию", err)
+}
+
+// fatal пишет ошибку запуска в лог и завершает процесс.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// emoteProviders создаёт сторонние источники эмоутов в порядке из конфигурации.
+func emoteProviders(cfg config.CatalogConfig) ([]catalog.Provider, error) {
+	urls := map[string]string{
+		model.EmoteProviderSevenTV: cfg.SevenTVURL,
+		model.EmoteProviderBTTV:    cfg.BTTVURL,
+		model.EmoteProviderFFZ:     cfg.FFZURL,
+	}
+	providers := make([]catalog.Provider, 0, len(cfg.Providers))
+	for _, name := range cfg.Providers {
+		provider, err := catalog.NewProvider(name, urls[name], nil)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// registryRooms возвращает room-id включённых каналов из реестра channels.
+func registryRooms(pool *pgxpool.Pool, timeout time.Duration) catalog.RoomsFunc {
+	return func(ctx context.Context) ([]string, error) {
+		channels, err := storage.LoadChannels(ctx, pool, timeout)
+		if err != nil {
+			return nil, err
+		}
+		rooms := make([]string, 0, len(channels))
+		for _, channel := range channels {
+			if channel.Enabled {
+				rooms = append(rooms, channel.RoomID)
+			}
+		}
+		return rooms, nil
+	}
+}
+
+// newCredentialStore возвращает хранилище токенов из TWITCH_TOKEN_STORE.
+func newCredentialStore(cfg config.Config, pool *pgxpool.Pool) (tokens.CredentialStore, error) {
+	if cfg.Auth.TokenStore != config.TokenStoreFile {
+		return storage.NewTokenStore(pool, cfg.Batch.FlushTimeout), nil
+	}
+	key, err := tokens.LoadKey(cfg.Auth.TokenKey, cfg.Auth.TokenKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return tokens.NewFileStore(cfg.Auth.TokenFile, cfg.Auth.UserTokenFile, key), nil
+}
+
+// validateUserToken проверяет токен бота через /oauth2/validate. Отозванный
+// токен обновляется, если включено обновление; иначе остаётся ошибка в логе.
+func validateUserToken(oauth *auth.Client, refresher *tokens.UserTokenRefresher) tokens.ValidateFunc {
+	return func(ctx context.Context, accessToken string) error {
+		info, err := oauth.ValidateToken(ctx, accessToken)
+		if errors.Is(err, auth.ErrInvalidToken) && refresher != nil {
+			slog.Warn("токен бота отозван, обновляем", "component", "auth")
+			_, err = refresher.ForceRefresh(ctx)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		slog.Info("токен бота действителен", "component", "auth", "login", info.Login, "expires_in", info.ExpiresIn)
+		return nil
+	}
 }
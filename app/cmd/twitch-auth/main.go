@@ -2,38 +2,82 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"twitch-chat-logger/auth"
 	"twitch-chat-logger/tokens"
 )
 
+const usage = `usage:
+  twitch-auth app [--oauth-url URL]
+  twitch-auth user [--scopes chat:read,chat:edit] [--redirect-url URL] [--oauth-url URL]
+  twitch-auth device [--scopes chat:read,chat:edit] [--oauth-url URL]
+  twitch-auth validate [--token TOKEN | --app | --login LOGIN] [--oauth-url URL]
+  twitch-auth revoke [--token TOKEN | --app | --login LOGIN] [--oauth-url URL]
+  twitch-auth refresh [--login LOGIN] [--oauth-url URL]
+  twitch-auth list
+  twitch-auth delete (--app | --login LOGIN)
+  twitch-auth keygen
+
+Tokens are saved to TWITCH_TOKEN_FILE (default .secrets/twitch_tokens.json)
+under the TWITCH_CLIENT_ID and the login of the account. The file is
+encrypted when TWITCH_TOKEN_KEY or TWITCH_TOKEN_KEY_FILE is set.`
+
 func main() {
-	if len(os.Args) < 2 || os.Args[1] != "app" {
-		fmt.Fprintln(os.Stderr, "usage: twitch-auth app")
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
 		os.Exit(1)
 	}
 
-	clientID := strings.TrimSpace(os.Getenv("TWITCH_CLIENT_ID"))
-	if clientID == "" {
-		log.Fatal("TWITCH_CLIENT_ID is required")
-	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	clientSecret := strings.TrimSpace(os.Getenv("TWITCH_CLIENT_SECRET"))
-	if clientSecret == "" {
-		log.Fatal("TWITCH_CLIENT_SECRET is required")
+	switch os.Args[1] {
+	case "app":
+		runApp(ctx, os.Args[2:])
+	case "user":
+		runUser(ctx, os.Args[2:])
+	case "device":
+		runDevice(ctx, os.Args[2:])
+	case "validate":
+		runValidate(ctx, os.Args[2:])
+	case "revoke":
+		runRevoke(ctx, os.Args[2:])
+	case "refresh":
+		runRefresh(ctx, os.Args[2:])
+	case "list":
+		runList()
+	case "delete":
+		runDelete(os.Args[2:])
+	case "keygen":
+		runKeygen()
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
 	}
+}
+
+func runApp(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("app", flag.ExitOnError)
+	oauthURL := oauthURLFlag(flags)
+	_ = flags.Parse(args)
 
-	store := tokens.FileTokenStore{}
-	manager := tokens.NewAppTokenManager(store, func() (string, time.Duration, error) {
-		return auth.GetAppToken(clientID, clientSecret)
+	clientID := requireEnv("TWITCH_CLIENT_ID")
+	client := auth.NewClient(auth.Config{
+		ClientID:     clientID,
+		ClientSecret: requireEnv("TWITCH_CLIENT_SECRET"),
+		BaseURL:      *oauthURL,
 	})
 
-	ctx := context.Background()
+	manager := tokens.NewAppTokenManager(tokens.AppTokens(fileStore(), clientID), client.AppToken, tokens.AppTokenManagerConfig{})
+
 	token, err := manager.Get(ctx)
 	if err != nil {
 		log.Fatalf("get app token: %v", err)
@@ -41,3 +85,315 @@ func main() {
 
 	fmt.Printf("ok, expires at %s\n", token.ExpiresAt.Format(time.RFC3339))
 }
+
+// runUser получает токен пользователя через authorization code flow и
+// сохраняет его под логином аккаунта; этот токен chat-logger читает при
+// TWITCH_TOKEN_REFRESH.
+func runUser(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("user", flag.ExitOnError)
+	scopes := flags.String("scopes", "chat:read,chat:edit", "comma-separated OAuth scopes")
+	redirectURL := flags.String("redirect-url", envOrDefault("TWITCH_REDIRECT_URL", auth.DefaultRedirectURL), "local callback URL registered in the Twitch console")
+	oauthURL := oauthURLFlag(flags)
+	_ = flags.Parse(args)
+
+	client := auth.NewClient(auth.Config{
+		ClientID:     requireEnv("TWITCH_CLIENT_ID"),
+		ClientSecret: requireEnv("TWITCH_CLIENT_SECRET"),
+		BaseURL:      *oauthURL,
+	})
+
+	token, err := client.LoginUser(ctx, *redirectURL, splitScopes(*scopes), func(link string) {
+		fmt.Printf("open this URL in a browser and authorize the bot account:\n\n%s\n\nwaiting for callback on %s ...\n", link, *redirectURL)
+	})
+	if err != nil {
+		log.Fatalf("user login: %v", err)
+	}
+
+	saveUserToken(ctx, client, token)
+}
+
+// runDevice получает токен пользователя через Device Code Grant — для серверов
+// без браузера: вход подтверждается с любого другого устройства.
+func runDevice(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("device", flag.ExitOnError)
+	scopes := flags.String("scopes", "chat:read,chat:edit", "comma-separated OAuth scopes")
+	oauthURL := oauthURLFlag(flags)
+	_ = flags.Parse(args)
+
+	client := auth.NewClient(auth.Config{
+		ClientID:     requireEnv("TWITCH_CLIENT_ID"),
+		ClientSecret: os.Getenv("TWITCH_CLIENT_SECRET"),
+		BaseURL:      *oauthURL,
+	})
+	scopeList := splitScopes(*scopes)
+
+	code, err := client.RequestDeviceCode(ctx, scopeList)
+	if err != nil {
+		log.Fatalf("device code: %v", err)
+	}
+
+	fmt.Printf("open %s on any device and enter the code %s\nwaiting for authorization (expires in %s) ...\n", code.VerificationURI, code.UserCode, code.ExpiresIn)
+
+	token, err := client.PollDeviceToken(ctx, scopeList, code)
+	if err != nil {
+		log.Fatalf("device login: %v", err)
+	}
+
+	saveUserToken(ctx, client, token)
+}
+
+// tokenFlags — общие флаги validate и revoke: токен задаётся явно или
+// берётся из хранилища: токен пользователя --login (или единственный
+// сохранённый токен пользователя) либо токен приложения при --app.
+type tokenFlags struct {
+	token    *string
+	app      *bool
+	login    *string
+	oauthURL *string
+}
+
+func newTokenFlags(flags *flag.FlagSet) tokenFlags {
+	return tokenFlags{
+		token:    flags.String("token", "", "access token to use (default: saved token)"),
+		app:      flags.Bool("app", false, "use the saved app token instead of a user token"),
+		login:    loginFlag(flags),
+		oauthURL: oauthURLFlag(flags),
+	}
+}
+
+// resolve возвращает токен и ключ, под которым он сохранён (nil для --token).
+func (f tokenFlags) resolve() (string, *tokens.Key) {
+	if token := strings.TrimSpace(*f.token); token != "" {
+		return token, nil
+	}
+
+	store := fileStore()
+	clientID := requireEnv("TWITCH_CLIENT_ID")
+	if *f.app {
+		token, err := tokens.AppTokens(store, clientID).LoadAppToken()
+		if err != nil {
+			log.Fatalf("load app token: %v", err)
+		}
+		key := tokens.AppKey(clientID)
+		return token.Access, &key
+	}
+
+	key := userKey(store, clientID, *f.login)
+	token, err := tokens.UserTokens(store, key.ClientID, key.Login).LoadUserToken()
+	if err != nil {
+		log.Fatalf("load user token: %v", err)
+	}
+	return token.Access, &key
+}
+
+// runValidate проверяет токен через /oauth2/validate и печатает владельца,
+// скоупы и оставшееся время жизни.
+func runValidate(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	tokenArgs := newTokenFlags(flags)
+	_ = flags.Parse(args)
+
+	token, _ := tokenArgs.resolve()
+	client := auth.NewClient(auth.Config{BaseURL: *tokenArgs.oauthURL})
+	info, err := client.ValidateToken(ctx, token)
+	if err != nil {
+		log.Fatalf("validate token: %v", err)
+	}
+
+	login := info.Login
+	if login == "" {
+		login = "(app token)"
+	}
+	fmt.Printf("ok, login %s, user id %s, client id %s, scopes %s, expires in %s\n",
+		login, info.UserID, info.ClientID, strings.Join(info.Scopes, ","), info.ExpiresIn)
+}
+
+// runRevoke отзывает токен и удаляет его из хранилища.
+func runRevoke(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+	tokenArgs := newTokenFlags(flags)
+	_ = flags.Parse(args)
+
+	client := auth.NewClient(auth.Config{ClientID: requireEnv("TWITCH_CLIENT_ID"), BaseURL: *tokenArgs.oauthURL})
+	token, key := tokenArgs.resolve()
+	if err := client.RevokeToken(ctx, token); err != nil {
+		log.Fatalf("revoke token: %v", err)
+	}
+
+	if key != nil {
+		if err := fileStore().DeleteCredential(*key); err != nil {
+			log.Fatalf("delete token: %v", err)
+		}
+		fmt.Printf("ok, revoked and deleted %s\n", key)
+		return
+	}
+	fmt.Println("ok, revoked")
+}
+
+// runRefresh принудительно обновляет сохранённый токен пользователя.
+func runRefresh(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("refresh", flag.ExitOnError)
+	login := loginFlag(flags)
+	oauthURL := oauthURLFlag(flags)
+	_ = flags.Parse(args)
+
+	client := auth.NewClient(auth.Config{
+		ClientID:     requireEnv("TWITCH_CLIENT_ID"),
+		ClientSecret: requireEnv("TWITCH_CLIENT_SECRET"),
+		BaseURL:      *oauthURL,
+	})
+	store := fileStore()
+	key := userKey(store, requireEnv("TWITCH_CLIENT_ID"), *login)
+
+	refresher := tokens.NewUserTokenRefresher(tokens.UserTokens(store, key.ClientID, key.Login), func(ctx context.Context, refreshToken string) (tokens.UserToken, error) {
+		token, err := client.RefreshUserToken(ctx, refreshToken)
+		if err != nil {
+			return tokens.UserToken{}, err
+		}
+		return newUserToken(token), nil
+	}, 0)
+	token, err := refresher.ForceRefresh(ctx)
+	if err != nil {
+		log.Fatalf("refresh %s: %v", key, err)
+	}
+
+	fmt.Printf("ok, refreshed %s, expires at %s\n", key, token.ExpiresAt.Format(time.RFC3339))
+}
+
+// runList печатает все сохранённые токены без их значений.
+func runList() {
+	credentials, err := fileStore().ListCredentials()
+	if err != nil {
+		log.Fatalf("list tokens: %v", err)
+	}
+
+	for _, credential := range credentials {
+		fmt.Printf("%s\tscopes %s\texpires at %s\n", credential.Key, strings.Join(credential.Scopes, ","), credential.ExpiresAt.Format(time.RFC3339))
+	}
+}
+
+// runDelete удаляет сохранённый токен, не отзывая его.
+func runDelete(args []string) {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+	app := flags.Bool("app", false, "delete the app token")
+	login := flags.String("login", "", "login of the account whose user token to delete")
+	_ = flags.Parse(args)
+
+	clientID := requireEnv("TWITCH_CLIENT_ID")
+	var key tokens.Key
+	switch {
+	case *app:
+		key = tokens.AppKey(clientID)
+	case strings.TrimSpace(*login) != "":
+		key = tokens.UserKey(clientID, strings.TrimSpace(*login))
+	default:
+		log.Fatal("delete: --app or --login is required")
+	}
+
+	if err := fileStore().DeleteCredential(key); err != nil {
+		log.Fatalf("delete token: %v", err)
+	}
+	fmt.Printf("ok, deleted %s\n", key)
+}
+
+// saveUserToken узнаёт логин аккаунта через /oauth2/validate и сохраняет
+// токен под ним.
+func saveUserToken(ctx context.Context, client *auth.Client, token auth.UserToken) {
+	info, err := client.ValidateToken(ctx, token.AccessToken)
+	if err != nil {
+		log.Fatalf("validate user token: %v", err)
+	}
+
+	userToken := newUserToken(token)
+	key := tokens.UserKey(info.ClientID, info.Login)
+	if err := tokens.UserTokens(fileStore(), key.ClientID, key.Login).SaveUserToken(userToken); err != nil {
+		log.Fatalf("save user token: %v", err)
+	}
+
+	fmt.Printf("ok, scopes %s, expires at %s, saved as %s\n", strings.Join(userToken.Scopes, ","), userToken.ExpiresAt.Format(time.RFC3339), key)
+}
+
+func newUserToken(token auth.UserToken) tokens.UserToken {
+	return tokens.UserToken{
+		Access:    token.AccessToken,
+		Refresh:   token.RefreshToken,
+		Scopes:    token.Scopes,
+		ExpiresAt: time.Now().Add(token.ExpiresIn),
+	}
+}
+
+// userKey возвращает ключ токена пользователя login; если логин не задан,
+// выбирается единственный сохранённый токен пользователя приложения, в том
+// числе токен старого формата без логина.
+func userKey(store tokens.CredentialStore, clientID, login string) tokens.Key {
+	if login = strings.TrimSpace(login); login != "" {
+		return tokens.UserKey(clientID, login)
+	}
+
+	credentials, err := store.ListCredentials()
+	if err != nil {
+		log.Fatalf("list tokens: %v", err)
+	}
+	var found []tokens.Key
+	for _, credential := range credentials {
+		key := credential.Key
+		if key.Kind == tokens.UserTokenKind && (key.ClientID == clientID || key.ClientID == "") {
+			found = append(found, key)
+		}
+	}
+	switch len(found) {
+	case 0:
+		log.Fatalf("no saved user token for client %s", clientID)
+	case 1:
+		return found[0]
+	}
+	log.Fatalf("several saved user tokens for client %s, pass --login", clientID)
+	return tokens.Key{}
+}
+
+// runKeygen печатает новый ключ для TWITCH_TOKEN_KEY.
+func runKeygen() {
+	key, err := tokens.GenerateKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(key)
+}
+
+// fileStore возвращает хранилище токенов в TWITCH_TOKEN_FILE, зашифрованное
+// ключом из TWITCH_TOKEN_KEY или TWITCH_TOKEN_KEY_FILE, если он задан.
+// Токен пользователя старого формата из TWITCH_USER_TOKEN_FILE переносится в него.
+func fileStore() tokens.CredentialStore {
+	key, err := tokens.LoadKey(os.Getenv("TWITCH_TOKEN_KEY"), os.Getenv("TWITCH_TOKEN_KEY_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return tokens.NewFileStore(os.Getenv("TWITCH_TOKEN_FILE"), os.Getenv("TWITCH_USER_TOKEN_FILE"), key)
+}
+
+func loginFlag(flags *flag.FlagSet) *string {
+	return flags.String("login", "", "login of the account (default: the only saved user token)")
+}
+
+func oauthURLFlag(flags *flag.FlagSet) *string {
+	return flags.String("oauth-url", envOrDefault("TWITCH_OAUTH_URL", auth.DefaultOAuthURL), "base URL of the OAuth server")
+}
+
+func requireEnv(key string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		log.Fatalf("%s is required", key)
+	}
+	return value
+}
+
+func envOrDefault(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+func splitScopes(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -2,23 +2,185 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
 	"strings"
 	"time"
+
+	"twitch-chat-logger/model"
+)
+
+// Транспорты подключения к Twitch IRC.
+const (
+	TransportIRC       = "irc"
+	TransportWebSocket = "websocket"
+)
+
+// Хранилища токенов.
+const (
+	TokenStoreFile     = "file"
+	TokenStorePostgres = "postgres"
+)
+
+// Форматы логов.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
-// Config агрегирует значения конфигурации из переменных окружения.
+const (
+	defaultIRCWebSocketURL      = "wss://irc-ws.chat.twitch.tv:443"
+	defaultEventSubWebSocketURL = "wss://eventsub.wss.twitch.tv/ws"
+	defaultHelixURL             = "https://api.twitch.tv/helix"
+	defaultOAuthURL             = "https://id.twitch.tv/oauth2"
+	defaultSevenTVURL           = "https://7tv.io/v3"
+	defaultBTTVURL              = "https://api.betterttv.net/3"
+	defaultFFZURL               = "https://api.frankerfacez.com/v1"
+	defaultEmoteProviders       = model.EmoteProviderSevenTV + "," + model.EmoteProviderBTTV + "," + model.EmoteProviderFFZ
+)
+
+// Config агрегирует значения конфигурации из файла, переменных окружения и флагов.
 type Config struct {
-	Twitch   TwitchConfig
-	Postgres PostgresConfig
-	Batch    BatchConfig
+	Twitch    TwitchConfig
+	Auth      AuthConfig
+	EventSub  EventSubConfig
+	Streams   StreamsConfig
+	Snapshots SnapshotsConfig
+	Catalog   CatalogConfig
+	HTTP      HTTPConfig
+	Log       LogConfig
+	Postgres  PostgresConfig
+	Batch     BatchConfig
 }
 
 // TwitchConfig содержит учётные данные и каналы для Twitch IRC клиента.
+// Transport выбирает go-twitch-irc (TransportIRC) или собственный клиент
+// IRC-over-WebSocket (TransportWebSocket), который подключается к WebSocketURL.
+// CommandPrefix — префикс команд чата (например "!"), пустой отключает команды.
+// Options — настройки отдельных каналов по логину в нижнем регистре; блоки
+// каналов, которых нет в Channels, ни на что не влияют.
 type TwitchConfig struct {
-	Username   string
-	OAuthToken string
-	Channels   []string
+	Username      string
+	OAuthToken    string
+	Channels      []string
+	Reconnect     ReconnectConfig
+	Health        HealthConfig
+	Transport     string
+	WebSocketURL  string
+	CommandPrefix string
+	Options       map[string]ChannelOptions
+}
+
+// HealthConfig задаёт контроль живости соединения: PING раз в PingInterval,
+// принудительное переподключение без PONG за PongTimeout или без любого входящего
+// трафика за IdleTimeout, и порог тишины, после которого канал считается подозрительным.
+type HealthConfig struct {
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+	IdleTimeout    time.Duration
+	ChannelSilence time.Duration
+}
+
+// ReconnectConfig задаёт экспоненциальный backoff между попытками переподключения.
+// MaxAttempts == 0 означает неограниченное число попыток.
+type ReconnectConfig struct {
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+// AuthConfig включает автоматическое обновление user token для IRC.
+// Токены хранятся в TokenFile под ключом client id и логина бота;
+// UserTokenFile — файл токена пользователя старого формата, который
+// переносится в TokenFile. Если токена ещё нет, он создаётся из
+// TWITCH_OAUTH_TOKEN и RefreshToken.
+type AuthConfig struct {
+	RefreshUserToken bool
+	ClientID         string
+	ClientSecret     string
+	RefreshToken     string
+	TokenFile        string
+	UserTokenFile    string
+	RefreshMargin    time.Duration
+	OAuthURL         string
+	// TokenKey или TokenKeyFile — ключ AES-256 для шифрования файлов токенов.
+	TokenKey     string
+	TokenKeyFile string
+	// TokenStore — где хранить токены: в файлах (TokenStoreFile) или в
+	// таблице twitch_tokens, общей для всех реплик (TokenStorePostgres).
+	TokenStore string
+}
+
+// EventSubConfig включает приём событий канала через EventSub WebSocket.
+// Пустой Types означает подписку на все поддерживаемые типы.
+type EventSubConfig struct {
+	Enabled      bool
+	ClientID     string
+	WebSocketURL string
+	HelixURL     string
+	Types        []string
+}
+
+// StreamsConfig включает отслеживание трансляций через Helix /streams с
+// опросом раз в PollInterval. Helix запрашивается с токеном приложения,
+// поэтому нужны TWITCH_CLIENT_ID и TWITCH_CLIENT_SECRET.
+type StreamsConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+}
+
+// SnapshotsConfig включает снимки состояния каналов (название, категория,
+// число зрителей) раз в Interval. Число зрителей без других изменений
+// пишется не чаще раза в ViewerSample. Как и StreamsConfig, требует токен приложения.
+type SnapshotsConfig struct {
+	Enabled      bool
+	Interval     time.Duration
+	ViewerSample time.Duration
+}
+
+// CatalogConfig включает каталог значков и эмоутов: глобальные наборы и
+// наборы каналов из реестра загружаются из Helix раз в RefreshInterval.
+// Providers — сторонние источники эмоутов в порядке приоритета при
+// совпадении имён; пустой список отключает их.
+type CatalogConfig struct {
+	Enabled         bool
+	RefreshInterval time.Duration
+	Providers       []string
+	SevenTVURL      string
+	BTTVURL         string
+	FFZURL          string
+}
+
+// HTTPConfig задаёт адрес служебного HTTP сервера с метриками Prometheus
+// (/metrics) и проверками /healthz и /readyz. Пустой Addr отключает сервер.
+// /readyz не готов, если в очереди батчера ReadyMaxQueue сообщений и больше
+// или последний флаш был раньше ReadyMaxFlushAge; ноль ReadyMaxQueue —
+// три четверти Batch.ChanBuffer.
+type HTTPConfig struct {
+	Addr             string
+	ReadyMaxQueue    int
+	ReadyMaxFlushAge time.Duration
+}
+
+// LogConfig задаёт минимальный уровень логов и формат вывода:
+// LogFormatText (key=value) или LogFormatJSON.
+type LogConfig struct {
+	Level  slog.Level
+	Format string
+}
+
+// Delay вычисляет экспоненциальную задержку перед попыткой attempt (начиная с 1).
+func (r ReconnectConfig) Delay(attempt int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	if delay > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return delay
 }
 
 // PostgresConfig хранит параметры подключения к пулу базы данных.
@@ -44,22 +206,74 @@ type BatchConfig struct {
 	FlushTimeout  time.Duration
 }
 
-// Load читает переменные окружения и возвращает валидированную Config.
-func Load() (Config, error) {
-	twitchChannels := splitAndTrim(os.Getenv("TWITCH_CHANNELS"))
+// ChannelOptions — настройки одного канала из блока channels файла
+// конфигурации. Незаданные поля наследуют общие значения: Enabled == false
+// исключает канал из Twitch.Channels, CommandPrefix заменяет
+// TwitchConfig.CommandPrefix (пустой отключает команды в канале), а
+// ChannelSilence — Health.ChannelSilence.
+type ChannelOptions struct {
+	Enabled        *bool
+	CommandPrefix  *string
+	ChannelSilence time.Duration
+}
 
-	cfg := Config{
+// ValidationError перечисляет все проблемы конфигурации, найденные при
+// разборе слоёв и проверке, а не только первую.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "некорректная конфигурация: " + strings.Join(e.Problems, "; ")
+}
+
+// defaults возвращает нижний слой конфигурации — значения по умолчанию.
+func defaults() Config {
+	return Config{
 		Twitch: TwitchConfig{
-			Username:   strings.TrimSpace(os.Getenv("TWITCH_USERNAME")),
-			OAuthToken: strings.TrimSpace(os.Getenv("TWITCH_OAUTH_TOKEN")),
-			Channels:   twitchChannels,
+			Reconnect: ReconnectConfig{
+				Backoff:    time.Second,
+				MaxBackoff: 2 * time.Minute,
+			},
+			Health: HealthConfig{
+				PingInterval:   time.Minute,
+				PongTimeout:    10 * time.Second,
+				IdleTimeout:    5 * time.Minute,
+				ChannelSilence: 30 * time.Minute,
+			},
+			Transport:     TransportIRC,
+			WebSocketURL:  defaultIRCWebSocketURL,
+			CommandPrefix: "!",
+		},
+		Auth: AuthConfig{
+			RefreshMargin: 10 * time.Minute,
+			OAuthURL:      defaultOAuthURL,
+			TokenStore:    TokenStoreFile,
+		},
+		EventSub: EventSubConfig{
+			WebSocketURL: defaultEventSubWebSocketURL,
+			HelixURL:     defaultHelixURL,
+		},
+		Streams: StreamsConfig{
+			PollInterval: time.Minute,
 		},
-		Postgres: PostgresConfig{
-			Host:     strings.TrimSpace(os.Getenv("POSTGRES_HOST")),
-			Port:     strings.TrimSpace(os.Getenv("POSTGRES_PORT")),
-			DB:       strings.TrimSpace(os.Getenv("POSTGRES_DB")),
-			User:     strings.TrimSpace(os.Getenv("POSTGRES_USER")),
-			Password: strings.TrimSpace(os.Getenv("POSTGRES_PASSWORD")),
+		Snapshots: SnapshotsConfig{
+			Interval:     time.Minute,
+			ViewerSample: 5 * time.Minute,
+		},
+		Catalog: CatalogConfig{
+			RefreshInterval: time.Hour,
+			Providers:       splitAndTrim(defaultEmoteProviders),
+			SevenTVURL:      defaultSevenTVURL,
+			BTTVURL:         defaultBTTVURL,
+			FFZURL:          defaultFFZURL,
+		},
+		HTTP: HTTPConfig{
+			ReadyMaxFlushAge: time.Minute,
+		},
+		Log: LogConfig{
+			Level:  slog.LevelInfo,
+			Format: LogFormatText,
 		},
 		Batch: BatchConfig{
 			MaxBatch:      100,
@@ -69,58 +283,253 @@ func Load() (Config, error) {
 			FlushTimeout:  5 * time.Second,
 		},
 	}
+}
 
-	if err := cfg.validate(); err != nil {
+// Load собирает конфигурацию по слоям: значения по умолчанию, файл
+// конфигурации (флаг -config или CONFIG_FILE), переменные окружения и флаги
+// -set key=value из args. Каждый следующий слой переопределяет предыдущий.
+// Ошибки разбора и проверки возвращаются все сразу в *ValidationError.
+func Load(args []string) (Config, error) {
+	cfg, err := Resolve(args)
+	if err != nil {
 		return Config{}, err
 	}
+	return cfg, nil
+}
 
+// Resolve собирает конфигурацию так же, как Load, но при ошибках проверки
+// возвращает и её, чтобы `config print` мог показать, что получилось.
+func Resolve(args []string) (Config, error) {
+	file, assignments, err := parseFlags(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, problems := load(file, assignments)
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
 	return cfg, nil
 }
 
-func (c Config) validate() error {
+// LoadHTTP читает только настройки служебного HTTP сервера из файла и
+// окружения; используется подкомандой healthcheck, которой не нужны
+// остальные параметры. Пустой file — файл из CONFIG_FILE.
+func LoadHTTP(file string) (HTTPConfig, error) {
+	cfg, problems := load(file, nil)
+	if len(problems) > 0 {
+		return HTTPConfig{}, &ValidationError{Problems: problems}
+	}
+	return cfg.HTTP, nil
+}
+
+// finalize выводит зависимые значения после применения всех слоёв.
+func (c *Config) finalize() {
+	c.EventSub.ClientID = c.Auth.ClientID
+	c.Log.Format = strings.ToLower(c.Log.Format)
+
+	// "none" явно отключает сторонние источники эмоутов.
+	providers := make([]string, 0, len(c.Catalog.Providers))
+	for _, provider := range c.Catalog.Providers {
+		providers = append(providers, strings.ToLower(provider))
+	}
+	if len(providers) == 1 && providers[0] == "none" {
+		providers = nil
+	}
+	c.Catalog.Providers = providers
+
+	// Сервер присылает логины каналов в нижнем регистре.
+	channels := make([]string, 0, len(c.Twitch.Channels))
+	for _, channel := range c.Twitch.Channels {
+		channel = strings.ToLower(channel)
+		if enabled := c.Twitch.Options[channel].Enabled; enabled != nil && !*enabled {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	c.Twitch.Channels = channels
+
+	if c.HTTP.ReadyMaxQueue == 0 {
+		c.HTTP.ReadyMaxQueue = c.Batch.ChanBuffer * 3 / 4
+	}
+}
+
+// problems накапливает ошибки проверки с именами параметров.
+type problems []string
+
+func (p *problems) add(key, format string, args ...any) {
+	*p = append(*p, describe(key)+": "+fmt.Sprintf(format, args...))
+}
+
+func (c Config) validate() []string {
+	var p problems
+
 	if c.Twitch.Username == "" {
-		return fmt.Errorf("требуется TWITCH_USERNAME")
+		p.add("twitch.username", "обязательный параметр")
 	}
-	if c.Twitch.OAuthToken == "" {
-		return fmt.Errorf("требуется TWITCH_OAUTH_TOKEN")
+	if c.Twitch.OAuthToken == "" && !c.Auth.RefreshUserToken {
+		p.add("twitch.oauth_token", "обязательный параметр")
 	}
 	if len(c.Twitch.Channels) == 0 {
-		return fmt.Errorf("требуется TWITCH_CHANNELS")
+		p.add("twitch.channels", "нужен хотя бы один включённый канал")
 	}
 
-	if c.Postgres.Host == "" {
-		return fmt.Errorf("требуется POSTGRES_HOST")
+	switch c.Twitch.Transport {
+	case TransportIRC, TransportWebSocket:
+	default:
+		p.add("twitch.transport", "должен быть %q или %q", TransportIRC, TransportWebSocket)
 	}
-	if c.Postgres.Port == "" {
-		return fmt.Errorf("требуется POSTGRES_PORT")
+	if c.Twitch.Transport == TransportWebSocket && c.Twitch.WebSocketURL == "" {
+		p.add("twitch.websocket_url", "обязателен при транспорте %q", TransportWebSocket)
 	}
-	if c.Postgres.DB == "" {
-		return fmt.Errorf("требуется POSTGRES_DB")
+
+	if c.Twitch.Reconnect.Backoff <= 0 {
+		p.add("twitch.reconnect.backoff", "должен быть больше нуля")
+	}
+	if c.Twitch.Reconnect.MaxBackoff < c.Twitch.Reconnect.Backoff {
+		p.add("twitch.reconnect.max_backoff", "должен быть не меньше twitch.reconnect.backoff")
+	}
+	if c.Twitch.Reconnect.MaxAttempts < 0 {
+		p.add("twitch.reconnect.max_attempts", "не может быть отрицательным")
+	}
+
+	if c.Twitch.Health.PingInterval <= 0 {
+		p.add("twitch.health.ping_interval", "должен быть больше нуля")
+	}
+	if c.Twitch.Health.PongTimeout <= 0 {
+		p.add("twitch.health.pong_timeout", "должен быть больше нуля")
+	}
+	if c.Twitch.Health.IdleTimeout <= c.Twitch.Health.PingInterval {
+		p.add("twitch.health.idle_timeout", "должен быть больше twitch.health.ping_interval")
 	}
-	if c.Postgres.User == "" {
-		return fmt.Errorf("требуется POSTGRES_USER")
+	if c.Twitch.Health.ChannelSilence <= 0 {
+		p.add("twitch.health.channel_silence", "должен быть больше нуля")
+	}
+
+	for _, channel := range sortedChannels(c.Twitch.Options) {
+		if c.Twitch.Options[channel].ChannelSilence < 0 {
+			p.add("channels."+channel+".channel_silence", "не может быть отрицательным")
+		}
+	}
+
+	// Обновлению токена бота и Helix с токеном приложения нужны client id и secret.
+	var needsApp []string
+	for _, feature := range []struct {
+		key     string
+		enabled bool
+	}{
+		{"auth.refresh_user_token", c.Auth.RefreshUserToken},
+		{"streams.enabled", c.Streams.Enabled},
+		{"snapshots.enabled", c.Snapshots.Enabled},
+		{"catalog.enabled", c.Catalog.Enabled},
+	} {
+		if feature.enabled {
+			needsApp = append(needsApp, feature.key)
+		}
 	}
-	if c.Postgres.Password == "" {
-		return fmt.Errorf("требуется POSTGRES_PASSWORD")
+	if len(needsApp) > 0 {
+		if c.Auth.ClientID == "" {
+			p.add("auth.client_id", "обязателен при %s", strings.Join(needsApp, ", "))
+		}
+		if c.Auth.ClientSecret == "" {
+			p.add("auth.client_secret", "обязателен при %s", strings.Join(needsApp, ", "))
+		}
+	}
+	if c.Auth.RefreshUserToken && c.Auth.RefreshMargin <= 0 {
+		p.add("auth.refresh_margin", "должен быть больше нуля")
+	}
+
+	switch c.Auth.TokenStore {
+	case TokenStoreFile, TokenStorePostgres:
+	default:
+		p.add("auth.token_store", "должен быть %q или %q", TokenStoreFile, TokenStorePostgres)
+	}
+
+	if c.EventSub.Enabled && c.EventSub.ClientID == "" {
+		p.add("auth.client_id", "обязателен при eventsub.enabled")
+	}
+
+	if c.Streams.Enabled && c.Streams.PollInterval <= 0 {
+		p.add("streams.poll_interval", "должен быть больше нуля")
+	}
+
+	if c.Snapshots.Enabled {
+		if c.Snapshots.Interval <= 0 {
+			p.add("snapshots.interval", "должен быть больше нуля")
+		}
+		if c.Snapshots.ViewerSample < c.Snapshots.Interval {
+			p.add("snapshots.viewer_sample", "должен быть не меньше snapshots.interval")
+		}
+	}
+
+	if c.Catalog.Enabled {
+		if c.Catalog.RefreshInterval <= 0 {
+			p.add("catalog.refresh_interval", "должен быть больше нуля")
+		}
+		urls := map[string]struct{ key, value string }{
+			model.EmoteProviderSevenTV: {"catalog.seventv_url", c.Catalog.SevenTVURL},
+			model.EmoteProviderBTTV:    {"catalog.bttv_url", c.Catalog.BTTVURL},
+			model.EmoteProviderFFZ:     {"catalog.ffz_url", c.Catalog.FFZURL},
+		}
+		for _, provider := range c.Catalog.Providers {
+			url, ok := urls[provider]
+			switch {
+			case ok && strings.TrimSpace(url.value) == "":
+				p.add(url.key, "обязателен для источника %q", provider)
+			case ok:
+			default:
+				p.add("catalog.providers", "неизвестный источник %q, допустимы %q, %q, %q",
+					provider, model.EmoteProviderSevenTV, model.EmoteProviderBTTV, model.EmoteProviderFFZ)
+			}
+		}
+	}
+
+	if c.HTTP.ReadyMaxQueue < 0 {
+		p.add("http.ready_max_queue", "не может быть отрицательным")
+	}
+	if c.HTTP.ReadyMaxFlushAge <= 0 {
+		p.add("http.ready_max_flush_age", "должен быть больше нуля")
+	}
+
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		p.add("log.format", "должен быть %q или %q", LogFormatText, LogFormatJSON)
+	}
+
+	for _, required := range []struct {
+		key   string
+		value string
+	}{
+		{"postgres.host", c.Postgres.Host},
+		{"postgres.port", c.Postgres.Port},
+		{"postgres.db", c.Postgres.DB},
+		{"postgres.user", c.Postgres.User},
+		{"postgres.password", c.Postgres.Password},
+	} {
+		if required.value == "" {
+			p.add(required.key, "обязательный параметр")
+		}
 	}
 
 	if c.Batch.MaxBatch <= 0 {
-		return fmt.Errorf("Batch.MaxBatch должен быть больше нуля")
+		p.add("batch.max_size", "должен быть больше нуля")
 	}
 	if c.Batch.FlushEvery <= 0 {
-		return fmt.Errorf("Batch.FlushEvery должен быть больше нуля")
+		p.add("batch.flush_interval", "должен быть больше нуля")
 	}
 	if c.Batch.ChanBuffer <= 0 {
-		return fmt.Errorf("Batch.ChanBuffer должен быть больше нуля")
+		p.add("batch.buffer", "должен быть больше нуля")
 	}
 	if c.Batch.StatsLogEvery <= 0 {
-		return fmt.Errorf("Batch.StatsLogEvery должен быть больше нуля")
+		p.add("batch.stats_interval", "должен быть больше нуля")
 	}
 	if c.Batch.FlushTimeout <= 0 {
-		return fmt.Errorf("Batch.FlushTimeout должен быть больше нуля")
+		p.add("batch.flush_timeout", "должен быть больше нуля")
 	}
 
-	return nil
+	return p
 }
 
 func splitAndTrim(s string) []string {
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -8,14 +13,14 @@ import (
 func TestLoadParsesRequiredEnv(t *testing.T) {
 	t.Setenv("TWITCH_USERNAME", "bot")
 	t.Setenv("TWITCH_OAUTH_TOKEN", "oauth:token")
-	t.Setenv("TWITCH_CHANNELS", "#chan1, chan2")
+	t.Setenv("TWITCH_CHANNELS", "#chan1, Chan2")
 	t.Setenv("POSTGRES_HOST", "localhost")
 	t.Setenv("POSTGRES_PORT", "5432")
 	t.Setenv("POSTGRES_DB", "db")
 	t.Setenv("POSTGRES_USER", "user")
 	t.Setenv("POSTGRES_PASSWORD", "pass")
 
-	cfg, err := Load()
+	cfg, err := Load(nil)
 	if err != nil {
 		t.Fatalf("Load returned error: %v", err)
 	}
@@ -45,7 +50,147 @@ func TestLoadParsesRequiredEnv(t *testing.T) {
 }
 
 func TestLoadValidatesMissingEnv(t *testing.T) {
-	if _, err := Load(); err == nil {
+	if _, err := Load(nil); err == nil {
 		t.Fatalf("expected error when env vars are missing")
 	}
 }
+
+func TestLoadRejectsInvalidReconnectBackoff(t *testing.T) {
+	t.Setenv("TWITCH_USERNAME", "bot")
+	t.Setenv("TWITCH_OAUTH_TOKEN", "oauth:token")
+	t.Setenv("TWITCH_CHANNELS", "chan1")
+	t.Setenv("POSTGRES_HOST", "localhost")
+	t.Setenv("POSTGRES_PORT", "5432")
+	t.Setenv("POSTGRES_DB", "db")
+	t.Setenv("POSTGRES_USER", "user")
+	t.Setenv("POSTGRES_PASSWORD", "pass")
+	t.Setenv("TWITCH_RECONNECT_BACKOFF", "soon")
+
+	if _, err := Load(nil); err == nil {
+		t.Fatalf("expected error for invalid TWITCH_RECONNECT_BACKOFF")
+	}
+}
+
+func TestReconnectDelayGrowsUntilMax(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	r := ReconnectConfig{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	for _, tc := range cases {
+		if got := r.Delay(tc.attempt); got != tc.want {
+			t.Fatalf("attempt %d: expected %s got %s", tc.attempt, tc.want, got)
+		}
+	}
+}
+
+func TestLoadLayersFileEnvAndFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+twitch:
+  username: bot
+  oauth_token: oauth:token
+  channels: [chan1, chan2, chan3]
+channels:
+  chan2:
+    enabled: false
+  chan3:
+    command_prefix: "?"
+    channel_silence: 2h
+postgres: {host: localhost, port: 5432, db: db, user: user, password: pass}
+batch:
+  max_size: 500
+  flush_interval: 2s
+  buffer: 1000
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BATCH_FLUSH_INTERVAL", "3s")
+	t.Setenv("BATCH_BUFFER", "2000")
+
+	cfg, err := Load([]string{"-config", file, "-set", "batch.buffer=4000"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Batch.MaxBatch != 500 || cfg.Batch.FlushEvery != 3*time.Second || cfg.Batch.ChanBuffer != 4000 {
+		t.Fatalf("unexpected batch layering: %+v", cfg.Batch)
+	}
+	if cfg.Batch.FlushTimeout != 5*time.Second {
+		t.Fatalf("expected default flush timeout, got %s", cfg.Batch.FlushTimeout)
+	}
+	if cfg.HTTP.ReadyMaxQueue != 3000 {
+		t.Fatalf("expected ready max queue from final buffer, got %d", cfg.HTTP.ReadyMaxQueue)
+	}
+	if strings.Join(cfg.Twitch.Channels, ",") != "chan1,chan3" {
+		t.Fatalf("disabled channel must be dropped, got %v", cfg.Twitch.Channels)
+	}
+	opts := cfg.Twitch.Options["chan3"]
+	if opts.CommandPrefix == nil || *opts.CommandPrefix != "?" || opts.ChannelSilence != 2*time.Hour {
+		t.Fatalf("unexpected chan3 options: %+v", opts)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("TWITCH_USERNAME", "bot")
+	t.Setenv("TWITCH_OAUTH_TOKEN", "oauth:token")
+	t.Setenv("TWITCH_CHANNELS", "chan1")
+	t.Setenv("TWITCH_RECONNECT_BACKOFF", "soon")
+	t.Setenv("TWITCH_TRANSPORT", "tcp")
+
+	_, err := Load([]string{"-set", "batch.max_size=0", "-set", "batch.size=10"})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	want := []string{
+		"TWITCH_RECONNECT_BACKOFF: некорректное значение",
+		"-set batch.size: неизвестный параметр",
+		"twitch.transport (TWITCH_TRANSPORT)",
+		"postgres.host (POSTGRES_HOST)",
+		"postgres.password (POSTGRES_PASSWORD)",
+		"batch.max_size (BATCH_MAX_SIZE)",
+	}
+	if len(invalid.Problems) != 9 {
+		t.Fatalf("expected 9 problems, got %d: %q", len(invalid.Problems), invalid.Problems)
+	}
+	for _, prefix := range want {
+		found := false
+		for _, problem := range invalid.Problems {
+			found = found || strings.HasPrefix(problem, prefix)
+		}
+		if !found {
+			t.Fatalf("missing problem %q in %q", prefix, invalid.Problems)
+		}
+	}
+}
+
+func TestWriteYAMLRedactsSecrets(t *testing.T) {
+	cfg := defaults()
+	cfg.Twitch.OAuthToken = "oauth:token"
+	cfg.Postgres.Password = "pass"
+	cfg.Postgres.User = "user"
+
+	var out bytes.Buffer
+	if err := cfg.WriteYAML(&out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	if strings.Contains(text, "oauth:token") || strings.Contains(text, "pass\n") {
+		t.Fatalf("secrets leaked:\n%s", text)
+	}
+	for _, line := range []string{"oauth_token: '***'", "password: '***'", "user: user", "client_secret: \"\"", "max_size: 100"} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, text)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted заменяет значения секретов в выводе `config print`.
+const redacted = "***"
+
+var errUnknownSetting = errors.New("неизвестный параметр")
+
+// setting связывает параметр файла конфигурации (ключ через точку) с
+// переменной окружения и полем Config. Значение разбирается по типу поля.
+type setting struct {
+	key    string
+	env    string
+	value  any
+	secret bool
+}
+
+// settings перечисляет параметры c в порядке вывода `config print`.
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "twitch.username", env: "TWITCH_USERNAME", value: &c.Twitch.Username},
+		{key: "twitch.oauth_token", env: "TWITCH_OAUTH_TOKEN", value: &c.Twitch.OAuthToken, secret: true},
+		{key: "twitch.channels", env: "TWITCH_CHANNELS", value: &c.Twitch.Channels},
+		{key: "twitch.transport", env: "TWITCH_TRANSPORT", value: &c.Twitch.Transport},
+		{key: "twitch.websocket_url", env: "TWITCH_IRC_WS_URL", value: &c.Twitch.WebSocketURL},
+		{key: "twitch.command_prefix", env: "TWITCH_COMMAND_PREFIX", value: &c.Twitch.CommandPrefix},
+		{key: "twitch.reconnect.backoff", env: "TWITCH_RECONNECT_BACKOFF", value: &c.Twitch.Reconnect.Backoff},
+		{key: "twitch.reconnect.max_backoff", env: "TWITCH_RECONNECT_MAX_BACKOFF", value: &c.Twitch.Reconnect.MaxBackoff},
+		{key: "twitch.reconnect.max_attempts", env: "TWITCH_RECONNECT_MAX_ATTEMPTS", value: &c.Twitch.Reconnect.MaxAttempts},
+		{key: "twitch.health.ping_interval", env: "TWITCH_PING_INTERVAL", value: &c.Twitch.Health.PingInterval},
+		{key: "twitch.health.pong_timeout", env: "TWITCH_PONG_TIMEOUT", value: &c.Twitch.Health.PongTimeout},
+		{key: "twitch.health.idle_timeout", env: "TWITCH_IDLE_TIMEOUT", value: &c.Twitch.Health.IdleTimeout},
+		{key: "twitch.health.channel_silence", env: "TWITCH_CHANNEL_SILENCE", value: &c.Twitch.Health.ChannelSilence},
+
+		{key: "auth.refresh_user_token", env: "TWITCH_TOKEN_REFRESH", value: &c.Auth.RefreshUserToken},
+		{key: "auth.client_id", env: "TWITCH_CLIENT_ID", value: &c.Auth.ClientID},
+		{key: "auth.client_secret", env: "TWITCH_CLIENT_SECRET", value: &c.Auth.ClientSecret, secret: true},
+		{key: "auth.refresh_token", env: "TWITCH_REFRESH_TOKEN", value: &c.Auth.RefreshToken, secret: true},
+		{key: "auth.token_file", env: "TWITCH_TOKEN_FILE", value: &c.Auth.TokenFile},
+		{key: "auth.user_token_file", env: "TWITCH_USER_TOKEN_FILE", value: &c.Auth.UserTokenFile},
+		{key: "auth.refresh_margin", env: "TWITCH_TOKEN_REFRESH_MARGIN", value: &c.Auth.RefreshMargin},
+		{key: "auth.oauth_url", env: "TWITCH_OAUTH_URL", value: &c.Auth.OAuthURL},
+		{key: "auth.token_key", env: "TWITCH_TOKEN_KEY", value: &c.Auth.TokenKey, secret: true},
+		{key: "auth.token_key_file", env: "TWITCH_TOKEN_KEY_FILE", value: &c.Auth.TokenKeyFile},
+		{key: "auth.token_store", env: "TWITCH_TOKEN_STORE", value: &c.Auth.TokenStore},
+
+		{key: "eventsub.enabled", env: "TWITCH_EVENTSUB_ENABLED", value: &c.EventSub.Enabled},
+		{key: "eventsub.websocket_url", env: "TWITCH_EVENTSUB_WS_URL", value: &c.EventSub.WebSocketURL},
+		{key: "eventsub.helix_url", env: "TWITCH_HELIX_URL", value: &c.EventSub.HelixURL},
+		{key: "eventsub.types", env: "TWITCH_EVENTSUB_TYPES", value: &c.EventSub.Types},
+
+		{key: "streams.enabled", env: "TWITCH_STREAMS_ENABLED", value: &c.Streams.Enabled},
+		{key: "streams.poll_interval", env: "TWITCH_STREAMS_POLL_INTERVAL", value: &c.Streams.PollInterval},
+
+		{key: "snapshots.enabled", env: "TWITCH_SNAPSHOTS_ENABLED", value: &c.Snapshots.Enabled},
+		{key: "snapshots.interval", env: "TWITCH_SNAPSHOTS_INTERVAL", value: &c.Snapshots.Interval},
+		{key: "snapshots.viewer_sample", env: "TWITCH_SNAPSHOTS_VIEWER_SAMPLE", value: &c.Snapshots.ViewerSample},
+
+		{key: "catalog.enabled", env: "TWITCH_CATALOG_ENABLED", value: &c.Catalog.Enabled},
+		{key: "catalog.refresh_interval", env: "TWITCH_CATALOG_REFRESH_INTERVAL", value: &c.Catalog.RefreshInterval},
+		{key: "catalog.providers", env: "TWITCH_EMOTE_PROVIDERS", value: &c.Catalog.Providers},
+		{key: "catalog.seventv_url", env: "TWITCH_7TV_URL", value: &c.Catalog.SevenTVURL},
+		{key: "catalog.bttv_url", env: "TWITCH_BTTV_URL", value: &c.Catalog.BTTVURL},
+		{key: "catalog.ffz_url", env: "TWITCH_FFZ_URL", value: &c.Catalog.FFZURL},
+
+		{key: "http.addr", env: "HTTP_ADDR", value: &c.HTTP.Addr},
+		{key: "http.ready_max_queue", env: "READY_MAX_QUEUE", value: &c.HTTP.ReadyMaxQueue},
+		{key: "http.ready_max_flush_age", env: "READY_MAX_FLUSH_AGE", value: &c.HTTP.ReadyMaxFlushAge},
+
+		{key: "log.level", env: "LOG_LEVEL", value: &c.Log.Level},
+		{key: "log.format", env: "LOG_FORMAT", value: &c.Log.Format},
+
+		{key: "postgres.host", env: "POSTGRES_HOST", value: &c.Postgres.Host},
+		{key: "postgres.port", env: "POSTGRES_PORT", value: &c.Postgres.Port},
+		{key: "postgres.db", env: "POSTGRES_DB", value: &c.Postgres.DB},
+		{key: "postgres.user", env: "POSTGRES_USER", value: &c.Postgres.User},
+		{key: "postgres.password", env: "POSTGRES_PASSWORD", value: &c.Postgres.Password, secret: true},
+
+		{key: "batch.max_size", env: "BATCH_MAX_SIZE", value: &c.Batch.MaxBatch},
+		{key: "batch.flush_interval", env: "BATCH_FLUSH_INTERVAL", value: &c.Batch.FlushEvery},
+		{key: "batch.buffer", env: "BATCH_BUFFER", value: &c.Batch.ChanBuffer},
+		{key: "batch.stats_interval", env: "BATCH_STATS_INTERVAL", value: &c.Batch.StatsLogEvery},
+		{key: "batch.flush_timeout", env: "BATCH_FLUSH_TIMEOUT", value: &c.Batch.FlushTimeout},
+	}
+}
+
+// parse записывает в поле значение raw из файла, окружения или флага.
+func (s setting) parse(raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch v := s.value.(type) {
+	case *string:
+		*v = raw
+	case *[]string:
+		*v = splitAndTrim(raw)
+	case *bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		*v = b
+	case *int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		*v = n
+	case *time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		*v = d
+	case *slog.Level:
+		return v.UnmarshalText([]byte(raw))
+	default:
+		return fmt.Errorf("неподдерживаемый тип %T", s.value)
+	}
+	return nil
+}
+
+// display возвращает значение для `config print`; секреты скрываются.
+func (s setting) display() any {
+	switch v := s.value.(type) {
+	case *string:
+		if s.secret && *v != "" {
+			return redacted
+		}
+		return *v
+	case *[]string:
+		if *v == nil {
+			return []string{}
+		}
+		return *v
+	case *time.Duration:
+		return v.String()
+	case *slog.Level:
+		return strings.ToLower(v.String())
+	case *bool:
+		return *v
+	case *int:
+		return *v
+	}
+	return nil
+}
+
+// describe возвращает ключ параметра вместе с его переменной окружения.
+func describe(key string) string {
+	for _, s := range (&Config{}).settings() {
+		if s.key == key {
+			return fmt.Sprintf("%s (%s)", key, s.env)
+		}
+	}
+	return key
+}
+
+// setOption разбирает параметр option из блока настроек канала channel.
+func (t *TwitchConfig) setOption(channel, option, raw string) error {
+	channel = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#"))
+	raw = strings.TrimSpace(raw)
+	opts := t.Options[channel]
+
+	switch option {
+	case "enabled":
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		opts.Enabled = &enabled
+	case "command_prefix":
+		opts.CommandPrefix = &raw
+	case "channel_silence":
+		silence, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		opts.ChannelSilence = silence
+	default:
+		return errUnknownSetting
+	}
+
+	if t.Options == nil {
+		t.Options = make(map[string]ChannelOptions)
+	}
+	t.Options[channel] = opts
+	return nil
+}
+
+// loader применяет слои конфигурации и копит ошибки разбора всех слоёв,
+// чтобы сообщить о них разом.
+type loader struct {
+	cfg      *Config
+	settings map[string]setting
+	problems []string
+}
+
+// load собирает конфигурацию из значений по умолчанию, файла file (пустой —
+// из CONFIG_FILE), окружения и присваиваний key=value.
+func load(file string, assignments []string) (Config, []string) {
+	cfg := defaults()
+	l := &loader{cfg: &cfg, settings: make(map[string]setting)}
+	for _, s := range cfg.settings() {
+		l.settings[s.key] = s
+	}
+
+	if file == "" {
+		file = strings.TrimSpace(os.Getenv("CONFIG_FILE"))
+	}
+	if file != "" {
+		l.applyFile(file)
+	}
+	l.applyEnv()
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			l.problems = append(l.problems, fmt.Sprintf("-set %s: ожидается key=value", assignment))
+			continue
+		}
+		key = strings.TrimSpace(key)
+		l.set("-set "+key, key, value)
+	}
+
+	cfg.finalize()
+	return cfg, l.problems
+}
+
+// set применяет значение параметра key; where указывает источник в ошибках.
+func (l *loader) set(where, key, raw string) {
+	var err error
+	if rest, ok := strings.CutPrefix(key, "channels."); ok {
+		channel, option, found := strings.Cut(rest, ".")
+		if !found {
+			err = errUnknownSetting
+		} else {
+			err = l.cfg.Twitch.setOption(channel, option, raw)
+		}
+	} else if s, ok := l.settings[key]; ok {
+		err = s.parse(raw)
+	} else {
+		err = errUnknownSetting
+	}
+
+	switch {
+	case errors.Is(err, errUnknownSetting):
+		l.problems = append(l.problems, fmt.Sprintf("%s: неизвестный параметр", where))
+	case err != nil:
+		l.problems = append(l.problems, fmt.Sprintf("%s: некорректное значение %q: %v", where, strings.TrimSpace(raw), err))
+	}
+}
+
+func (l *loader) applyEnv() {
+	for _, s := range l.cfg.settings() {
+		if raw := strings.TrimSpace(os.Getenv(s.env)); raw != "" {
+			l.set(s.env, s.key, raw)
+		}
+	}
+}
+
+// applyFile читает YAML файл, в котором параметры вложены по частям ключа:
+// twitch.health.ping_interval задаётся как twitch: {health: {ping_interval: 1m}}.
+func (l *loader) applyFile(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("файл конфигурации: %v", err))
+		return
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: %v", file, err))
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		l.problems = append(l.problems, fmt.Sprintf("%s: ожидается словарь параметров", file))
+		return
+	}
+	l.walk(file, "", root)
+}
+
+func (l *loader) walk(file, key string, node *yaml.Node) {
+	where := fmt.Sprintf("%s:%d: %s", file, node.Line, key)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := node.Content[i].Value
+			if key != "" {
+				child = key + "." + child
+			}
+			l.walk(file, child, node.Content[i+1])
+		}
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				l.problems = append(l.problems, fmt.Sprintf("%s: ожидается список значений", where))
+				return
+			}
+			items = append(items, item.Value)
+		}
+		l.set(where, key, strings.Join(items, ","))
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return
+		}
+		l.set(where, key, node.Value)
+	default:
+		l.problems = append(l.problems, fmt.Sprintf("%s: неподдерживаемое значение", where))
+	}
+}
+
+// assignments собирает повторяющийся флаг -set key=value.
+type assignments []string
+
+func (a *assignments) String() string { return strings.Join(*a, ", ") }
+
+func (a *assignments) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+// parseFlags разбирает флаги -config и -set.
+func parseFlags(args []string) (string, []string, error) {
+	flags := flag.NewFlagSet("chat-logger", flag.ContinueOnError)
+	file := flags.String("config", "", "YAML файл конфигурации; по умолчанию CONFIG_FILE")
+	var sets assignments
+	flags.Var(&sets, "set", "параметр key=value поверх файла и окружения, например batch.max_size=500; можно повторять")
+	if err := flags.Parse(args); err != nil {
+		return "", nil, err
+	}
+	if flags.NArg() > 0 {
+		return "", nil, fmt.Errorf("неожиданные аргументы: %s", strings.Join(flags.Args(), " "))
+	}
+	return *file, sets, nil
+}
+
+func sortedChannels(options map[string]ChannelOptions) []string {
+	channels := make([]string, 0, len(options))
+	for channel := range options {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// WriteYAML выводит действующую конфигурацию в формате файла конфигурации;
+// секреты заменяются на "***".
+func (c Config) WriteYAML(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.settings() {
+		if err := put(root, strings.Split(s.key, "."), s.display()); err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range sortedChannels(c.Twitch.Options) {
+		opts := c.Twitch.Options[channel]
+		path := []string{"channels", channel, ""}
+		if opts.Enabled != nil {
+			path[2] = "enabled"
+			if err := put(root, path, *opts.Enabled); err != nil {
+				return err
+			}
+		}
+		if opts.CommandPrefix != nil {
+			path[2] = "command_prefix"
+			if err := put(root, path, *opts.CommandPrefix); err != nil {
+				return err
+			}
+		}
+		if opts.ChannelSilence != 0 {
+			path[2] = "channel_silence"
+			if err := put(root, path, opts.ChannelSilence.String()); err != nil {
+				return err
+			}
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// put кладёт value в mapping по пути path, создавая промежуточные словари.
+func put(mapping *yaml.Node, path []string, value any) error {
+	for _, part := range path[:len(path)-1] {
+		var next *yaml.Node
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == part {
+				next = mapping.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, next)
+		}
+		mapping = next
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: path[len(path)-1]}, &node)
+	return nil
+}
@@ -0,0 +1,341 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+// keepaliveGrace добавляется к keepalive_timeout_seconds из приветствия,
+// чтобы не рвать соединение из-за задержек в сети.
+const keepaliveGrace = 5 * time.Second
+
+// Handler принимает уведомления EventSub, преобразованные в доменные модели.
+type Handler interface {
+	HandleEvent(context.Context, model.ChannelEvent)
+}
+
+// HelixAPI — вызовы Helix, нужные для подписок. Для WebSocket-транспорта
+// Twitch принимает только user access token со скоупами нужных подписок,
+// поэтому helix.Client создаётся с токеном пользователя.
+type HelixAPI interface {
+	GetUsers(ctx context.Context, ids, logins []string) ([]helix.User, error)
+	CreateEventSubSubscription(ctx context.Context, sub helix.EventSubSubscription) error
+}
+
+// Client держит WebSocket-сессию EventSub и создаёт подписки для каналов.
+type Client struct {
+	cfg       config.EventSubConfig
+	channels  []string
+	reconnect config.ReconnectConfig
+	api       HelixAPI
+	handler   Handler
+	dialer    *websocket.Dialer
+	logger    *slog.Logger
+}
+
+// NewClient создаёт клиента EventSub для указанных каналов.
+func NewClient(cfg config.EventSubConfig, channels []string, reconnect config.ReconnectConfig, api HelixAPI, handler Handler) *Client {
+	return &Client{
+		cfg:       cfg,
+		channels:  channels,
+		reconnect: reconnect,
+		api:       api,
+		handler:   handler,
+		dialer:    websocket.DefaultDialer,
+		logger:    slog.Default().With("component", "eventsub"),
+	}
+}
+
+// Run держит сессию EventSub и переподключается с backoff до отмены контекста.
+func (c *Client) Run(ctx context.Context) error {
+	specs, err := selectSubscriptions(c.cfg.Types)
+	if err != nil {
+		return err
+	}
+
+	attempt := 0
+	for {
+		subscribed, err := c.serve(ctx, specs)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if subscribed {
+			attempt = 0
+		}
+		attempt++
+
+		if c.reconnect.MaxAttempts > 0 && attempt > c.reconnect.MaxAttempts {
+			return fmt.Errorf("eventsub: исчерпаны попытки переподключения (%d): %w", c.reconnect.MaxAttempts, err)
+		}
+
+		delay := c.reconnect.Delay(attempt)
+		c.logger.Warn("сессия прервана", "err", err, "attempt", attempt, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// serve открывает новую сессию, создаёт подписки и читает уведомления.
+// При session_reconnect подписки переносятся Twitch на новое соединение сами.
+func (c *Client) serve(ctx context.Context, specs []subscriptionSpec) (subscribed bool, err error) {
+	conn, session, err := c.dial(ctx, c.cfg.WebSocketURL)
+	if err != nil {
+		return false, err
+	}
+
+	if err := c.subscribe(ctx, session.ID, specs); err != nil {
+		conn.close()
+		return false, err
+	}
+
+	for {
+		reconnectURL, err := c.read(ctx, conn, session)
+		if err != nil {
+			conn.close()
+			return true, err
+		}
+
+		// Новое соединение открывается до закрытия старого, иначе можно потерять события.
+		next, nextSession, err := c.dial(ctx, reconnectURL)
+		conn.close()
+		if err != nil {
+			return true, err
+		}
+		c.logger.Info("сессия перенесена", "session_id", session.ID, "next_session_id", nextSession.ID)
+		conn, session = next, nextSession
+	}
+}
+
+// wsConn — WebSocket-соединение, закрываемое при отмене контекста.
+type wsConn struct {
+	*websocket.Conn
+	stop chan struct{}
+}
+
+func (c *wsConn) close() {
+	close(c.stop)
+	_ = c.Conn.Close()
+}
+
+func (c *Client) dial(ctx context.Context, url string) (*wsConn, sessionPayload, error) {
+	raw, _, err := c.dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, sessionPayload{}, fmt.Errorf("eventsub: dial %s: %w", url, err)
+	}
+
+	conn := &wsConn{Conn: raw, stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = raw.Close()
+		case <-conn.stop:
+		}
+	}()
+
+	// Twitch присылает session_welcome первым сообщением; ждать его дольше 10 секунд нет смысла.
+	_ = raw.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var msg envelope
+	if err := raw.ReadJSON(&msg); err != nil {
+		conn.close()
+		return nil, sessionPayload{}, fmt.Errorf("eventsub: read welcome: %w", err)
+	}
+	if msg.Metadata.MessageType != messageWelcome || msg.Payload.Session == nil {
+		conn.close()
+		return nil, sessionPayload{}, fmt.Errorf("eventsub: expected %s, got %s", messageWelcome, msg.Metadata.MessageType)
+	}
+
+	return conn, *msg.Payload.Session, nil
+}
+
+// subscribe создаёт подписки всех типов для всех каналов. Ошибка возвращается,
+// только если не удалось создать ни одной подписки.
+func (c *Client) subscribe(ctx context.Context, sessionID string, specs []subscriptionSpec) error {
+	// Без логинов Helix возвращает владельца токена.
+	self, err := c.api.GetUsers(ctx, nil, nil)
+	if err != nil {
+		return fmt.Errorf("eventsub: lookup token owner: %w", err)
+	}
+	if len(self) == 0 {
+		return errors.New("eventsub: token owner not found")
+	}
+
+	broadcasters, err := c.api.GetUsers(ctx, nil, c.channels)
+	if err != nil {
+		return fmt.Errorf("eventsub: lookup channels: %w", err)
+	}
+
+	created := 0
+	for _, broadcaster := range broadcasters {
+		for _, spec := range specs {
+			condition := map[string]string{"broadcaster_user_id": broadcaster.ID}
+			if spec.Moderator {
+				condition["moderator_user_id"] = self[0].ID
+			}
+
+			err := c.createSubscription(ctx, sessionID, spec, condition)
+			switch {
+			case err == nil, errors.Is(err, helix.ErrConflict):
+				created++
+			default:
+				c.logger.Error("подписка не создана", "channel", broadcaster.Login, "type", spec.Type, "err", err)
+			}
+		}
+	}
+
+	if created == 0 {
+		return errors.New("eventsub: no subscriptions created")
+	}
+	c.logger.Info("подписки созданы", "session_id", sessionID, "subscriptions", created)
+	return nil
+}
+
+// read обрабатывает сообщения до session_reconnect (возвращает новый URL) или ошибки.
+func (c *Client) read(ctx context.Context, conn *wsConn, session sessionPayload) (string, error) {
+	keepalive := time.Duration(session.KeepaliveTimeoutSeconds)*time.Second + keepaliveGrace
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(keepalive))
+
+		var msg envelope
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("eventsub: read: %w", err)
+		}
+
+		switch msg.Metadata.MessageType {
+		case messageKeepalive:
+		case messageNotification:
+			event, err := toChannelEvent(msg)
+			if err != nil {
+				c.logger.Error("не удалось разобрать уведомление", "message_id", msg.Metadata.MessageID, "err", err)
+				continue
+			}
+			c.handler.HandleEvent(ctx, event)
+		case messageReconnect:
+			if msg.Payload.Session == nil || msg.Payload.Session.ReconnectURL == "" {
+				return "", errors.New("eventsub: session_reconnect without reconnect_url")
+			}
+			return msg.Payload.Session.ReconnectURL, nil
+		case messageRevocation:
+			if sub := msg.Payload.Subscription; sub != nil {
+				c.logger.Warn("подписка отозвана", "subscription_id", sub.ID, "type", sub.Type, "status", sub.Status)
+			}
+		default:
+			c.logger.Warn("неизвестный тип сообщения", "type", msg.Metadata.MessageType)
+		}
+	}
+}
+
+const (
+	messageWelcome      = "session_welcome"
+	messageKeepalive    = "session_keepalive"
+	messageNotification = "notification"
+	messageReconnect    = "session_reconnect"
+	messageRevocation   = "revocation"
+)
+
+type envelope struct {
+	Metadata struct {
+		MessageID           string    `json:"message_id"`
+		MessageType         string    `json:"message_type"`
+		MessageTimestamp    time.Time `json:"message_timestamp"`
+		SubscriptionType    string    `json:"subscription_type"`
+		SubscriptionVersion string    `json:"subscription_version"`
+	} `json:"metadata"`
+	Payload struct {
+		Session      *sessionPayload      `json:"session"`
+		Subscription *subscriptionPayload `json:"subscription"`
+		Event        json.RawMessage      `json:"event"`
+	} `json:"payload"`
+}
+
+type sessionPayload struct {
+	ID                      string `json:"id"`
+	Status                  string `json:"status"`
+	KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+	ReconnectURL            string `json:"reconnect_url"`
+}
+
+type subscriptionPayload struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Status  string `json:"status"`
+}
+
+// eventCommon — поля, общие для большинства событий канала.
+type eventCommon struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	// shoutout.receive: канал, который сделал shoutout.
+	FromBroadcasterUserID    string `json:"from_broadcaster_user_id"`
+	FromBroadcasterUserLogin string `json:"from_broadcaster_user_login"`
+	// shoutout.create: канал, которому сделали shoutout.
+	ToBroadcasterUserID    string `json:"to_broadcaster_user_id"`
+	ToBroadcasterUserLogin string `json:"to_broadcaster_user_login"`
+}
+
+func toChannelEvent(msg envelope) (model.ChannelEvent, error) {
+	var common eventCommon
+	if len(msg.Payload.Event) > 0 {
+		if err := json.Unmarshal(msg.Payload.Event, &common); err != nil {
+			return model.ChannelEvent{}, err
+		}
+	}
+
+	event := model.ChannelEvent{
+		MessageID:     msg.Metadata.MessageID,
+		Type:          msg.Metadata.SubscriptionType,
+		Version:       msg.Metadata.SubscriptionVersion,
+		BroadcasterID: common.BroadcasterUserID,
+		Channel:       strings.ToLower(common.BroadcasterUserLogin),
+		UserID:        common.UserID,
+		UserLogin:     common.UserLogin,
+		Event:         msg.Payload.Event,
+		OccurredAt:    msg.Metadata.MessageTimestamp.UTC(),
+	}
+
+	if sub := msg.Payload.Subscription; sub != nil {
+		event.SubscriptionID = sub.ID
+		if event.Type == "" {
+			event.Type = sub.Type
+			event.Version = sub.Version
+		}
+	}
+
+	// Для shoutout «пользователь» события — второй канал.
+	switch {
+	case event.UserID == "" && common.FromBroadcasterUserID != "":
+		event.UserID, event.UserLogin = common.FromBroadcasterUserID, common.FromBroadcasterUserLogin
+	case event.UserID == "" && common.ToBroadcasterUserID != "":
+		event.UserID, event.UserLogin = common.ToBroadcasterUserID, common.ToBroadcasterUserLogin
+	}
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	return event, nil
+}
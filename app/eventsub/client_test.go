@@ -0,0 +1,273 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+	"twitch-chat-logger/tokens"
+)
+
+// fakeEventSub — локальный EventSub: WebSocket на /ws и Helix на /helix.
+type fakeEventSub struct {
+	t        *testing.T
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	sessions      int
+	conns         map[string]*websocket.Conn
+	subscriptions []map[string]any
+}
+
+func newFakeEventSub(t *testing.T) *fakeEventSub {
+	t.Helper()
+	f := &fakeEventSub{t: t, conns: map[string]*websocket.Conn{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", f.serveWS)
+	mux.HandleFunc("/helix/users", f.serveUsers)
+	mux.HandleFunc("/helix/eventsub/subscriptions", f.serveSubscriptions)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeEventSub) wsURL() string {
+	return "ws" + strings.TrimPrefix(f.srv.URL, "http") + "/ws"
+}
+
+func (f *fakeEventSub) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.sessions++
+	id := fmt.Sprintf("session-%d", f.sessions)
+	f.conns[id] = conn
+	f.mu.Unlock()
+
+	f.send(id, map[string]any{
+		"metadata": map[string]any{"message_id": "w-" + id, "message_type": "session_welcome", "message_timestamp": time.Now().UTC()},
+		"payload": map[string]any{"session": map[string]any{
+			"id": id, "status": "connected", "keepalive_timeout_seconds": 10,
+		}},
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeEventSub) serveUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer user-token" || r.Header.Get("Client-Id") != "client" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	logins := r.URL.Query()["login"]
+	data := []map[string]string{}
+	if len(logins) == 0 {
+		data = append(data, map[string]string{"id": "900", "login": "bot"})
+	}
+	for i, login := range logins {
+		data = append(data, map[string]string{"id": fmt.Sprint(100 + i), "login": login})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (f *fakeEventSub) serveSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.subscriptions = append(f.subscriptions, body)
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte(`{"data":[{"id":"sub-1","status":"enabled"}]}`))
+}
+
+func (f *fakeEventSub) send(session string, msg any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.conns[session].WriteJSON(msg); err != nil {
+		f.t.Errorf("write: %v", err)
+	}
+}
+
+func (f *fakeEventSub) subscriptionCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscriptions)
+}
+
+func notification(id, subType string, event map[string]any) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{
+			"message_id": id, "message_type": "notification", "message_timestamp": "2024-05-01T12:00:00Z",
+			"subscription_type": subType, "subscription_version": "1",
+		},
+		"payload": map[string]any{
+			"subscription": map[string]any{"id": "sub-" + id, "type": subType, "version": "1", "status": "enabled"},
+			"event":        event,
+		},
+	}
+}
+
+type recordingHandler struct {
+	mu     sync.Mutex
+	events []model.ChannelEvent
+}
+
+func (h *recordingHandler) HandleEvent(_ context.Context, event model.ChannelEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.events)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+func TestClientSubscribesAndDeliversNotifications(t *testing.T) {
+	server := newFakeEventSub(t)
+	handler := &recordingHandler{}
+
+	client := NewClient(config.EventSubConfig{
+		ClientID:     "client",
+		WebSocketURL: server.wsURL(),
+		HelixURL:     server.srv.URL + "/helix",
+		Types:        []string{"channel.follow", "stream.online"},
+	}, []string{"Chan1"}, config.ReconnectConfig{Backoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+		helix.NewClient(helix.Config{ClientID: "client", BaseURL: server.srv.URL + "/helix"}, tokens.StaticToken{Access: "user-token"}), handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+
+	waitFor(t, "subscriptions", func() bool { return server.subscriptionCount() == 2 })
+
+	server.mu.Lock()
+	follow := server.subscriptions[0]
+	server.mu.Unlock()
+	condition := follow["condition"].(map[string]any)
+	transport := follow["transport"].(map[string]any)
+	if follow["type"] != "channel.follow" || condition["broadcaster_user_id"] != "100" || condition["moderator_user_id"] != "900" {
+		t.Fatalf("unexpected follow subscription: %v", follow)
+	}
+	if transport["method"] != "websocket" || transport["session_id"] != "session-1" {
+		t.Fatalf("unexpected transport: %v", transport)
+	}
+
+	server.send("session-1", notification("n1", "channel.follow", map[string]any{
+		"user_id": "42", "user_login": "fan", "broadcaster_user_id": "100", "broadcaster_user_login": "Chan1",
+	}))
+	waitFor(t, "follow notification", func() bool { return handler.count() == 1 })
+
+	handler.mu.Lock()
+	got := handler.events[0]
+	handler.mu.Unlock()
+	if got.Type != "channel.follow" || got.Channel != "chan1" || got.UserLogin != "fan" || got.MessageID != "n1" || got.SubscriptionID != "sub-n1" {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	if !got.OccurredAt.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected occurred_at: %s", got.OccurredAt)
+	}
+
+	// session_reconnect: новое соединение, подписки не пересоздаются.
+	server.send("session-1", map[string]any{
+		"metadata": map[string]any{"message_id": "r1", "message_type": "session_reconnect"},
+		"payload": map[string]any{"session": map[string]any{
+			"id": "session-1", "status": "reconnecting", "reconnect_url": server.wsURL(),
+		}},
+	})
+	waitFor(t, "second session", func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return server.sessions == 2
+	})
+
+	server.send("session-2", map[string]any{
+		"metadata": map[string]any{"message_id": "k1", "message_type": "session_keepalive"},
+		"payload":  map[string]any{},
+	})
+	server.send("session-2", notification("n2", "stream.online", map[string]any{
+		"id": "stream-1", "broadcaster_user_id": "100", "broadcaster_user_login": "chan1", "type": "live",
+	}))
+	waitFor(t, "online notification", func() bool { return handler.count() == 2 })
+
+	if server.subscriptionCount() != 2 {
+		t.Fatalf("subscriptions must survive session_reconnect, got %d", server.subscriptionCount())
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestToChannelEventUsesShoutoutCounterpart(t *testing.T) {
+	var msg envelope
+	raw := notification("n3", "channel.shoutout.receive", map[string]any{
+		"broadcaster_user_id": "100", "broadcaster_user_login": "chan1",
+		"from_broadcaster_user_id": "7", "from_broadcaster_user_login": "friend",
+	})
+	data, _ := json.Marshal(raw)
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	event, err := toChannelEvent(msg)
+	if err != nil {
+		t.Fatalf("toChannelEvent: %v", err)
+	}
+	if event.UserID != "7" || event.UserLogin != "friend" || event.BroadcasterID != "100" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestSelectSubscriptionsRejectsUnknownType(t *testing.T) {
+	if _, err := selectSubscriptions([]string{"channel.unknown"}); err == nil {
+		t.Fatalf("expected error for unknown type")
+	}
+	specs, err := selectSubscriptions(nil)
+	if err != nil || len(specs) != len(SupportedTypes()) {
+		t.Fatalf("expected all supported types, got %d (%v)", len(specs), err)
+	}
+}
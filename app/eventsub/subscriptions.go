@@ -0,0 +1,80 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+
+	"twitch-chat-logger/helix"
+)
+
+// subscriptionSpec описывает тип подписки и поля её условия.
+type subscriptionSpec struct {
+	Type      string
+	Version   string
+	Moderator bool // условие содержит moderator_user_id
+}
+
+// supportedSubscriptions — события, которых нет в IRC.
+var supportedSubscriptions = []subscriptionSpec{
+	{Type: "channel.follow", Version: "2", Moderator: true},
+	{Type: "channel.channel_points_custom_reward_redemption.add", Version: "1"},
+	{Type: "channel.hype_train.begin", Version: "1"},
+	{Type: "channel.hype_train.progress", Version: "1"},
+	{Type: "channel.hype_train.end", Version: "1"},
+	{Type: "channel.poll.begin", Version: "1"},
+	{Type: "channel.poll.progress", Version: "1"},
+	{Type: "channel.poll.end", Version: "1"},
+	{Type: "channel.prediction.begin", Version: "1"},
+	{Type: "channel.prediction.progress", Version: "1"},
+	{Type: "channel.prediction.lock", Version: "1"},
+	{Type: "channel.prediction.end", Version: "1"},
+	{Type: "stream.online", Version: "1"},
+	{Type: "stream.offline", Version: "1"},
+	{Type: "channel.shoutout.create", Version: "1", Moderator: true},
+	{Type: "channel.shoutout.receive", Version: "1", Moderator: true},
+}
+
+// SupportedTypes возвращает типы подписок, которые умеет создавать клиент.
+func SupportedTypes() []string {
+	out := make([]string, 0, len(supportedSubscriptions))
+	for _, spec := range supportedSubscriptions {
+		out = append(out, spec.Type)
+	}
+	return out
+}
+
+func selectSubscriptions(types []string) ([]subscriptionSpec, error) {
+	if len(types) == 0 {
+		return supportedSubscriptions, nil
+	}
+
+	out := make([]subscriptionSpec, 0, len(types))
+	for _, t := range types {
+		found := false
+		for _, spec := range supportedSubscriptions {
+			if spec.Type == t {
+				out = append(out, spec)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("eventsub: unsupported subscription type %q", t)
+		}
+	}
+	return out, nil
+}
+
+// createSubscription создаёт подписку spec для текущей WebSocket-сессии.
+func (c *Client) createSubscription(ctx context.Context, sessionID string, spec subscriptionSpec, condition map[string]string) error {
+	err := c.api.CreateEventSubSubscription(ctx, helix.EventSubSubscription{
+		Type:      spec.Type,
+		Version:   spec.Version,
+		Condition: condition,
+		Transport: helix.EventSubTransport{Method: "websocket", SessionID: sessionID},
+	})
+	if err != nil {
+		return fmt.Errorf("eventsub: subscribe %s: %w", spec.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package helix
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User — пользователь из Helix /users.
+type User struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImageURL string    `json:"profile_image_url"`
+	OfflineImageURL string    `json:"offline_image_url"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Stream — идущая трансляция из Helix /streams.
+type Stream struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	UserLogin    string    `json:"user_login"`
+	UserName     string    `json:"user_name"`
+	GameID       string    `json:"game_id"`
+	GameName     string    `json:"game_name"`
+	Type         string    `json:"type"`
+	Title        string    `json:"title"`
+	Tags         []string  `json:"tags"`
+	ViewerCount  int       `json:"viewer_count"`
+	StartedAt    time.Time `json:"started_at"`
+	Language     string    `json:"language"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	IsMature     bool      `json:"is_mature"`
+}
+
+// StreamsQuery — фильтры Helix /streams; пустые поля не передаются.
+type StreamsQuery struct {
+	UserIDs    []string
+	UserLogins []string
+	GameIDs    []string
+	Language   string
+}
+
+// Channel — настройки канала из Helix /channels.
+type Channel struct {
+	BroadcasterID       string   `json:"broadcaster_id"`
+	BroadcasterLogin    string   `json:"broadcaster_login"`
+	BroadcasterName     string   `json:"broadcaster_name"`
+	BroadcasterLanguage string   `json:"broadcaster_language"`
+	GameID              string   `json:"game_id"`
+	GameName            string   `json:"game_name"`
+	Title               string   `json:"title"`
+	Delay               int      `json:"delay"`
+	Tags                []string `json:"tags"`
+}
+
+// Chatter — зритель в чате из Helix /chat/chatters.
+type Chatter struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+// Emote — эмоут Twitch из Helix /chat/emotes и /chat/emotes/global.
+// Tier, EmoteType и EmoteSetID заполняются только для эмоутов канала.
+type Emote struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Images     EmoteImages `json:"images"`
+	Tier       string      `json:"tier"`
+	EmoteType  string      `json:"emote_type"`
+	EmoteSetID string      `json:"emote_set_id"`
+	Format     []string    `json:"format"`
+	Scale      []string    `json:"scale"`
+	ThemeMode  []string    `json:"theme_mode"`
+}
+
+// EmoteImages — адреса статичного изображения эмоута в трёх размерах.
+type EmoteImages struct {
+	URL1x string `json:"url_1x"`
+	URL2x string `json:"url_2x"`
+	URL4x string `json:"url_4x"`
+}
+
+// BadgeSet — набор версий одного значка из Helix /chat/badges.
+type BadgeSet struct {
+	SetID    string         `json:"set_id"`
+	Versions []BadgeVersion `json:"versions"`
+}
+
+// BadgeVersion — версия значка, например "subscriber/12".
+type BadgeVersion struct {
+	ID          string `json:"id"`
+	ImageURL1x  string `json:"image_url_1x"`
+	ImageURL2x  string `json:"image_url_2x"`
+	ImageURL4x  string `json:"image_url_4x"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ClickAction string `json:"click_action"`
+	ClickURL    string `json:"click_url"`
+}
+
+// EventSubSubscription — запрос на создание подписки EventSub.
+type EventSubSubscription struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+}
+
+// EventSubTransport — куда Twitch доставляет уведомления подписки.
+// Для WebSocket достаточно Method "websocket" и id сессии из приветствия.
+type EventSubTransport struct {
+	Method    string `json:"method"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// GetUsers возвращает пользователей по id и логинам; без аргументов Helix
+// возвращает владельца токена пользователя. Списки длиннее 100 делятся на
+// несколько запросов.
+func (c *Client) GetUsers(ctx context.Context, ids, logins []string) ([]User, error) {
+	if len(ids) == 0 && len(logins) == 0 {
+		return getAll[User](ctx, c, "/users", nil)
+	}
+	return getByIDs[User](ctx, c, "/users", map[string][]string{"id": ids, "login": lower(logins)})
+}
+
+// GetStreams возвращает идущие трансляции по фильтрам, проходя все страницы.
+// Каналы не в эфире в ответ не попадают.
+func (c *Client) GetStreams(ctx context.Context, query StreamsQuery) ([]Stream, error) {
+	params := map[string][]string{
+		"user_id":    query.UserIDs,
+		"user_login": lower(query.UserLogins),
+		"game_id":    query.GameIDs,
+	}
+	if len(query.UserIDs)+len(query.UserLogins)+len(query.GameIDs) > 0 {
+		streams, err := getByIDs[Stream](ctx, c, "/streams", params)
+		if err != nil {
+			return nil, err
+		}
+		return filterStreams(streams, query), nil
+	}
+
+	values := url.Values{"first": {strconv.Itoa(maxIDsPerRequest)}}
+	if query.Language != "" {
+		values.Set("language", query.Language)
+	}
+	return getAll[Stream](ctx, c, "/streams", values)
+}
+
+// GetChannels возвращает настройки каналов: название, категорию, язык и теги.
+func (c *Client) GetChannels(ctx context.Context, broadcasterIDs []string) ([]Channel, error) {
+	return getByIDs[Channel](ctx, c, "/channels", map[string][]string{"broadcaster_id": broadcasterIDs})
+}
+
+// GetChatters возвращает всех зрителей в чате канала. Helix требует токен
+// пользователя moderatorID со скоупом moderator:read:chatters, поэтому клиент
+// для этого вызова создаётся с UserTokenRefresher бота.
+func (c *Client) GetChatters(ctx context.Context, broadcasterID, moderatorID string) ([]Chatter, error) {
+	return getAll[Chatter](ctx, c, "/chat/chatters", url.Values{
+		"broadcaster_id": {broadcasterID},
+		"moderator_id":   {moderatorID},
+		"first":          {"1000"},
+	})
+}
+
+// GetGlobalEmotes возвращает глобальные эмоуты Twitch.
+func (c *Client) GetGlobalEmotes(ctx context.Context) ([]Emote, error) {
+	return getAll[Emote](ctx, c, "/chat/emotes/global", nil)
+}
+
+// GetChannelEmotes возвращает эмоуты канала: подписочные, за биты и фолловерские.
+func (c *Client) GetChannelEmotes(ctx context.Context, broadcasterID string) ([]Emote, error) {
+	return getAll[Emote](ctx, c, "/chat/emotes", url.Values{"broadcaster_id": {broadcasterID}})
+}
+
+// GetGlobalBadges возвращает глобальные значки чата.
+func (c *Client) GetGlobalBadges(ctx context.Context) ([]BadgeSet, error) {
+	return getAll[BadgeSet](ctx, c, "/chat/badges/global", nil)
+}
+
+// GetChannelBadges возвращает значки канала (подписка, биты).
+func (c *Client) GetChannelBadges(ctx context.Context, broadcasterID string) ([]BadgeSet, error) {
+	return getAll[BadgeSet](ctx, c, "/chat/badges", url.Values{"broadcaster_id": {broadcasterID}})
+}
+
+// CreateEventSubSubscription создаёт подписку EventSub. Для транспорта
+// WebSocket нужен токен пользователя; если такая подписка уже есть, Helix
+// отвечает 409, и ошибка сопоставляется с ErrConflict.
+func (c *Client) CreateEventSubSubscription(ctx context.Context, sub EventSubSubscription) error {
+	return c.post(ctx, "/eventsub/subscriptions", sub, nil)
+}
+
+// filterStreams применяет language к ответу, запрошенному по id: при
+// разбиении на пачки этот параметр не передаётся.
+func filterStreams(streams []Stream, query StreamsQuery) []Stream {
+	if query.Language == "" {
+		return streams
+	}
+	filtered := streams[:0]
+	for _, stream := range streams {
+		if stream.Language == query.Language {
+			filtered = append(filtered, stream)
+		}
+	}
+	return filtered
+}
+
+func lower(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		out = append(out, strings.ToLower(strings.TrimSpace(value)))
+	}
+	return out
+}
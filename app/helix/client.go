@@ -0,0 +1,394 @@
+// Package helix — клиент Twitch Helix API поверх управляемого токена приложения.
+package helix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"twitch-chat-logger/tokens"
+)
+
+const (
+	// DefaultBaseURL — базовый адрес Helix API.
+	DefaultBaseURL      = "https://api.twitch.tv/helix"
+	helixRequestTimeout = 10 * time.Second
+
+	defaultMaxRetries = 3
+	retryBaseDelay    = 500 * time.Millisecond
+	retryMaxDelay     = 60 * time.Second
+
+	// maxIDsPerRequest — сколько id или логинов Helix принимает в одном запросе.
+	maxIDsPerRequest = 100
+)
+
+// Ошибки Helix, которые вызывающему коду нужно различать. Сравниваются через
+// errors.Is с *Error.
+var (
+	ErrUnauthorized = errors.New("helix: unauthorized")
+	ErrRateLimited  = errors.New("helix: rate limited")
+	ErrNotFound     = errors.New("helix: not found")
+	ErrConflict     = errors.New("helix: conflict")
+)
+
+// Error — ответ Helix с кодом не 2xx. Message берётся из JSON тела вида
+// {"error":"Unauthorized","status":401,"message":"Invalid OAuth token"}.
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("helix: unexpected status %s: %s", e.Status, e.Body)
+}
+
+// Is сопоставляет ответ Helix с ErrUnauthorized, ErrRateLimited, ErrNotFound
+// и ErrConflict.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// TokenSource выдаёт токен для Helix: AppTokenManager или, для запросов от
+// имени пользователя (например, подписки EventSub), UserTokenRefresher.AccessTokens().
+type TokenSource interface {
+	Get(ctx context.Context) (tokens.Token, error)
+}
+
+// TokenRefresher — TokenSource, который умеет заменить отвергнутый токен.
+// Его реализуют AppTokenManager и UserTokenRefresher.AccessTokens(); на 401
+// клиент обновляет токен и повторяет запрос.
+type TokenRefresher interface {
+	TokenSource
+	ForceRefresh(ctx context.Context, rejected string) (tokens.Token, error)
+}
+
+// Config — параметры клиента Helix. Пустые поля заменяются значениями по умолчанию.
+type Config struct {
+	ClientID string
+	// BaseURL — адрес Helix, например мок-сервер Twitch CLI.
+	BaseURL string
+	// HTTPClient позволяет подставить прокси, транспорт или тестовый сервер.
+	HTTPClient *http.Client
+	// MaxRetries — сколько раз повторять запрос на 5xx и 429; 0 — по умолчанию (3).
+	MaxRetries int
+}
+
+// Client обращается к Helix от имени одного приложения. Клиент следит за
+// заголовками Ratelimit-*: когда запросы в текущем окне кончаются, следующий
+// запрос ждёт Ratelimit-Reset вместо того, чтобы получить 429.
+type Client struct {
+	clientID   string
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	tokens     TokenSource
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewClient создаёт клиент Helix с токенами из source.
+func NewClient(cfg Config, source TokenSource) *Client {
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: helixRequestTimeout}
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	return &Client{
+		clientID:   strings.TrimSpace(cfg.ClientID),
+		baseURL:    baseURL,
+		httpClient: httpClient,
+		maxRetries: maxRetries,
+		tokens:     source,
+		remaining:  -1,
+		now:        time.Now,
+		sleep:      sleep,
+	}
+}
+
+// RateLimit возвращает остаток запросов в текущем окне и момент его сброса
+// по последнему ответу Helix; remaining < 0, пока ответов не было.
+func (c *Client) RateLimit() (remaining int, reset time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remaining, c.reset
+}
+
+// page — страница ответа Helix со списком в data и курсором следующей страницы.
+type page[T any] struct {
+	Data       []T `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+}
+
+// getAll проходит по всем страницам ответа, передавая курсор в after.
+func getAll[T any](ctx context.Context, c *Client, path string, query url.Values) ([]T, error) {
+	query = cloneQuery(query)
+	var all []T
+	for {
+		var resp page[T]
+		if err := c.get(ctx, path, query, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Data...)
+
+		if resp.Pagination.Cursor == "" || len(resp.Data) == 0 {
+			return all, nil
+		}
+		query.Set("after", resp.Pagination.Cursor)
+	}
+}
+
+// getByIDs запрашивает объекты по спискам параметров (id, login и т.п.),
+// разбивая их на запросы не более чем по 100 значений.
+func getByIDs[T any](ctx context.Context, c *Client, path string, params map[string][]string) ([]T, error) {
+	var values []url.Values
+	current := url.Values{}
+	count := 0
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range params[name] {
+			if count == maxIDsPerRequest {
+				values = append(values, current)
+				current, count = url.Values{}, 0
+			}
+			current.Add(name, value)
+			count++
+		}
+	}
+	if count > 0 {
+		values = append(values, current)
+	}
+
+	var all []T
+	for _, query := range values {
+		items, err := getAll[T](ctx, c, path, query)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+// get выполняет GET запрос к Helix и декодирует JSON ответа в out.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// post отправляет body в JSON и декодирует ответ в out; out может быть nil.
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPost, path, nil, body, out)
+}
+
+// do выполняет запрос к Helix с повторами на 5xx и 429, ожиданием окна
+// Ratelimit и однократным обновлением токена на 401.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("helix: encode request: %w", err)
+		}
+	}
+
+	token, err := c.tokens.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("helix: get token: %w", err)
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		if err := c.waitRateLimit(ctx); err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("helix: create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token.Access)
+		req.Header.Set("Client-Id", c.clientID)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("helix: request failed: %w", err)
+		}
+		c.updateRateLimit(resp)
+
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			err := decodeResponse(resp, out)
+			resp.Body.Close()
+			return err
+		}
+
+		apiErr := readError(resp)
+		resp.Body.Close()
+
+		// Токен мог быть отозван раньше срока: обновляем его один раз.
+		if resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			refresher, ok := c.tokens.(TokenRefresher)
+			if !ok {
+				return apiErr
+			}
+			token, err = refresher.ForceRefresh(ctx, token.Access)
+			if err != nil {
+				return fmt.Errorf("helix: refresh token: %w", err)
+			}
+			refreshed = true
+			attempt--
+			continue
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= c.maxRetries {
+			return apiErr
+		}
+		if err := c.sleep(ctx, c.retryDelay(resp, attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// waitRateLimit ждёт сброса окна, если запросы в нём закончились.
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	var wait time.Duration
+	if c.remaining == 0 {
+		wait = min(c.reset.Sub(c.now()), retryMaxDelay)
+	}
+	c.mu.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	return c.sleep(ctx, wait)
+}
+
+func (c *Client) updateRateLimit(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remaining = remaining
+	c.reset = time.Unix(reset, 0)
+}
+
+// retryDelay возвращает паузу перед повтором: для 429 — до момента из
+// заголовка Ratelimit-Reset, иначе экспоненциальную задержку.
+func (c *Client) retryDelay(resp *http.Response, attempt int) time.Duration {
+	if reset, err := strconv.ParseInt(resp.Header.Get("Ratelimit-Reset"), 10, 64); err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		delay := time.Unix(reset, 0).Sub(c.now())
+		if delay < 0 {
+			delay = 0
+		}
+		return min(delay, retryMaxDelay)
+	}
+
+	return min(retryBaseDelay<<attempt, retryMaxDelay)
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("helix: decode response: %w", err)
+	}
+	return nil
+}
+
+func readError(resp *http.Response) *Error {
+	body, _ := io.ReadAll(resp.Body)
+	var payload struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    payload.Message,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := url.Values{}
+	for key, values := range query {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
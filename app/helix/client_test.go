@@ -0,0 +1,353 @@
+package helix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/tokens"
+)
+
+// memoryStore — хранилище токена приложения в памяти.
+type memoryStore struct {
+	mu    sync.Mutex
+	token *tokens.Token
+}
+
+func (s *memoryStore) LoadAppToken() (*tokens.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, os.ErrNotExist
+	}
+	token := *s.token
+	return &token, nil
+}
+
+func (s *memoryStore) SaveAppToken(token tokens.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = &token
+	return nil
+}
+
+// fakeHelix — локальный Helix: проверяет заголовки авторизации и отдаёт
+// ответы из handlers по пути запроса.
+type fakeHelix struct {
+	srv      *httptest.Server
+	token    atomic.Value
+	requests atomic.Int32
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeHelix(t *testing.T, handlers map[string]http.HandlerFunc) *fakeHelix {
+	t.Helper()
+	f := &fakeHelix{handlers: handlers}
+	f.token.Store("app-token")
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests.Add(1)
+		if r.Header.Get("Client-Id") != "client" || r.Header.Get("Authorization") != "Bearer "+f.token.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Unauthorized","status":401,"message":"Invalid OAuth token"}`))
+			return
+		}
+		handler, ok := f.handlers[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// newTestClient создаёт клиент поверх настоящего AppTokenManager, который
+// выдаёт токены из fetched по очереди.
+func newTestClient(f *fakeHelix, fetched ...string) (*Client, *atomic.Int32) {
+	var fetches atomic.Int32
+	manager := tokens.NewAppTokenManager(&memoryStore{}, func(context.Context) (string, time.Duration, error) {
+		n := int(fetches.Add(1))
+		if n > len(fetched) {
+			return "", 0, errors.New("no more tokens")
+		}
+		return fetched[n-1], time.Hour, nil
+	}, tokens.AppTokenManagerConfig{})
+
+	client := NewClient(Config{ClientID: "client", BaseURL: f.srv.URL}, manager)
+	client.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return client, &fetches
+}
+
+func writeJSON(w http.ResponseWriter, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func TestGetUsersSplitsIntoBatches(t *testing.T) {
+	var sizes []int
+	var mu sync.Mutex
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/users": func(w http.ResponseWriter, r *http.Request) {
+			logins := r.URL.Query()["login"]
+			mu.Lock()
+			sizes = append(sizes, len(logins))
+			mu.Unlock()
+			var data []User
+			for _, login := range logins {
+				data = append(data, User{ID: "id-" + login, Login: login})
+			}
+			writeJSON(w, map[string]any{"data": data})
+		},
+	})
+	client, _ := newTestClient(f, "app-token")
+
+	var logins []string
+	for i := 0; i < 150; i++ {
+		logins = append(logins, fmt.Sprintf("User%d", i))
+	}
+	users, err := client.GetUsers(context.Background(), nil, logins)
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != 150 || users[0].Login != "user0" || users[0].ID != "id-user0" {
+		t.Fatalf("unexpected users: %d, %+v", len(users), users[0])
+	}
+	if len(sizes) != 2 || sizes[0] != 100 || sizes[1] != 50 {
+		t.Fatalf("expected batches of 100 and 50, got %v", sizes)
+	}
+}
+
+func TestGetStreamsFollowsCursor(t *testing.T) {
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/streams": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("after") {
+			case "":
+				writeJSON(w, map[string]any{
+					"data":       []Stream{{ID: "1", UserLogin: "first", ViewerCount: 10}},
+					"pagination": map[string]string{"cursor": "page-2"},
+				})
+			case "page-2":
+				writeJSON(w, map[string]any{
+					"data":       []Stream{{ID: "2", UserLogin: "second", ViewerCount: 20}},
+					"pagination": map[string]string{},
+				})
+			default:
+				t.Errorf("unexpected cursor %q", r.URL.Query().Get("after"))
+			}
+		},
+	})
+	client, _ := newTestClient(f, "app-token")
+
+	streams, err := client.GetStreams(context.Background(), StreamsQuery{UserLogins: []string{"first", "second"}})
+	if err != nil {
+		t.Fatalf("GetStreams: %v", err)
+	}
+	if len(streams) != 2 || streams[1].ID != "2" || streams[1].ViewerCount != 20 {
+		t.Fatalf("unexpected streams: %+v", streams)
+	}
+}
+
+func TestClientRefreshesTokenOnUnauthorized(t *testing.T) {
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/channels": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]any{"data": []Channel{{BroadcasterID: r.URL.Query().Get("broadcaster_id"), Title: "title"}}})
+		},
+	})
+	// Helix уже не принимает первый токен, хотя его срок не истёк.
+	f.token.Store("second-token")
+	client, fetches := newTestClient(f, "revoked-token", "second-token", "third-token")
+
+	channels, err := client.GetChannels(context.Background(), []string{"123"})
+	if err != nil {
+		t.Fatalf("GetChannels: %v", err)
+	}
+	if len(channels) != 1 || channels[0].Title != "title" {
+		t.Fatalf("unexpected channels: %+v", channels)
+	}
+	if fetches.Load() != 2 || f.requests.Load() != 2 {
+		t.Fatalf("expected one refresh and one retry, got %d fetches and %d requests", fetches.Load(), f.requests.Load())
+	}
+
+	// Второй 401 подряд не приводит к бесконечным обновлениям.
+	f.token.Store("unknown")
+	if _, err := client.GetChannels(context.Background(), []string{"123"}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+// memoryUserStore — хранилище токена пользователя в памяти.
+type memoryUserStore struct {
+	mu    sync.Mutex
+	token tokens.UserToken
+}
+
+func (s *memoryUserStore) LoadUserToken() (*tokens.UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := s.token
+	return &token, nil
+}
+
+func (s *memoryUserStore) SaveUserToken(token tokens.UserToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+func TestClientRefreshesUserTokenOnUnauthorized(t *testing.T) {
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/users": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]any{"data": []User{{ID: "900", Login: "bot"}}})
+		},
+	})
+	f.token.Store("fresh-user-token")
+
+	var refreshes atomic.Int32
+	store := &memoryUserStore{token: tokens.UserToken{Access: "revoked-user-token", Refresh: "refresh", ExpiresAt: time.Now().Add(4 * time.Hour)}}
+	refresher := tokens.NewUserTokenRefresher(store, func(_ context.Context, refresh string) (tokens.UserToken, error) {
+		refreshes.Add(1)
+		return tokens.UserToken{Access: "fresh-user-token", Refresh: refresh, ExpiresAt: time.Now().Add(4 * time.Hour)}, nil
+	}, time.Minute)
+	client := NewClient(Config{ClientID: "client", BaseURL: f.srv.URL}, refresher.AccessTokens())
+
+	users, err := client.GetUsers(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].Login != "bot" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+	if refreshes.Load() != 1 || f.requests.Load() != 2 || store.token.Access != "fresh-user-token" {
+		t.Fatalf("expected one refresh and one retry, got %d refreshes and %d requests", refreshes.Load(), f.requests.Load())
+	}
+}
+
+func TestClientWaitsForRateLimitReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var calls atomic.Int32
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/chat/emotes/global": func(w http.ResponseWriter, r *http.Request) {
+			n := calls.Add(1)
+			w.Header().Set("Ratelimit-Reset", strconv.FormatInt(now.Add(7*time.Second).Unix(), 10))
+			switch n {
+			case 1:
+				w.Header().Set("Ratelimit-Remaining", "0")
+			case 2:
+				w.Header().Set("Ratelimit-Remaining", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"error":"Too Many Requests","status":429,"message":""}`))
+				return
+			default:
+				w.Header().Set("Ratelimit-Remaining", "799")
+			}
+			writeJSON(w, map[string]any{"data": []Emote{{ID: "25", Name: "Kappa", Images: EmoteImages{URL1x: "https://example.test/25/1.0"}}}})
+		},
+	})
+	client, _ := newTestClient(f, "app-token")
+	client.now = func() time.Time { return now }
+	var sleeps []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+
+	if _, err := client.GetGlobalEmotes(context.Background()); err != nil {
+		t.Fatalf("GetGlobalEmotes: %v", err)
+	}
+	if remaining, reset := client.RateLimit(); remaining != 0 || !reset.Equal(now.Add(7*time.Second)) {
+		t.Fatalf("unexpected rate limit state: %d, %s", remaining, reset)
+	}
+
+	emotes, err := client.GetGlobalEmotes(context.Background())
+	if err != nil || len(emotes) != 1 || emotes[0].Name != "Kappa" {
+		t.Fatalf("GetGlobalEmotes: %+v, %v", emotes, err)
+	}
+	// Перед вторым запросом — ожидание окна, затем повтор после 429 и снова ожидание.
+	if len(sleeps) != 3 || sleeps[0] != 7*time.Second || sleeps[1] != 7*time.Second {
+		t.Fatalf("expected waits until Ratelimit-Reset, got %v", sleeps)
+	}
+	if remaining, _ := client.RateLimit(); remaining != 799 {
+		t.Fatalf("expected remaining from the last response, got %d", remaining)
+	}
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/chat/badges": func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				http.Error(w, `{"status":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, map[string]any{"data": []BadgeSet{{
+				SetID:    "subscriber",
+				Versions: []BadgeVersion{{ID: "12", Title: "1-Year Subscriber", ImageURL1x: "https://example.test/sub12"}},
+			}}})
+		},
+	})
+	client, _ := newTestClient(f, "app-token")
+
+	badges, err := client.GetChannelBadges(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("GetChannelBadges: %v", err)
+	}
+	if len(badges) != 1 || badges[0].SetID != "subscriber" || badges[0].Versions[0].Title != "1-Year Subscriber" {
+		t.Fatalf("unexpected badges: %+v", badges)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls.Load())
+	}
+
+	if _, err := client.GetChannelEmotes(context.Background(), "123"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown endpoint, got %v", err)
+	}
+}
+
+func TestCreateEventSubSubscriptionResendsBodyAndReportsConflict(t *testing.T) {
+	var calls atomic.Int32
+	f := newFakeHelix(t, map[string]http.HandlerFunc{
+		"/eventsub/subscriptions": func(w http.ResponseWriter, r *http.Request) {
+			var sub EventSubSubscription
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected request: %s %q", r.Method, r.Header.Get("Content-Type"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&sub); err != nil || sub.Transport.SessionID != "session-1" {
+				t.Errorf("unexpected body: %+v, %v", sub, err)
+			}
+			switch calls.Add(1) {
+			case 1:
+				http.Error(w, `{"status":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+			case 2:
+				w.WriteHeader(http.StatusAccepted)
+				writeJSON(w, map[string]any{"data": []any{map[string]any{"id": "sub-1"}}})
+			default:
+				http.Error(w, `{"status":409,"message":"subscription already exists"}`, http.StatusConflict)
+			}
+		},
+	})
+	client, _ := newTestClient(f, "app-token")
+
+	sub := EventSubSubscription{
+		Type:      "stream.online",
+		Version:   "1",
+		Condition: map[string]string{"broadcaster_user_id": "100"},
+		Transport: EventSubTransport{Method: "websocket", SessionID: "session-1"},
+	}
+	if err := client.CreateEventSubSubscription(context.Background(), sub); err != nil {
+		t.Fatalf("CreateEventSubSubscription: %v", err)
+	}
+	if err := client.CreateEventSubSubscription(context.Background(), sub); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Package metrics экспортирует метрики логгера в формате Prometheus.
+// Счётчики Twitch клиента и очереди батчера читаются в момент запроса
+// /metrics, результаты флашей и notice-события приходят через наблюдатели
+// storage.FlushObserver и service.NoticeObserver, поэтому сами пакеты
+// storage и twitch от Prometheus и HTTP не зависят.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"twitch-chat-logger/model"
+	"twitch-chat-logger/twitch"
+)
+
+const namespace = "chat_logger"
+
+// ClientStats — источник счётчиков Twitch соединения; его реализует twitch.Client.
+type ClientStats interface {
+	Stats() twitch.ConnectionStats
+}
+
+// QueueStats — источник счётчиков очереди; его реализует storage.Batcher.
+type QueueStats interface {
+	Enqueued() uint64
+	Dropped() uint64
+	QueueDepth() int
+}
+
+// Metrics хранит метрики логгера и отдаёт их через Handler.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	inserted      prometheus.Counter
+	duplicates    prometheus.Counter
+	flushErrors   prometheus.Counter
+	flushDuration prometheus.Histogram
+	batchSize     prometheus.Histogram
+	notices       *prometheus.CounterVec
+
+	mu     sync.Mutex
+	client ClientStats
+	queue  QueueStats
+	tokens map[string]time.Time // вид токена -> время истечения
+	now    func() time.Time
+}
+
+// New создаёт Metrics со своим реестром, включающим метрики Go runtime и процесса.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		inserted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "messages_inserted_total",
+			Help: "Сообщения чата, добавленные в базу.",
+		}),
+		duplicates: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "messages_duplicate_total",
+			Help: "Сообщения чата, уже бывшие в базе (конфликт по message_id).",
+		}),
+		flushErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "flush_errors_total",
+			Help: "Флаши батчера, завершившиеся ошибкой.",
+		}),
+		flushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "flush_duration_seconds",
+			Help:    "Время записи батча в базу.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}),
+		batchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "batch_size",
+			Help:    "Число сообщений в батче.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+		notices: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "notices_total",
+			Help: "Notice-события по каналам и типам (msg-id).",
+		}, []string{"channel", "type"}),
+		tokens: make(map[string]time.Time),
+		now:    time.Now,
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.inserted, m.duplicates, m.flushErrors, m.flushDuration, m.batchSize, m.notices,
+		(*stateCollector)(m),
+	)
+	return m
+}
+
+// Handler отдаёт метрики в формате Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// WatchClient подключает счётчики Twitch соединения.
+func (m *Metrics) WatchClient(client ClientStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.client = client
+}
+
+// WatchQueue подключает счётчики очереди батчера.
+func (m *Metrics) WatchQueue(queue QueueStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = queue
+}
+
+// SetTokenExpiry запоминает время истечения токена вида kind ("app", "user");
+// подходит как колбэк OnRefresh менеджеров токенов.
+func (m *Metrics) SetTokenExpiry(kind string, expiresAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[kind] = expiresAt
+}
+
+// ObserveFlush реализует storage.FlushObserver.
+func (m *Metrics) ObserveFlush(size, inserted int, took time.Duration, err error) {
+	m.batchSize.Observe(float64(size))
+	m.flushDuration.Observe(took.Seconds())
+	if err != nil {
+		m.flushErrors.Inc()
+	}
+	m.inserted.Add(float64(inserted))
+	if err == nil && size > inserted {
+		m.duplicates.Add(float64(size - inserted))
+	}
+}
+
+// ObserveNotice реализует service.NoticeObserver.
+func (m *Metrics) ObserveNotice(notice model.Notice, _ error) {
+	kind := notice.ID
+	if kind == "" {
+		kind = "unknown"
+	}
+	m.notices.WithLabelValues(notice.Channel, kind).Inc()
+}
+
+var (
+	receivedDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "messages_received_total"),
+		"Сообщения чата, полученные из Twitch, по каналам.", []string{"channel"}, nil)
+	enqueuedDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "messages_enqueued_total"),
+		"Сообщения чата, принятые в очередь батчера.", nil, nil)
+	droppedDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "messages_dropped_total"),
+		"Сообщения чата, отброшенные из-за переполнения очереди.", nil, nil)
+	queueDepthDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_depth"),
+		"Сообщения, ожидающие флаша.", nil, nil)
+	sessionsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "irc", "sessions_total"),
+		"Сессии подключения к Twitch IRC.", nil, nil)
+	reconnectsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "irc", "reconnects_total"),
+		"Переподключения к Twitch IRC.", nil, nil)
+	gapsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "irc", "gaps_total"),
+		"Разрывы в логах каналов из-за потери соединения.", nil, nil)
+	rttDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "irc", "rtt_seconds"),
+		"Время ответа на последний PING.", nil, nil)
+	tokenExpiryDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "token", "expiry_seconds"),
+		"Секунд до истечения токена.", []string{"kind"}, nil)
+)
+
+// stateCollector читает счётчики клиента, очереди и токенов в момент запроса.
+type stateCollector Metrics
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		receivedDesc, enqueuedDesc, droppedDesc, queueDepthDesc,
+		sessionsDesc, reconnectsDesc, gapsDesc, rttDesc, tokenExpiryDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	client, queue := c.client, c.queue
+	tokens := make(map[string]time.Time, len(c.tokens))
+	for kind, expiresAt := range c.tokens {
+		tokens[kind] = expiresAt
+	}
+	c.mu.Unlock()
+
+	if client != nil {
+		stats := client.Stats()
+		for channel, count := range stats.Received {
+			ch <- prometheus.MustNewConstMetric(receivedDesc, prometheus.CounterValue, float64(count), channel)
+		}
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.CounterValue, float64(stats.Sessions))
+		ch <- prometheus.MustNewConstMetric(reconnectsDesc, prometheus.CounterValue, float64(stats.Reconnects))
+		ch <- prometheus.MustNewConstMetric(gapsDesc, prometheus.CounterValue, float64(stats.Gaps))
+		ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, stats.Health.RTT.Seconds())
+	}
+	if queue != nil {
+		ch <- prometheus.MustNewConstMetric(enqueuedDesc, prometheus.CounterValue, float64(queue.Enqueued()))
+		ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(queue.Dropped()))
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(queue.QueueDepth()))
+	}
+	now := c.now()
+	for kind, expiresAt := range tokens {
+		ch <- prometheus.MustNewConstMetric(tokenExpiryDesc, prometheus.GaugeValue, expiresAt.Sub(now).Seconds(), kind)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/model"
+	"twitch-chat-logger/twitch"
+)
+
+type fakeClient struct{ stats twitch.ConnectionStats }
+
+func (c fakeClient) Stats() twitch.ConnectionStats { return c.stats }
+
+type fakeQueue struct{}
+
+func (fakeQueue) Enqueued() uint64 { return 7 }
+func (fakeQueue) Dropped() uint64  { return 2 }
+func (fakeQueue) QueueDepth() int  { return 3 }
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsExposeCountersAndHistograms(t *testing.T) {
+	at := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	m := New()
+	m.now = func() time.Time { return at }
+
+	m.WatchClient(fakeClient{stats: twitch.ConnectionStats{
+		Sessions:   3,
+		Reconnects: 2,
+		Received:   map[string]uint64{"chan1": 10, "chan2": 4},
+		Health:     twitch.HealthStats{RTT: 150 * time.Millisecond},
+	}})
+	m.WatchQueue(fakeQueue{})
+	m.SetTokenExpiry("app", at.Add(time.Hour))
+
+	m.ObserveFlush(5, 4, 20*time.Millisecond, nil)
+	m.ObserveFlush(3, 0, time.Second, errors.New("timeout"))
+	m.ObserveNotice(model.Notice{Channel: "chan1", ID: "sub"}, nil)
+	m.ObserveNotice(model.Notice{Channel: "chan1"}, nil)
+
+	body := scrape(t, m)
+	for _, line := range []string{
+		`chat_logger_messages_received_total{channel="chan1"} 10`,
+		`chat_logger_messages_received_total{channel="chan2"} 4`,
+		`chat_logger_messages_enqueued_total 7`,
+		`chat_logger_messages_dropped_total 2`,
+		`chat_logger_queue_depth 3`,
+		`chat_logger_messages_inserted_total 4`,
+		`chat_logger_messages_duplicate_total 1`,
+		`chat_logger_flush_errors_total 1`,
+		`chat_logger_batch_size_count 2`,
+		`chat_logger_batch_size_sum 8`,
+		`chat_logger_flush_duration_seconds_count 2`,
+		`chat_logger_notices_total{channel="chan1",type="sub"} 1`,
+		`chat_logger_notices_total{channel="chan1",type="unknown"} 1`,
+		`chat_logger_irc_sessions_total 3`,
+		`chat_logger_irc_reconnects_total 2`,
+		`chat_logger_irc_rtt_seconds 0.15`,
+		`chat_logger_token_expiry_seconds{kind="app"} 3600`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ChatMessage — нормализованная модель сообщения чата Twitch.
 type ChatMessage struct {
 	ID           string
 	Channel      string
+	RoomID       string // id канала в Twitch, не меняется при переименовании
 	UserID       string
 	Username     string
 	DisplayName  string
@@ -16,13 +20,159 @@ type ChatMessage struct {
 	IsSubscriber bool
 	Bits         int
 	SentAt       time.Time
+	IsSelf       bool              // сообщение отправлено самим ботом
+	StreamID     string            // идущая трансляция канала; пусто, пока канал оффлайн
+	Emotes       []EmoteUsage      // эмоуты Twitch из тега emotes и сторонние эмоуты из текста
+	RawTags      map[string]string // исходные теги IRC; сохраняются, если у канала включён raw_tags
+}
+
+// Источники эмоутов: Twitch и сторонние расширения. Значения хранятся в базе
+// и задаются в конфигурации (catalog.providers).
+const (
+	EmoteProviderTwitch  = "twitch"
+	EmoteProviderSevenTV = "7tv"
+	EmoteProviderBTTV    = "bttv"
+	EmoteProviderFFZ     = "ffz"
+)
+
+// EmoteUsage — эмоут, использованный в сообщении, и сколько раз.
+type EmoteUsage struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
 }
 
 // Notice описывает notice-событие, полученное от Twitch.
 type Notice struct {
 	Channel  string
+	RoomID   string
 	ID       string
 	Message  string
 	Tags     map[string]string
 	NoticeAt time.Time
 }
+
+// Действия зрителя в канале по JOIN/PART (twitch.tv/membership).
+const (
+	MembershipJoin = "join"
+	MembershipPart = "part"
+)
+
+// Membership — вход или выход зрителя из чата канала. Twitch присылает
+// JOIN/PART пачками с задержкой, поэтому SeenAt — время получения.
+type Membership struct {
+	Channel  string
+	RoomID   string
+	Username string
+	Action   string
+	SeenAt   time.Time
+}
+
+// ConnectionSession описывает одну сессию подключения к Twitch IRC.
+// Нулевой DisconnectedAt означает, что сессия ещё активна.
+type ConnectionSession struct {
+	ID             string
+	Server         string
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	Reason         string
+}
+
+// ChatGap отмечает период, когда канал не логировался из-за отсутствия подключения.
+type ChatGap struct {
+	Channel   string
+	SessionID string
+	StartedAt time.Time
+	EndedAt   time.Time
+	Reason    string
+}
+
+// ChannelEvent — уведомление EventSub (follow, награды за баллы, hype train,
+// опросы, прогнозы, онлайн/оффлайн стрима, shoutout). Поле Event хранит
+// исходный JSON события, общие поля вынесены для выборок.
+type ChannelEvent struct {
+	MessageID      string
+	SubscriptionID string
+	Type           string
+	Version        string
+	BroadcasterID  string
+	Channel        string
+	UserID         string
+	UserLogin      string
+	Event          json.RawMessage
+	OccurredAt     time.Time
+}
+
+// Stream — трансляция канала. Нулевой EndedAt означает, что трансляция идёт.
+type Stream struct {
+	ID            string
+	Channel       string
+	BroadcasterID string
+	Title         string
+	GameID        string
+	GameName      string
+	StartedAt     time.Time
+	EndedAt       time.Time
+	PeakViewers   int
+}
+
+// ChannelSnapshot — состояние канала в момент CapturedAt: название, категория,
+// язык и теги, а для идущей трансляции — её id и число зрителей.
+type ChannelSnapshot struct {
+	Channel       string
+	BroadcasterID string
+	Title         string
+	GameID        string
+	GameName      string
+	Language      string
+	Tags          []string
+	IsLive        bool
+	StreamID      string
+	ViewerCount   int
+	CapturedAt    time.Time
+}
+
+// Room связывает логин канала с его неизменным id (room-id из ROOMSTATE).
+type Room struct {
+	ID      string
+	Channel string
+	SeenAt  time.Time
+}
+
+// ChannelSettings — запись реестра каналов: текущий логин и настройки
+// логирования канала.
+type ChannelSettings struct {
+	RoomID            string
+	Login             string
+	Enabled           bool
+	CaptureMembership bool          // сохранять JOIN/PART зрителей
+	Retention         time.Duration // срок хранения сообщений и JOIN/PART; 0 — бессрочно
+	RawTags           bool          // сохранять исходные теги IRC сообщений
+}
+
+// Badge — версия значка чата, например subscriber/12. Scope — "global" или
+// room-id канала для значков канала.
+type Badge struct {
+	Scope       string
+	SetID       string
+	Version     string
+	Title       string
+	Description string
+	ImageURL1x  string
+	ImageURL2x  string
+	ImageURL4x  string
+}
+
+// Emote — эмоут чата. Scope — "global" или room-id канала; Provider —
+// источник эмоута, например "twitch".
+type Emote struct {
+	Scope      string
+	Provider   string
+	ID         string
+	Name       string
+	Type       string
+	ImageURL1x string
+	ImageURL2x string
+	ImageURL4x string
+}
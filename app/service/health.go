@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"twitch-chat-logger/twitch"
+)
+
+// readinessPingTimeout ограничивает проверку базы в /readyz.
+const readinessPingTimeout = 2 * time.Second
+
+// ConnectionState — состояние Twitch соединения; его реализует twitch.Client.
+type ConnectionState interface {
+	Stats() twitch.ConnectionStats
+}
+
+// Pinger проверяет доступность базы; его реализует pgxpool.Pool.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// QueueState — состояние очереди записи; его реализует storage.Batcher.
+type QueueState interface {
+	QueueDepth() int
+	LastFlush() time.Time
+}
+
+// CheckResult — результат одной проверки готовности.
+type CheckResult struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessReport — ответ /readyz.
+type ReadinessReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Readiness проверяет, что логгер действительно пишет чат: IRC подключён,
+// бот вошёл во все каналы, база отвечает, очередь батчера не переполняется,
+// а последний флаш был недавно.
+type Readiness struct {
+	client      ConnectionState
+	db          Pinger
+	queue       QueueState
+	maxQueue    int
+	maxFlushAge time.Duration
+	now         func() time.Time
+}
+
+// NewReadiness создаёт проверку готовности. Очередь считается переполненной
+// с maxQueue сообщений, флаш — давним, если прошло больше maxFlushAge.
+func NewReadiness(client ConnectionState, db Pinger, queue QueueState, maxQueue int, maxFlushAge time.Duration) *Readiness {
+	return &Readiness{
+		client:      client,
+		db:          db,
+		queue:       queue,
+		maxQueue:    maxQueue,
+		maxFlushAge: maxFlushAge,
+		now:         time.Now,
+	}
+}
+
+// Check выполняет все проверки; отчёт содержит каждую, а не только первую неудачную.
+func (r *Readiness) Check(ctx context.Context) ReadinessReport {
+	stats := r.client.Stats()
+	checks := []CheckResult{
+		{Name: "irc", OK: stats.Connected},
+		{Name: "channels", OK: len(stats.NotJoined) == 0},
+		r.checkDB(ctx),
+	}
+	if !stats.Connected {
+		checks[0].Detail = "нет подключения к Twitch IRC"
+	}
+	if len(stats.NotJoined) > 0 {
+		checks[1].Detail = "не подключены: " + strings.Join(stats.NotJoined, ", ")
+	}
+
+	depth := r.queue.QueueDepth()
+	queue := CheckResult{Name: "queue", OK: depth < r.maxQueue, Detail: fmt.Sprintf("%d/%d", depth, r.maxQueue)}
+	age := r.now().Sub(r.queue.LastFlush()).Round(time.Second)
+	flush := CheckResult{Name: "flush", OK: age <= r.maxFlushAge, Detail: fmt.Sprintf("последний флаш %s назад", age)}
+	checks = append(checks, queue, flush)
+
+	report := ReadinessReport{Ready: true, Checks: checks}
+	for _, check := range checks {
+		report.Ready = report.Ready && check.OK
+	}
+	return report
+}
+
+func (r *Readiness) checkDB(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, readinessPingTimeout)
+	defer cancel()
+	if err := r.db.Ping(ctx); err != nil {
+		return CheckResult{Name: "db", Detail: err.Error()}
+	}
+	return CheckResult{Name: "db", OK: true}
+}
+
+// Handler отдаёт отчёт готовности в JSON: 200, если все проверки прошли, иначе 503.
+func (r *Readiness) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Check(req.Context())
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// LivenessHandler отвечает 200, пока процесс жив и обслуживает HTTP.
+func LivenessHandler(started time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status": "ok",
+			"uptime": time.Since(started).Round(time.Second).String(),
+		})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/twitch"
+)
+
+type fakeConnection struct{ stats twitch.ConnectionStats }
+
+func (c fakeConnection) Stats() twitch.ConnectionStats { return c.stats }
+
+type fakePinger struct{ err error }
+
+func (p fakePinger) Ping(context.Context) error { return p.err }
+
+type fakeQueue struct {
+	depth     int
+	lastFlush time.Time
+}
+
+func (q fakeQueue) QueueDepth() int      { return q.depth }
+func (q fakeQueue) LastFlush() time.Time { return q.lastFlush }
+
+func readyz(t *testing.T, readiness *Readiness) (int, ReadinessReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	readiness.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report ReadinessReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestReadinessReportsEveryFailedCheck(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+
+	healthy := NewReadiness(
+		fakeConnection{stats: twitch.ConnectionStats{Connected: true}},
+		fakePinger{},
+		fakeQueue{depth: 10, lastFlush: now.Add(-2 * time.Second)},
+		100, time.Minute,
+	)
+	healthy.now = func() time.Time { return now }
+	if code, report := readyz(t, healthy); code != http.StatusOK || !report.Ready || len(report.Checks) != 5 {
+		t.Fatalf("expected ready, got %d %+v", code, report)
+	}
+
+	stuck := NewReadiness(
+		fakeConnection{stats: twitch.ConnectionStats{Connected: true, NotJoined: []string{"chan2"}}},
+		fakePinger{err: errors.New("connection refused")},
+		fakeQueue{depth: 100, lastFlush: now.Add(-5 * time.Minute)},
+		100, time.Minute,
+	)
+	stuck.now = func() time.Time { return now }
+	code, report := readyz(t, stuck)
+	if code != http.StatusServiceUnavailable || report.Ready {
+		t.Fatalf("expected not ready, got %d %+v", code, report)
+	}
+
+	failed := map[string]string{}
+	for _, check := range report.Checks {
+		if !check.OK {
+			failed[check.Name] = check.Detail
+		}
+	}
+	expected := map[string]string{
+		"channels": "не подключены: chan2",
+		"db":       "connection refused",
+		"queue":    "100/100",
+		"flush":    "последний флаш 5m0s назад",
+	}
+	if len(failed) != len(expected) {
+		t.Fatalf("expected failed checks %v, got %v", expected, failed)
+	}
+	for name, detail := range expected {
+		if failed[name] != detail {
+			t.Fatalf("check %s: expected %q, got %q", name, detail, failed[name])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// httpShutdownTimeout — сколько ждать завершения текущих запросов при остановке.
+const httpShutdownTimeout = 5 * time.Second
+
+// HTTPServer — служебный HTTP сервер (метрики), запускаемый как Runner.
+type HTTPServer struct {
+	server *http.Server
+	logger *slog.Logger
+}
+
+// NewHTTPServer создаёт сервер на addr с обработчиком handler.
+func NewHTTPServer(addr string, handler http.Handler) *HTTPServer {
+	return &HTTPServer{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		logger: slog.Default().With("component", "http"),
+	}
+}
+
+// Run обслуживает запросы до отмены контекста, затем дожидается текущих.
+func (s *HTTPServer) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("HTTP сервер запущен", "addr", s.server.Addr)
+		errCh <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("http: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		s.logger.Error("ошибка остановки HTTP сервера", "err", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http: %w", err)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DefaultRetentionInterval — как часто удаляются строки старше срока хранения.
+const DefaultRetentionInterval = time.Hour
+
+// RetentionStore удаляет строки старше срока хранения канала; его реализует
+// storage.RetentionStore.
+type RetentionStore interface {
+	PurgeExpired(ctx context.Context) (messages, membership int64, err error)
+}
+
+// RetentionPurger раз в interval удаляет сообщения и JOIN/PART каналов, у
+// которых в реестре задан retention. Срок читается из базы при каждой
+// очистке, поэтому изменение retention применяется без перезапуска.
+type RetentionPurger struct {
+	store    RetentionStore
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewRetentionPurger создаёт очистку по сроку хранения.
+func NewRetentionPurger(store RetentionStore, interval time.Duration) *RetentionPurger {
+	return &RetentionPurger{store: store, interval: interval, logger: slog.Default().With("component", "retention")}
+}
+
+// Run очищает устаревшие строки сразу после запуска и затем раз в interval
+// до отмены контекста. Ошибка очистки пишется в лог и повторяется на
+// следующем тике.
+func (p *RetentionPurger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *RetentionPurger) purge(ctx context.Context) {
+	messages, membership, err := p.store.PurgeExpired(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("ошибка очистки по сроку хранения", "messages", messages, "membership", membership, "err", err)
+		}
+		return
+	}
+	if messages > 0 || membership > 0 {
+		p.logger.Info("удалены строки старше срока хранения", "messages", messages, "membership", membership)
+	}
+}
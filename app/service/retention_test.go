@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRetentionStore struct {
+	mu    sync.Mutex
+	calls int
+	errs  []error
+}
+
+func (s *fakeRetentionStore) PurgeExpired(context.Context) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return 0, 0, err
+	}
+	return 3, 1, nil
+}
+
+func (s *fakeRetentionStore) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestRetentionPurgerRetriesAfterError(t *testing.T) {
+	store := &fakeRetentionStore{errs: []error{errors.New("statement timeout")}}
+	purger := NewRetentionPurger(store, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- purger.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for store.callCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected purge to repeat after an error, got %d calls", store.callCount())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
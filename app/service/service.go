@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,19 +14,47 @@ import (
 	"twitch-chat-logger/twitch"
 )
 
+// Runner — фоновый компонент, который Service запускает рядом с Twitch клиентом.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
 // Service управляет жизненным циклом Twitch клиента и записью в хранилище.
 type Service struct {
-	client *twitch.Client
+	client  Runner
+	runners []Runner
+	logger  *slog.Logger
 }
 
-// New создаёт Service с уже собранным Twitch клиентом.
-func New(client *twitch.Client) *Service {
-	return &Service{client: client}
+// New создаёт Service с уже собранным Twitch клиентом и дополнительными компонентами.
+func New(client *twitch.Client, runners ...Runner) *Service {
+	return &Service{client: client, runners: runners, logger: slog.Default().With("component", "service")}
 }
 
-// Run подключает Twitch клиент и блокируется до отмены контекста или ошибки.
+// Run запускает Twitch клиент и все компоненты и блокируется, пока работает
+// клиент. Дополнительные компоненты (EventSub, трансляции, снимки, каталог)
+// вспомогательные: их ошибка пишется в лог и останавливает только их, а
+// запись чата продолжается. Когда клиент завершается, остальные компоненты
+// останавливаются.
 func (s *Service) Run(ctx context.Context) error {
-	return s.client.Run(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, r := range s.runners {
+		wg.Add(1)
+		go func(r Runner) {
+			defer wg.Done()
+			if err := r.Run(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Error("компонент остановлен с ошибкой", "runner", fmt.Sprintf("%T", r), "err", err)
+			}
+		}(r)
+	}
+
+	err := s.client.Run(ctx)
+	cancel()
+	wg.Wait()
+	return err
 }
 
 // Handler реализует twitch.Handler и перенаправляет события в хранилище.
@@ -32,23 +62,126 @@ type Handler struct {
 	batcher      *storage.Batcher
 	pool         *pgxpool.Pool
 	flushTimeout time.Duration
+	channels     map[string]model.ChannelSettings // room-id и логин -> настройки из реестра
+	streams      *StreamTracker
+	emotes       EmoteTokenizer
+	notices      NoticeObserver
+	logger       *slog.Logger
+}
+
+// NoticeObserver учитывает полученные notice-события, например для метрик.
+type NoticeObserver interface {
+	ObserveNotice(notice model.Notice, err error)
+}
+
+// EmoteTokenizer находит в сообщении эмоуты сторонних источников; его
+// реализует catalog.Catalog.
+type EmoteTokenizer interface {
+	Tokenize(msg model.ChatMessage) []model.EmoteUsage
 }
 
-// NewHandler собирает Handler, используемый Twitch колбэками.
-func NewHandler(batcher *storage.Batcher, pool *pgxpool.Pool, flushTimeout time.Duration) *Handler {
-	return &Handler{batcher: batcher, pool: pool, flushTimeout: flushTimeout}
+// NewHandler собирает Handler, используемый Twitch колбэками. channels —
+// реестр каналов на момент запуска: по нему включаются JOIN/PART и исходные
+// теги; каналы вне реестра пишутся без них. streams, emotes и notices могут
+// быть nil, если трансляции не отслеживаются, каталог выключен, а метрики не
+// собираются; nil logger — slog.Default().
+func NewHandler(batcher *storage.Batcher, pool *pgxpool.Pool, flushTimeout time.Duration, channels []model.ChannelSettings, streams *StreamTracker, emotes EmoteTokenizer, notices NoticeObserver, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	settings := make(map[string]model.ChannelSettings, 2*len(channels))
+	for _, channel := range channels {
+		settings[channel.RoomID] = channel
+		settings[channel.Login] = channel
+	}
+	return &Handler{
+		batcher:      batcher,
+		pool:         pool,
+		flushTimeout: flushTimeout,
+		channels:     settings,
+		streams:      streams,
+		emotes:       emotes,
+		notices:      notices,
+		logger:       logger.With("component", "handler"),
+	}
 }
 
-// HandleChat помещает сообщения чата в очередь батчера.
+// HandleChat дополняет сообщение эмоутами сторонних источников и помещает
+// его в очередь батчера. Исходные теги IRC остаются только у каналов с raw_tags.
 func (h *Handler) HandleChat(_ context.Context, msg model.ChatMessage) {
+	if !h.settings(msg.RoomID, msg.Channel).RawTags {
+		msg.RawTags = nil
+	}
+	if h.emotes != nil {
+		msg.Emotes = append(msg.Emotes, h.emotes.Tokenize(msg)...)
+	}
 	if ok := h.batcher.Enqueue(msg); !ok {
-		log.Printf("батчер: сообщение для канала %s отброшено", msg.Channel)
+		h.logger.Warn("сообщение отброшено: очередь батчера заполнена", "channel", msg.Channel, "message_id", msg.ID)
 	}
 }
 
 // HandleNotice сохраняет notice-событие напрямую через пул БД.
 func (h *Handler) HandleNotice(ctx context.Context, notice model.Notice) {
-	if err := storage.SaveNotice(ctx, h.pool, notice, h.flushTimeout); err != nil {
-		log.Printf("ошибка сохранения NOTICE для #%s: %v", notice.Channel, err)
+	err := storage.SaveNotice(ctx, h.pool, notice, h.flushTimeout)
+	if err != nil {
+		h.logger.Error("ошибка сохранения NOTICE", "channel", notice.Channel, "notice_id", notice.ID, "err", err)
+	}
+	if h.notices != nil {
+		h.notices.ObserveNotice(notice, err)
+	}
+}
+
+// HandleMembership сохраняет JOIN/PART зрителя, если у канала включён
+// capture_membership.
+func (h *Handler) HandleMembership(ctx context.Context, membership model.Membership) {
+	if !h.settings(membership.RoomID, membership.Channel).CaptureMembership {
+		return
+	}
+	if err := storage.SaveMembership(ctx, h.pool, membership, h.flushTimeout); err != nil {
+		h.logger.Error("ошибка сохранения JOIN/PART", "channel", membership.Channel, "user", membership.Username, "err", err)
+	}
+}
+
+// HandleEvent сохраняет уведомление EventSub. stream.online и stream.offline
+// дополнительно запускают внеочередной опрос трансляций.
+func (h *Handler) HandleEvent(ctx context.Context, event model.ChannelEvent) {
+	if err := storage.SaveEvent(ctx, h.pool, event, h.flushTimeout); err != nil {
+		h.logger.Error("ошибка сохранения события EventSub", "channel", event.Channel, "type", event.Type, "err", err)
+	}
+	if h.streams != nil && (event.Type == "stream.online" || event.Type == "stream.offline") {
+		h.streams.Refresh()
+	}
+}
+
+// HandleRoom регистрирует канал и его логин в реестре каналов.
+func (h *Handler) HandleRoom(ctx context.Context, room model.Room) {
+	if err := storage.SaveRoom(ctx, h.pool, room, h.flushTimeout); err != nil {
+		h.logger.Error("ошибка сохранения канала", "channel", room.Channel, "room_id", room.ID, "err", err)
+	}
+}
+
+// HandleSession сохраняет открытие или закрытие сессии подключения.
+func (h *Handler) HandleSession(ctx context.Context, session model.ConnectionSession) {
+	if err := storage.SaveSession(ctx, h.pool, session, h.flushTimeout); err != nil {
+		h.logger.Error("ошибка сохранения сессии подключения", "session_id", session.ID, "err", err)
+	}
+}
+
+// HandleGap сохраняет маркер разрыва логирования канала.
+func (h *Handler) HandleGap(ctx context.Context, gap model.ChatGap) {
+	if err := storage.SaveGap(ctx, h.pool, gap, h.flushTimeout); err != nil {
+		h.logger.Error("ошибка сохранения разрыва", "channel", gap.Channel, "err", err)
+	}
+}
+
+// settings возвращает настройки канала из реестра: сначала по room-id, который
+// переживает переименование, затем по логину. Неизвестный канал получает
+// настройки по умолчанию.
+func (h *Handler) settings(roomID, channel string) model.ChannelSettings {
+	if roomID != "" {
+		if settings, ok := h.channels[roomID]; ok {
+			return settings
+		}
 	}
+	return h.channels[channel]
 }
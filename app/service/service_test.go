@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/model"
+)
+
+type failingRunner struct{ err error }
+
+func (r failingRunner) Run(context.Context) error { return r.err }
+
+type blockingRunner struct{ stopped chan struct{} }
+
+func (r blockingRunner) Run(ctx context.Context) error {
+	<-ctx.Done()
+	close(r.stopped)
+	return ctx.Err()
+}
+
+func TestServiceKeepsClientRunningWhenAuxiliaryRunnerFails(t *testing.T) {
+	client := blockingRunner{stopped: make(chan struct{})}
+	s := &Service{
+		client:  client,
+		runners: []Runner{failingRunner{err: errors.New("eventsub: unknown type")}},
+		logger:  slog.Default(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("service stopped after auxiliary runner failed: %v", err)
+	case <-client.stopped:
+		t.Fatalf("client stopped after auxiliary runner failed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestServiceStopsRunnersWhenClientReturns(t *testing.T) {
+	aux := blockingRunner{stopped: make(chan struct{})}
+	clientErr := errors.New("reconnect attempts exhausted")
+	s := &Service{client: failingRunner{err: clientErr}, runners: []Runner{aux}, logger: slog.Default()}
+
+	if err := s.Run(context.Background()); !errors.Is(err, clientErr) {
+		t.Fatalf("expected client error, got %v", err)
+	}
+	select {
+	case <-aux.stopped:
+	default:
+		t.Fatalf("auxiliary runner must be stopped when the client returns")
+	}
+}
+
+func TestHandlerSettingsFollowRoomIDAcrossRenames(t *testing.T) {
+	h := NewHandler(nil, nil, time.Second, []model.ChannelSettings{
+		{RoomID: "1337", Login: "oldname", Enabled: true, RawTags: true},
+		{RoomID: "42", Login: "quiet", Enabled: true},
+	}, nil, nil, nil, nil)
+
+	if !h.settings("1337", "newname").RawTags {
+		t.Fatalf("renamed channel must keep its settings by room-id")
+	}
+	if !h.settings("", "oldname").RawTags {
+		t.Fatalf("channel without room-id must be found by login")
+	}
+	if got := h.settings("", "unknown"); got.RawTags || got.CaptureMembership {
+		t.Fatalf("unknown channel must get default settings, got %+v", got)
+	}
+
+	// capture_membership выключен: JOIN/PART не доходят до базы (пула здесь нет).
+	h.HandleMembership(context.Background(), model.Membership{Channel: "quiet", RoomID: "42", Username: "viewer", Action: model.MembershipJoin})
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+// ChannelDirectory возвращает пользователей, настройки каналов и идущие
+// трансляции; его реализует helix.Client.
+type ChannelDirectory interface {
+	StreamLister
+	GetUsers(ctx context.Context, ids, logins []string) ([]helix.User, error)
+	GetChannels(ctx context.Context, broadcasterIDs []string) ([]helix.Channel, error)
+}
+
+// LiveStreamSource отдаёт ответ последнего опроса /streams; его реализует
+// StreamTracker.
+type LiveStreamSource interface {
+	LiveStreams() (streams []helix.Stream, polledAt time.Time, ok bool)
+}
+
+// SnapshotStore сохраняет снимки каналов; его реализует storage.SnapshotStore.
+type SnapshotStore interface {
+	LastSnapshots(ctx context.Context) ([]model.ChannelSnapshot, error)
+	SaveSnapshots(ctx context.Context, snapshots []model.ChannelSnapshot) error
+}
+
+// ChannelSnapshotter раз в interval запрашивает состояние всех каналов —
+// одним запросом /channels и одним /streams — и пишет снимок канала, если
+// изменились название, категория, язык, теги или статус эфира. Число зрителей
+// само по себе запись не вызывает: во время эфира оно пишется не чаще раза в
+// viewerSample. Если работает StreamTracker, трансляции берутся из его
+// последнего опроса, а свой запрос /streams делается, только когда тот
+// старше interval.
+type ChannelSnapshotter struct {
+	directory    ChannelDirectory
+	live         LiveStreamSource
+	store        SnapshotStore
+	channels     []string
+	interval     time.Duration
+	viewerSample time.Duration
+	now          func() time.Time
+	logger       *slog.Logger
+
+	ids  map[string]string // логин -> id канала
+	last map[string]model.ChannelSnapshot
+}
+
+// NewChannelSnapshotter создаёт снимщик состояния каналов channels. live
+// может быть nil — тогда трансляции запрашиваются при каждом снимке.
+func NewChannelSnapshotter(directory ChannelDirectory, live LiveStreamSource, store SnapshotStore, channels []string, interval, viewerSample time.Duration) *ChannelSnapshotter {
+	normalized := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		normalized = append(normalized, strings.ToLower(channel))
+	}
+	return &ChannelSnapshotter{
+		directory:    directory,
+		live:         live,
+		store:        store,
+		channels:     normalized,
+		interval:     interval,
+		viewerSample: viewerSample,
+		now:          time.Now,
+		logger:       slog.Default().With("component", "snapshots"),
+		ids:          make(map[string]string),
+		last:         make(map[string]model.ChannelSnapshot),
+	}
+}
+
+// Run загружает последние сохранённые снимки, чтобы не повторять их после
+// перезапуска, и снимает состояние каналов до отмены контекста.
+func (s *ChannelSnapshotter) Run(ctx context.Context) error {
+	last, err := s.store.LastSnapshots(ctx)
+	if err != nil {
+		s.logger.Error("не удалось загрузить последние снимки", "err", err)
+	}
+	for _, snapshot := range last {
+		s.last[snapshot.Channel] = snapshot
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.capture(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// capture запрашивает состояние каналов и сохраняет изменившиеся снимки.
+func (s *ChannelSnapshotter) capture(ctx context.Context) {
+	ids, err := s.resolveIDs(ctx)
+	if err != nil {
+		s.logError(ctx, "не удалось получить id каналов", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	channels, err := s.directory.GetChannels(ctx, ids)
+	if err != nil {
+		s.logError(ctx, "не удалось получить настройки каналов", err)
+		return
+	}
+	streams, err := s.liveStreams(ctx, ids)
+	if err != nil {
+		s.logError(ctx, "не удалось получить трансляции", err)
+		return
+	}
+
+	live := make(map[string]helix.Stream, len(streams))
+	for _, stream := range streams {
+		live[stream.UserID] = stream
+	}
+
+	now := s.now()
+	var changed []model.ChannelSnapshot
+	for _, channel := range channels {
+		snapshot := model.ChannelSnapshot{
+			Channel:       strings.ToLower(channel.BroadcasterLogin),
+			BroadcasterID: channel.BroadcasterID,
+			Title:         channel.Title,
+			GameID:        channel.GameID,
+			GameName:      channel.GameName,
+			Language:      channel.BroadcasterLanguage,
+			Tags:          channel.Tags,
+			CapturedAt:    now,
+		}
+		if stream, ok := live[channel.BroadcasterID]; ok {
+			snapshot.IsLive = true
+			snapshot.StreamID = stream.ID
+			snapshot.ViewerCount = stream.ViewerCount
+		}
+
+		if s.shouldWrite(snapshot) {
+			changed = append(changed, snapshot)
+		}
+	}
+
+	if err := s.store.SaveSnapshots(ctx, changed); err != nil {
+		s.logError(ctx, "не удалось сохранить снимки", err)
+		return
+	}
+	for _, snapshot := range changed {
+		s.last[snapshot.Channel] = snapshot
+	}
+}
+
+// liveStreams возвращает идущие трансляции каналов ids: из опроса
+// StreamTracker, если он не старше interval, иначе запросом к Helix.
+func (s *ChannelSnapshotter) liveStreams(ctx context.Context, ids []string) ([]helix.Stream, error) {
+	if s.live != nil {
+		if streams, polledAt, ok := s.live.LiveStreams(); ok && s.now().Sub(polledAt) <= s.interval {
+			return streams, nil
+		}
+	}
+	return s.directory.GetStreams(ctx, helix.StreamsQuery{UserIDs: ids})
+}
+
+// shouldWrite сравнивает снимок с последним записанным.
+func (s *ChannelSnapshotter) shouldWrite(snapshot model.ChannelSnapshot) bool {
+	last, ok := s.last[snapshot.Channel]
+	if !ok {
+		return true
+	}
+	if last.BroadcasterID != snapshot.BroadcasterID || last.Title != snapshot.Title ||
+		last.GameID != snapshot.GameID || last.GameName != snapshot.GameName ||
+		last.Language != snapshot.Language || !slices.Equal(last.Tags, snapshot.Tags) ||
+		last.IsLive != snapshot.IsLive || last.StreamID != snapshot.StreamID {
+		return true
+	}
+	return snapshot.IsLive && snapshot.CapturedAt.Sub(last.CapturedAt) >= s.viewerSample
+}
+
+// resolveIDs возвращает id отслеживаемых каналов, запрашивая у Helix только
+// ещё неизвестные логины.
+func (s *ChannelSnapshotter) resolveIDs(ctx context.Context) ([]string, error) {
+	var missing []string
+	for _, channel := range s.channels {
+		if _, ok := s.ids[channel]; !ok {
+			missing = append(missing, channel)
+		}
+	}
+	if len(missing) > 0 {
+		users, err := s.directory.GetUsers(ctx, nil, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			s.ids[strings.ToLower(user.Login)] = user.ID
+		}
+	}
+
+	ids := make([]string, 0, len(s.channels))
+	for _, channel := range s.channels {
+		if id, ok := s.ids[channel]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *ChannelSnapshotter) logError(ctx context.Context, msg string, err error) {
+	if ctx.Err() == nil {
+		s.logger.Error(msg, "err", err)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+type fakeDirectory struct {
+	fakeLister
+	channels    []helix.Channel
+	userLookups [][]string
+	channelIDs  [][]string
+}
+
+func (d *fakeDirectory) GetUsers(_ context.Context, _, logins []string) ([]helix.User, error) {
+	d.userLookups = append(d.userLookups, logins)
+	var users []helix.User
+	for _, login := range logins {
+		if login != "missing" {
+			users = append(users, helix.User{ID: "id-" + login, Login: login})
+		}
+	}
+	return users, nil
+}
+
+func (d *fakeDirectory) GetChannels(_ context.Context, ids []string) ([]helix.Channel, error) {
+	d.channelIDs = append(d.channelIDs, ids)
+	return d.channels, nil
+}
+
+type memorySnapshots struct {
+	last  []model.ChannelSnapshot
+	saved [][]model.ChannelSnapshot
+}
+
+func (s *memorySnapshots) LastSnapshots(context.Context) ([]model.ChannelSnapshot, error) {
+	return s.last, nil
+}
+
+func (s *memorySnapshots) SaveSnapshots(_ context.Context, snapshots []model.ChannelSnapshot) error {
+	s.saved = append(s.saved, snapshots)
+	return nil
+}
+
+func TestChannelSnapshotterWritesChangesAndSamplesViewers(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	directory := &fakeDirectory{channels: []helix.Channel{
+		{BroadcasterID: "id-first", BroadcasterLogin: "first", Title: "hello", GameName: "Chess", Tags: []string{"ru"}},
+		{BroadcasterID: "id-second", BroadcasterLogin: "second", Title: "offline"},
+	}}
+	directory.streams = []helix.Stream{{ID: "s1", UserID: "id-first", ViewerCount: 10}}
+	store := &memorySnapshots{}
+	snapshotter := NewChannelSnapshotter(directory, nil, store, []string{"First", "second", "missing"}, time.Minute, 5*time.Minute)
+	snapshotter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	snapshotter.capture(ctx)
+	if len(store.saved) != 1 || len(store.saved[0]) != 2 {
+		t.Fatalf("expected initial snapshots of both channels, got %+v", store.saved)
+	}
+	if first := store.saved[0][0]; !first.IsLive || first.StreamID != "s1" || first.ViewerCount != 10 || first.Channel != "first" {
+		t.Fatalf("unexpected live snapshot: %+v", first)
+	}
+	if ids := directory.channelIDs[0]; len(ids) != 2 || ids[0] != "id-first" || ids[1] != "id-second" {
+		t.Fatalf("expected one lookup for all known channels, got %v", ids)
+	}
+
+	// Изменилось только число зрителей — до интервала выборки ничего не пишется.
+	now = now.Add(time.Minute)
+	directory.streams[0].ViewerCount = 50
+	snapshotter.capture(ctx)
+	if len(store.saved[1]) != 0 {
+		t.Fatalf("viewer change alone must not be written, got %+v", store.saved[1])
+	}
+
+	// Смена категории пишется сразу, но только для изменившегося канала.
+	now = now.Add(time.Minute)
+	directory.channels[1].GameName = "Just Chatting"
+	snapshotter.capture(ctx)
+	if len(store.saved[2]) != 1 || store.saved[2][0].Channel != "second" || store.saved[2][0].IsLive {
+		t.Fatalf("expected only the changed channel, got %+v", store.saved[2])
+	}
+
+	now = now.Add(3 * time.Minute)
+	snapshotter.capture(ctx)
+	if len(store.saved[3]) != 1 || store.saved[3][0].Channel != "first" || store.saved[3][0].ViewerCount != 50 {
+		t.Fatalf("expected viewer sample for the live channel, got %+v", store.saved[3])
+	}
+
+	// Известные id повторно не запрашиваются, неизвестный логин — запрашивается.
+	for _, lookup := range directory.userLookups[1:] {
+		if len(lookup) != 1 || lookup[0] != "missing" {
+			t.Fatalf("expected only unresolved logins to be looked up, got %v", directory.userLookups)
+		}
+	}
+}
+
+func TestChannelSnapshotterSkipsSnapshotsSavedBeforeRestart(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	directory := &fakeDirectory{channels: []helix.Channel{{BroadcasterID: "id-first", BroadcasterLogin: "first", Title: "hello"}}}
+	store := &memorySnapshots{last: []model.ChannelSnapshot{
+		{Channel: "first", BroadcasterID: "id-first", Title: "hello", CapturedAt: now.Add(-time.Hour)},
+	}}
+	snapshotter := NewChannelSnapshotter(directory, nil, store, []string{"first"}, time.Minute, 5*time.Minute)
+	snapshotter.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = snapshotter.Run(ctx)
+
+	if len(store.saved) != 1 || len(store.saved[0]) != 0 {
+		t.Fatalf("unchanged offline channel must not be written again, got %+v", store.saved)
+	}
+}
+
+func TestChannelSnapshotterUsesTrackerStreams(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	directory := &fakeDirectory{channels: []helix.Channel{{BroadcasterID: "id-first", BroadcasterLogin: "first", Title: "hello"}}}
+	directory.streams = []helix.Stream{{ID: "s1", UserID: "id-first", UserLogin: "first", ViewerCount: 10}}
+	tracker := NewStreamTracker(&directory.fakeLister, &recordingStore{}, []string{"first"}, time.Minute)
+	tracker.now = func() time.Time { return now }
+	store := &memorySnapshots{}
+	snapshotter := NewChannelSnapshotter(directory, tracker, store, []string{"first"}, time.Minute, 5*time.Minute)
+	snapshotter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// До первого опроса трекера снимщик запрашивает трансляции сам.
+	snapshotter.capture(ctx)
+	if len(directory.queries) != 1 {
+		t.Fatalf("expected own /streams request before the tracker polls, got %d", len(directory.queries))
+	}
+
+	tracker.poll(ctx)
+	directory.streams[0].ViewerCount = 30
+	now = now.Add(5 * time.Minute)
+	tracker.poll(ctx)
+	snapshotter.capture(ctx)
+	if len(directory.queries) != 3 {
+		t.Fatalf("expected no extra /streams request, got %d", len(directory.queries))
+	}
+	if got := store.saved[len(store.saved)-1]; len(got) != 1 || !got[0].IsLive || got[0].ViewerCount != 30 {
+		t.Fatalf("expected snapshot from the tracker poll, got %+v", got)
+	}
+
+	// Опрос трекера устарел — снимщик снова идёт в Helix.
+	now = now.Add(2 * time.Minute)
+	snapshotter.capture(ctx)
+	if len(directory.queries) != 4 {
+		t.Fatalf("expected own /streams request for a stale tracker poll, got %d", len(directory.queries))
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"twitch-chat-logger/twitch"
+)
+
+// StatsLogger периодически пишет в лог состояние Twitch соединения.
+type StatsLogger struct {
+	client *twitch.Client
+	every  time.Duration
+	logger *slog.Logger
+}
+
+// NewStatsLogger создаёт StatsLogger с тем же интервалом, что и статистика батчера.
+func NewStatsLogger(client *twitch.Client, every time.Duration) *StatsLogger {
+	return &StatsLogger{client: client, every: every, logger: slog.Default().With("component", "twitch")}
+}
+
+// Run пишет статистику до отмены контекста.
+func (l *StatsLogger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(l.every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			stats := l.client.Stats()
+			l.logger.Info("статистика соединения",
+				"sessions", stats.Sessions, "reconnects", stats.Reconnects, "gaps", stats.Gaps, "rtt", stats.Health.RTT,
+				"pings_sent", stats.Health.PingsSent, "pongs_received", stats.Health.PongsReceived,
+				"watchdog_resets", stats.Health.WatchdogResets, "silent_channels", stats.Health.SilentChannels,
+			)
+		}
+	}
+}
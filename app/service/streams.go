@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+// StreamLister возвращает идущие трансляции; его реализует helix.Client.
+type StreamLister interface {
+	GetStreams(ctx context.Context, query helix.StreamsQuery) ([]helix.Stream, error)
+}
+
+// StreamStore сохраняет трансляции и периоды оффлайна; его реализует storage.StreamStore.
+type StreamStore interface {
+	OpenStreams(ctx context.Context) ([]model.Stream, error)
+	StartStream(ctx context.Context, stream model.Stream) error
+	UpdateStream(ctx context.Context, stream model.Stream) error
+	EndStream(ctx context.Context, stream model.Stream) error
+	OpenOfflinePeriod(ctx context.Context, channel string, at time.Time) error
+}
+
+// StreamTracker опрашивает Helix /streams и ведёт трансляции каналов: начало,
+// смену названия и категории, пик зрителей и окончание. Реализует
+// storage.StreamResolver, чтобы батчер привязывал сообщения к трансляции.
+type StreamTracker struct {
+	lister   StreamLister
+	store    StreamStore
+	channels []string
+	interval time.Duration
+	refresh  chan struct{}
+	now      func() time.Time
+	logger   *slog.Logger
+
+	// initial — каналы, для которых ещё не записан период оффлайна на старте.
+	// Используется только из poll.
+	initial map[string]bool
+
+	mu       sync.RWMutex
+	current  map[string]model.Stream
+	live     []helix.Stream // ответ последнего удачного опроса
+	polledAt time.Time
+}
+
+// NewStreamTracker создаёт трекер трансляций для каналов channels с опросом раз в interval.
+func NewStreamTracker(lister StreamLister, store StreamStore, channels []string, interval time.Duration) *StreamTracker {
+	normalized := make([]string, 0, len(channels))
+	initial := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		channel = strings.ToLower(channel)
+		normalized = append(normalized, channel)
+		initial[channel] = true
+	}
+	return &StreamTracker{
+		lister:   lister,
+		store:    store,
+		channels: normalized,
+		interval: interval,
+		refresh:  make(chan struct{}, 1),
+		now:      time.Now,
+		logger:   slog.Default().With("component", "streams"),
+		initial:  initial,
+		current:  make(map[string]model.Stream),
+	}
+}
+
+// CurrentStream возвращает id идущей трансляции канала или пустую строку.
+func (t *StreamTracker) CurrentStream(channel string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.current[strings.ToLower(channel)].ID
+}
+
+// LiveStreams возвращает идущие трансляции из последнего удачного опроса и
+// момент опроса; ok ложно, пока опросов не было. По нему ChannelSnapshotter
+// обходится без своего запроса /streams.
+func (t *StreamTracker) LiveStreams() (streams []helix.Stream, polledAt time.Time, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.live, t.polledAt, !t.polledAt.IsZero()
+}
+
+// Refresh просит опросить Helix вне очереди, например после stream.online
+// или stream.offline из EventSub. Вызов не блокируется.
+func (t *StreamTracker) Refresh() {
+	select {
+	case t.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Run восстанавливает трансляции, которые шли до перезапуска, и опрашивает
+// Helix до отмены контекста.
+func (t *StreamTracker) Run(ctx context.Context) error {
+	t.resume(ctx)
+	t.poll(ctx)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-t.refresh:
+		}
+		t.poll(ctx)
+	}
+}
+
+// resume загружает незакрытые трансляции отслеживаемых каналов. Если к
+// первому опросу трансляция уже закончилась, она закрывается моментом опроса.
+func (t *StreamTracker) resume(ctx context.Context) {
+	open, err := t.store.OpenStreams(ctx)
+	if err != nil {
+		t.logger.Error("не удалось загрузить незакрытые трансляции", "err", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, stream := range open {
+		if t.tracks(stream.Channel) {
+			t.current[stream.Channel] = stream
+		}
+	}
+}
+
+// poll сверяет идущие трансляции с известными и сохраняет изменения.
+func (t *StreamTracker) poll(ctx context.Context) {
+	live, err := t.lister.GetStreams(ctx, helix.StreamsQuery{UserLogins: t.channels})
+	if err != nil {
+		if ctx.Err() == nil {
+			t.logger.Error("не удалось получить трансляции", "err", err)
+		}
+		return
+	}
+
+	byChannel := make(map[string]helix.Stream, len(live))
+	for _, stream := range live {
+		byChannel[strings.ToLower(stream.UserLogin)] = stream
+	}
+
+	now := t.now()
+	t.mu.Lock()
+	t.live, t.polledAt = live, now
+	t.mu.Unlock()
+
+	for _, channel := range t.channels {
+		t.mu.RLock()
+		previous, wasLive := t.current[channel]
+		t.mu.RUnlock()
+		stream, isLive := byChannel[channel]
+
+		// Канал оффлайн с самого старта: период открывается моментом первого
+		// опроса, иначе до первой трансляции его не будет вовсе.
+		first := t.initial[channel]
+		delete(t.initial, channel)
+		if first && !wasLive && !isLive {
+			if err := t.store.OpenOfflinePeriod(ctx, channel, now); err != nil {
+				t.logger.Error("не удалось открыть период оффлайна", "channel", channel, "err", err)
+				t.initial[channel] = true
+			}
+			continue
+		}
+
+		// Трансляция закончилась или между опросами сменилась новой.
+		if wasLive && (!isLive || stream.ID != previous.ID) {
+			previous.EndedAt = now
+			if err := t.store.EndStream(ctx, previous); err != nil {
+				t.logger.Error("не удалось закрыть трансляцию", "channel", channel, "stream_id", previous.ID, "err", err)
+			}
+			t.set(channel, nil)
+			t.logger.Info("трансляция закончилась", "channel", channel, "stream_id", previous.ID)
+			wasLive = false
+		}
+		if !isLive {
+			continue
+		}
+
+		next := streamFromHelix(channel, stream)
+		if !wasLive {
+			if err := t.store.StartStream(ctx, next); err != nil {
+				t.logger.Error("не удалось сохранить трансляцию", "channel", channel, "stream_id", next.ID, "err", err)
+				continue
+			}
+			t.set(channel, &next)
+			t.logger.Info("трансляция началась", "channel", channel, "stream_id", next.ID, "title", next.Title)
+			continue
+		}
+
+		next.PeakViewers = max(next.PeakViewers, previous.PeakViewers)
+		if next == previous {
+			continue
+		}
+		if err := t.store.UpdateStream(ctx, next); err != nil {
+			t.logger.Error("не удалось обновить трансляцию", "channel", channel, "stream_id", next.ID, "err", err)
+			continue
+		}
+		t.set(channel, &next)
+	}
+}
+
+func (t *StreamTracker) set(channel string, stream *model.Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stream == nil {
+		delete(t.current, channel)
+		return
+	}
+	t.current[channel] = *stream
+}
+
+func (t *StreamTracker) tracks(channel string) bool {
+	for _, c := range t.channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func streamFromHelix(channel string, stream helix.Stream) model.Stream {
+	return model.Stream{
+		ID:            stream.ID,
+		Channel:       channel,
+		BroadcasterID: stream.UserID,
+		Title:         stream.Title,
+		GameID:        stream.GameID,
+		GameName:      stream.GameName,
+		StartedAt:     stream.StartedAt,
+		PeakViewers:   stream.ViewerCount,
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/helix"
+	"twitch-chat-logger/model"
+)
+
+type fakeLister struct {
+	streams []helix.Stream
+	queries []helix.StreamsQuery
+}
+
+func (l *fakeLister) GetStreams(_ context.Context, query helix.StreamsQuery) ([]helix.Stream, error) {
+	l.queries = append(l.queries, query)
+	return l.streams, nil
+}
+
+// offlinePeriod — период оффлайна, открытый через OpenOfflinePeriod.
+type offlinePeriod struct {
+	channel   string
+	startedAt time.Time
+}
+
+// recordingStore записывает вызовы вида "start:id" и "offline:channel".
+type recordingStore struct {
+	open    []model.Stream
+	calls   []string
+	saved   []model.Stream
+	offline []offlinePeriod
+}
+
+func (s *recordingStore) OpenStreams(context.Context) ([]model.Stream, error) { return s.open, nil }
+
+func (s *recordingStore) StartStream(_ context.Context, stream model.Stream) error {
+	return s.record("start", stream)
+}
+
+func (s *recordingStore) UpdateStream(_ context.Context, stream model.Stream) error {
+	return s.record("update", stream)
+}
+
+func (s *recordingStore) EndStream(_ context.Context, stream model.Stream) error {
+	return s.record("end", stream)
+}
+
+func (s *recordingStore) OpenOfflinePeriod(_ context.Context, channel string, at time.Time) error {
+	s.calls = append(s.calls, "offline:"+channel)
+	s.offline = append(s.offline, offlinePeriod{channel: channel, startedAt: at})
+	return nil
+}
+
+func (s *recordingStore) record(op string, stream model.Stream) error {
+	s.calls = append(s.calls, op+":"+stream.ID)
+	s.saved = append(s.saved, stream)
+	return nil
+}
+
+func (s *recordingStore) last() model.Stream { return s.saved[len(s.saved)-1] }
+
+func TestStreamTrackerFollowsStreamLifecycle(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	started := now.Add(-2 * time.Minute)
+	lister := &fakeLister{}
+	store := &recordingStore{}
+	tracker := NewStreamTracker(lister, store, []string{"Streamer", "quiet"}, time.Minute)
+	tracker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tracker.poll(ctx)
+	if len(store.calls) != 2 || tracker.CurrentStream("streamer") != "" {
+		t.Fatalf("offline channels must only open offline periods, got %v", store.calls)
+	}
+	if got := store.offline[1]; got.channel != "quiet" || !got.startedAt.Equal(now) {
+		t.Fatalf("unexpected initial offline period: %+v", got)
+	}
+	if got := lister.queries[0].UserLogins; len(got) != 2 || got[0] != "streamer" {
+		t.Fatalf("expected lowercased logins, got %v", got)
+	}
+
+	lister.streams = []helix.Stream{{ID: "s1", UserID: "42", UserLogin: "streamer", Title: "hello", GameName: "Chess", ViewerCount: 10, StartedAt: started}}
+	tracker.poll(ctx)
+	if tracker.CurrentStream("Streamer") != "s1" || tracker.CurrentStream("quiet") != "" {
+		t.Fatalf("unexpected current streams: %q, %q", tracker.CurrentStream("streamer"), tracker.CurrentStream("quiet"))
+	}
+	if got := store.last(); got.Channel != "streamer" || !got.StartedAt.Equal(started) || got.PeakViewers != 10 {
+		t.Fatalf("unexpected started stream: %+v", got)
+	}
+
+	// Без изменений запись не повторяется; пик зрителей не уменьшается.
+	tracker.poll(ctx)
+	lister.streams[0].ViewerCount = 5
+	tracker.poll(ctx)
+	lister.streams[0].ViewerCount = 25
+	lister.streams[0].Title = "renamed"
+	tracker.poll(ctx)
+	if got := store.last(); got.PeakViewers != 25 || got.Title != "renamed" {
+		t.Fatalf("unexpected updated stream: %+v", got)
+	}
+
+	now = now.Add(time.Hour)
+	lister.streams = nil
+	tracker.poll(ctx)
+	if got := store.last(); !got.EndedAt.Equal(now) || got.PeakViewers != 25 {
+		t.Fatalf("unexpected ended stream: %+v", got)
+	}
+	if tracker.CurrentStream("streamer") != "" {
+		t.Fatal("ended stream must not be current")
+	}
+
+	expected := []string{"offline:streamer", "offline:quiet", "start:s1", "update:s1", "end:s1"}
+	if len(store.calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, store.calls)
+	}
+	for i := range expected {
+		if store.calls[i] != expected[i] {
+			t.Fatalf("expected calls %v, got %v", expected, store.calls)
+		}
+	}
+}
+
+func TestStreamTrackerResumesOpenStreams(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	lister := &fakeLister{streams: []helix.Stream{{ID: "new", UserLogin: "second", StartedAt: now}}}
+	store := &recordingStore{open: []model.Stream{
+		{ID: "old", Channel: "first", StartedAt: now.Add(-time.Hour)},
+		{ID: "restarted", Channel: "second", StartedAt: now.Add(-time.Hour)},
+		{ID: "untracked", Channel: "other", StartedAt: now.Add(-time.Hour)},
+	}}
+	tracker := NewStreamTracker(lister, store, []string{"first", "second"}, time.Minute)
+	tracker.now = func() time.Time { return now }
+
+	tracker.resume(context.Background())
+	if tracker.CurrentStream("first") != "old" || tracker.CurrentStream("other") != "" {
+		t.Fatalf("unexpected resumed streams: %q, %q", tracker.CurrentStream("first"), tracker.CurrentStream("other"))
+	}
+
+	// Закончившаяся за время простоя трансляция закрывается, сменившаяся — заменяется.
+	tracker.poll(context.Background())
+	expected := []string{"end:old", "end:restarted", "start:new"}
+	if len(store.calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, store.calls)
+	}
+	for i := range expected {
+		if store.calls[i] != expected[i] {
+			t.Fatalf("expected calls %v, got %v", expected, store.calls)
+		}
+	}
+	if tracker.CurrentStream("first") != "" || tracker.CurrentStream("second") != "new" {
+		t.Fatalf("unexpected current streams: %q, %q", tracker.CurrentStream("first"), tracker.CurrentStream("second"))
+	}
+}
@@ -3,7 +3,7 @@ package storage
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sync/atomic"
 	"time"
 
@@ -22,42 +22,85 @@ type BatchConfig struct {
 	FlushTimeout  time.Duration
 }
 
+// StreamResolver сообщает id идущей трансляции канала или пустую строку,
+// если канал оффлайн.
+type StreamResolver interface {
+	CurrentStream(channel string) string
+}
+
+// FlushObserver получает результат каждого флаша: число сообщений в батче,
+// сколько из них вставлено (остальные — дубликаты по message_id), время
+// записи и ошибку. Используется для метрик; storage не зависит от их экспорта.
+type FlushObserver interface {
+	ObserveFlush(size, inserted int, took time.Duration, err error)
+}
+
 // Batcher асинхронно вставляет сообщения чата через pgx.Batch.
 type Batcher struct {
-	input   chan model.ChatMessage
-	config  BatchConfig
-	sender  batchSender
-	dropped atomic.Uint64
+	input    chan model.ChatMessage
+	config   BatchConfig
+	sender   batchSender
+	streams  StreamResolver
+	observer FlushObserver
+	logger   *slog.Logger
+	users    *userDirectory
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	caughtUp atomic.Int64 // unix nano последнего успешного флаша или пустого тика
 }
 
 type batchSender interface {
 	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
-// NewBatcher создаёт батчер и запускает фоновые флаши.
-func NewBatcher(ctx context.Context, pool *pgxpool.Pool, cfg BatchConfig) *Batcher {
-	return newBatcher(ctx, pool, cfg)
+// NewBatcher создаёт батчер и запускает фоновые флаши. Если streams не nil,
+// сообщениям без StreamID проставляется идущая трансляция канала; observer,
+// если не nil, получает результат каждого флаша. nil logger — slog.Default().
+func NewBatcher(ctx context.Context, pool *pgxpool.Pool, cfg BatchConfig, streams StreamResolver, observer FlushObserver, logger *slog.Logger) *Batcher {
+	return newBatcher(ctx, pool, cfg, streams, observer, logger)
 }
 
 // Enqueue пытается добавить сообщение в очередь; при переполнении возвращает false.
 func (b *Batcher) Enqueue(msg model.ChatMessage) bool {
+	if msg.StreamID == "" && b.streams != nil {
+		msg.StreamID = b.streams.CurrentStream(msg.Channel)
+	}
+
 	select {
 	case b.input <- msg:
+		b.enqueued.Add(1)
 		return true
 	default:
 		dropped := b.dropped.Add(1)
 		if dropped%100 == 0 {
-			log.Printf("батчер: очередь заполнена, всего отброшено %d сообщений", dropped)
+			b.logger.Warn("очередь заполнена, сообщения отбрасываются", "dropped_total", dropped)
 		}
 		return false
 	}
 }
 
+// Enqueued возвращает число сообщений, принятых в очередь.
+func (b *Batcher) Enqueued() uint64 {
+	return b.enqueued.Load()
+}
+
 // Dropped возвращает число сообщений, отброшенных из-за переполнения.
 func (b *Batcher) Dropped() uint64 {
 	return b.dropped.Load()
 }
 
+// QueueDepth возвращает число сообщений, ожидающих флаша в очереди.
+func (b *Batcher) QueueDepth() int {
+	return len(b.input)
+}
+
+// LastFlush возвращает время, когда батчер последний раз записал всё
+// накопленное: успешный флаш или тик без новых сообщений. Давнее значение
+// означает, что запись в базу не проходит.
+func (b *Batcher) LastFlush() time.Time {
+	return time.Unix(0, b.caughtUp.Load())
+}
+
 func (b *Batcher) run(ctx context.Context) {
 	flushTicker := time.NewTicker(b.config.FlushEvery)
 	statsTicker := time.NewTicker(b.config.StatsLogEvery)
@@ -66,7 +109,7 @@ func (b *Batcher) run(ctx context.Context) {
 
 	var (
 		batch            = &pgx.Batch{}
-		pending          = 0
+		messages         []model.ChatMessage
 		totalInserted    uint64
 		intervalInserted uint64
 	)
@@ -74,68 +117,159 @@ func (b *Batcher) run(ctx context.Context) {
 	const q = `
 insert into chat_messages (
   message_id, channel, user_id, username, display_name, text, badges, color,
-  is_mod, is_subscriber, bits, sent_at
-) values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+  is_mod, is_subscriber, bits, sent_at, is_self, stream_id, room_id, emotes, raw_tags
+) values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
 on conflict (message_id) do nothing;`
 
 	flush := func() {
-		if pending == 0 {
-			return
-		}
+		if len(messages) > 0 {
+			dbCtx, cancel := context.WithTimeout(context.Background(), b.config.FlushTimeout)
+			started := time.Now()
+			rows, err := b.send(dbCtx, batch)
+			cancel()
+
+			// Батч выполняется одной транзакцией: при ошибке откатываются и
+			// строки, о вставке которых сервер успел сообщить.
+			inserted := 0
+			if err != nil {
+				b.logger.Error("ошибка флаша", "batch_size", len(messages), "err", err)
+			} else {
+				for i, ok := range rows {
+					if !ok {
+						continue
+					}
+					inserted++
+					// Дубликаты и собственные сообщения бота в счётчики пользователей не попадают.
+					if !messages[i].IsSelf {
+						b.users.observe(messages[i])
+					}
+				}
+			}
+			if b.observer != nil {
+				b.observer.ObserveFlush(len(messages), inserted, time.Since(started), err)
+			}
 
-		dbCtx, cancel := context.WithTimeout(context.Background(), b.config.FlushTimeout)
-		defer cancel()
+			totalInserted += uint64(inserted)
+			intervalInserted += uint64(inserted)
 
-		br := b.sender.SendBatch(dbCtx, batch)
-		if err := br.Close(); err != nil {
-			log.Printf("ошибка флаша батчера: %v", err)
+			batch = &pgx.Batch{}
+			messages = messages[:0]
+			if err != nil {
+				return
+			}
 		}
 
-		totalInserted += uint64(pending)
-		intervalInserted += uint64(pending)
-
-		batch = &pgx.Batch{}
-		pending = 0
+		b.caughtUp.Store(time.Now().UnixNano())
+		b.flushUsers()
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			flush()
-			log.Printf("батчер: контекст отменён, всего вставлено строк = %d", totalInserted)
+			b.logger.Info("контекст отменён, батчер остановлен", "inserted_total", totalInserted)
 			return
 		case <-flushTicker.C:
 			flush()
 		case <-statsTicker.C:
-			log.Printf(
-				"батчер: вставлено %d строк за %s (всего %d)",
-				intervalInserted, b.config.StatsLogEvery, totalInserted,
-			)
+			b.logger.Info("статистика вставки",
+				"inserted", intervalInserted, "interval", b.config.StatsLogEvery, "inserted_total", totalInserted)
 			intervalInserted = 0
 		case msg := <-b.input:
 			badgesJSON, _ := json.Marshal(msg.Badges)
 			batch.Queue(q,
 				ptr(msg.ID), ptr(msg.Channel), ptr(msg.UserID), ptr(msg.Username), ptr(msg.DisplayName), ptr(msg.Text), badgesJSON, ptr(msg.Color),
-				boolPtr(msg.IsMod), boolPtr(msg.IsSubscriber), intPtr(msg.Bits), msg.SentAt.UTC(),
+				boolPtr(msg.IsMod), boolPtr(msg.IsSubscriber), intPtr(msg.Bits), msg.SentAt.UTC(), msg.IsSelf, nullString(msg.StreamID), nullString(msg.RoomID),
+				emotesJSON(msg.Emotes), rawTagsJSON(msg.RawTags),
 			)
-			pending++
-			if pending >= b.config.MaxBatch {
+			messages = append(messages, msg)
+			if len(messages) >= b.config.MaxBatch {
 				flush()
 			}
 		}
 	}
 }
 
+// flushUsers записывает пользователей из вставленных сообщений отдельным
+// батчем: ошибка в users или user_name_history не откатывает сообщения, а
+// накопленное повторяется следующим флашем.
+func (b *Batcher) flushUsers() {
+	batch := &pgx.Batch{}
+	b.users.queue(batch)
+	if batch.Len() == 0 {
+		return
+	}
+
+	dbCtx, cancel := context.WithTimeout(context.Background(), b.config.FlushTimeout)
+	defer cancel()
+
+	_, err := b.send(dbCtx, batch)
+	if err != nil {
+		b.logger.Error("ошибка записи пользователей", "users", b.users.size(), "err", err)
+	}
+	b.users.flushed(err == nil)
+}
+
+// send отправляет батч и возвращает для каждого выполненного запроса,
+// добавил ли он строку. Батч выполняется в одной неявной транзакции.
+func (b *Batcher) send(ctx context.Context, batch *pgx.Batch) ([]bool, error) {
+	br := b.sender.SendBatch(ctx, batch)
+	inserted := make([]bool, 0, batch.Len())
+	for i := 0; i < batch.Len(); i++ {
+		tag, err := br.Exec()
+		if err != nil {
+			_ = br.Close()
+			return inserted, err
+		}
+		inserted = append(inserted, tag.RowsAffected() > 0)
+	}
+	return inserted, br.Close()
+}
+
 func ptr[T any](v T) *T    { return &v }
 func boolPtr(b bool) *bool { return &b }
 func intPtr(i int) *int    { return &i }
 
-func newBatcher(ctx context.Context, sender batchSender, cfg BatchConfig) *Batcher {
+// nullString превращает пустую строку в NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// emotesJSON кодирует эмоуты сообщения; сообщение без эмоутов хранит NULL.
+func emotesJSON(emotes []model.EmoteUsage) []byte {
+	if len(emotes) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(emotes)
+	return data
+}
+
+// rawTagsJSON кодирует исходные теги IRC; без тегов хранится NULL.
+func rawTagsJSON(tags map[string]string) []byte {
+	if len(tags) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(tags)
+	return data
+}
+
+func newBatcher(ctx context.Context, sender batchSender, cfg BatchConfig, streams StreamResolver, observer FlushObserver, logger *slog.Logger) *Batcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	b := &Batcher{
-		input:  make(chan model.ChatMessage, cfg.ChanBuffer),
-		config: cfg,
-		sender: sender,
+		input:    make(chan model.ChatMessage, cfg.ChanBuffer),
+		config:   cfg,
+		sender:   sender,
+		streams:  streams,
+		observer: observer,
+		logger:   logger.With("component", "batcher"),
+		users:    newUserDirectory(),
 	}
+	b.caughtUp.Store(time.Now().UnixNano())
 
 	go b.run(ctx)
 
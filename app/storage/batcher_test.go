@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -12,12 +13,19 @@ import (
 	"twitch-chat-logger/model"
 )
 
+// stubSender запоминает батчи; duplicates — message_id, вставка которых
+// не добавляет строку, failing — на вставке которых батч падает.
 type stubSender struct {
-	mu      sync.Mutex
-	batches [][]*pgx.QueuedQuery
+	mu         sync.Mutex
+	batches    [][]*pgx.QueuedQuery
+	duplicates map[string]bool
+	failing    map[string]bool
 }
 
-type stubBatchResults struct{}
+type stubBatchResults struct {
+	tags []pgconn.CommandTag
+	errs []error
+}
 
 func (s *stubSender) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
 	s.mu.Lock()
@@ -25,13 +33,36 @@ func (s *stubSender) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults
 
 	copyQueries := append([]*pgx.QueuedQuery(nil), b.QueuedQueries...)
 	s.batches = append(s.batches, copyQueries)
-	return &stubBatchResults{}
+
+	results := &stubBatchResults{}
+	for _, query := range copyQueries {
+		tag := pgconn.NewCommandTag("INSERT 0 1")
+		var err error
+		if id, ok := query.Arguments[0].(*string); ok && s.duplicates[*id] {
+			tag = pgconn.NewCommandTag("INSERT 0 0")
+		} else if ok && s.failing[*id] {
+			err = errors.New("insert failed")
+		}
+		results.tags = append(results.tags, tag)
+		results.errs = append(results.errs, err)
+	}
+	return results
 }
 
-func (s *stubBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, nil }
-func (s *stubBatchResults) Query() (pgx.Rows, error)         { return nil, nil }
-func (s *stubBatchResults) QueryRow() pgx.Row                { return nil }
-func (s *stubBatchResults) Close() error                     { return nil }
+func (s *stubBatchResults) Exec() (pgconn.CommandTag, error) {
+	if len(s.tags) == 0 {
+		return pgconn.CommandTag{}, nil
+	}
+	tag, err := s.tags[0], s.errs[0]
+	s.tags, s.errs = s.tags[1:], s.errs[1:]
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return tag, nil
+}
+func (s *stubBatchResults) Query() (pgx.Rows, error) { return nil, nil }
+func (s *stubBatchResults) QueryRow() pgx.Row        { return nil }
+func (s *stubBatchResults) Close() error             { return nil }
 
 func TestBatcherFlushesOnMaxBatch(t *testing.T) {
 	sender := &stubSender{}
@@ -44,7 +75,7 @@ func TestBatcherFlushesOnMaxBatch(t *testing.T) {
 		ChanBuffer:    10,
 		StatsLogEvery: time.Hour,
 		FlushTimeout:  time.Second,
-	})
+	}, nil, nil, nil)
 
 	msg := model.ChatMessage{ID: "1", Channel: "ch", UserID: "u", Username: "name", DisplayName: "disp", Text: "hi", SentAt: time.Now()}
 	batcher.Enqueue(msg)
@@ -64,7 +95,7 @@ func TestBatcherFlushesOnTimer(t *testing.T) {
 		ChanBuffer:    10,
 		StatsLogEvery: time.Hour,
 		FlushTimeout:  time.Second,
-	})
+	}, nil, nil, nil)
 
 	msg := model.ChatMessage{ID: "2", Channel: "ch", UserID: "u", Username: "name", DisplayName: "disp", Text: "hello", SentAt: time.Now()}
 	batcher.Enqueue(msg)
@@ -72,6 +103,94 @@ func TestBatcherFlushesOnTimer(t *testing.T) {
 	waitForBatches(t, sender, 1)
 }
 
+type staticStreams map[string]string
+
+func (s staticStreams) CurrentStream(channel string) string { return s[channel] }
+
+func TestBatcherStampsCurrentStream(t *testing.T) {
+	sender := &stubSender{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batcher := newBatcher(ctx, sender, BatchConfig{
+		MaxBatch:      3,
+		FlushEvery:    time.Hour,
+		ChanBuffer:    10,
+		StatsLogEvery: time.Hour,
+		FlushTimeout:  time.Second,
+	}, staticStreams{"live": "stream-1"}, nil, nil)
+
+	batcher.Enqueue(model.ChatMessage{ID: "1", Channel: "live", Text: "hi", SentAt: time.Now()})
+	batcher.Enqueue(model.ChatMessage{ID: "2", Channel: "offline", Text: "hi", SentAt: time.Now()})
+	batcher.Enqueue(model.ChatMessage{ID: "3", Channel: "live", Text: "hi", SentAt: time.Now(), StreamID: "explicit"})
+
+	waitForBatches(t, sender, 1)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	expected := []*string{ptr("stream-1"), nil, ptr("explicit")}
+	for i, query := range sender.batches[0] {
+		got := query.Arguments[13].(*string)
+		if (got == nil) != (expected[i] == nil) || (got != nil && *got != *expected[i]) {
+			t.Fatalf("message %d: unexpected stream_id %v", i+1, got)
+		}
+	}
+}
+
+type flushRecord struct {
+	size, inserted int
+	err            error
+}
+
+type recordingObserver struct {
+	mu      sync.Mutex
+	flushes []flushRecord
+}
+
+func (o *recordingObserver) ObserveFlush(size, inserted int, _ time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.flushes = append(o.flushes, flushRecord{size: size, inserted: inserted, err: err})
+}
+
+func TestBatcherReportsInsertedAndDuplicates(t *testing.T) {
+	sender := &stubSender{duplicates: map[string]bool{"2": true}}
+	observer := &recordingObserver{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batcher := newBatcher(ctx, sender, BatchConfig{
+		MaxBatch:      3,
+		FlushEvery:    time.Hour,
+		ChanBuffer:    10,
+		StatsLogEvery: time.Hour,
+		FlushTimeout:  time.Second,
+	}, nil, observer, nil)
+
+	for _, id := range []string{"1", "2", "3"} {
+		batcher.Enqueue(model.ChatMessage{ID: id, Channel: "ch", UserID: "u", Username: "name", Text: "hi", SentAt: time.Now()})
+	}
+	waitForBatches(t, sender, 1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		observer.mu.Lock()
+		flushes := append([]flushRecord(nil), observer.flushes...)
+		observer.mu.Unlock()
+		if len(flushes) > 0 {
+			if flushes[0] != (flushRecord{size: 3, inserted: 2}) {
+				t.Fatalf("unexpected flush: %+v", flushes[0])
+			}
+			if batcher.Enqueued() != 3 || batcher.Dropped() != 0 || batcher.QueueDepth() != 0 {
+				t.Fatalf("unexpected counters: enqueued %d, dropped %d, depth %d", batcher.Enqueued(), batcher.Dropped(), batcher.QueueDepth())
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("flush was not observed")
+}
+
 func waitForBatches(t *testing.T, sender *stubSender, expected int) {
 	t.Helper()
 	deadline := time.Now().Add(2 * time.Second)
@@ -86,3 +205,72 @@ func waitForBatches(t *testing.T, sender *stubSender, expected int) {
 	}
 	t.Fatalf("expected at least %d batches, got %d", expected, len(sender.batches))
 }
+
+func TestBatcherWritesUsersAfterMessagesInSeparateBatch(t *testing.T) {
+	sender := &stubSender{duplicates: map[string]bool{"2": true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batcher := newBatcher(ctx, sender, BatchConfig{
+		MaxBatch:      3,
+		FlushEvery:    time.Hour,
+		ChanBuffer:    10,
+		StatsLogEvery: time.Hour,
+		FlushTimeout:  time.Second,
+	}, nil, nil, nil)
+
+	batcher.Enqueue(model.ChatMessage{ID: "1", Channel: "ch", UserID: "u", Username: "name", SentAt: time.Now()})
+	batcher.Enqueue(model.ChatMessage{ID: "2", Channel: "ch", UserID: "u", Username: "name", SentAt: time.Now()})
+	batcher.Enqueue(model.ChatMessage{ID: "3", Channel: "ch", UserID: "bot", Username: "bot", SentAt: time.Now(), IsSelf: true})
+	waitForBatches(t, sender, 2)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if len(sender.batches[0]) != 3 {
+		t.Fatalf("message batch must contain only messages, got %d queries", len(sender.batches[0]))
+	}
+	users := &pgx.Batch{QueuedQueries: sender.batches[1]}
+	// Дубликат и собственное сообщение бота не считаются.
+	assertKinds(t, users, "history:name", "user:u:1")
+}
+
+func TestBatcherCountsNothingWhenFlushFails(t *testing.T) {
+	sender := &stubSender{failing: map[string]bool{"3": true}}
+	observer := &recordingObserver{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batcher := newBatcher(ctx, sender, BatchConfig{
+		MaxBatch:      3,
+		FlushEvery:    time.Hour,
+		ChanBuffer:    10,
+		StatsLogEvery: time.Hour,
+		FlushTimeout:  time.Second,
+	}, nil, observer, nil)
+
+	for _, id := range []string{"1", "2", "3"} {
+		batcher.Enqueue(model.ChatMessage{ID: id, Channel: "ch", UserID: "u", Username: "name", SentAt: time.Now()})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		observer.mu.Lock()
+		flushes := append([]flushRecord(nil), observer.flushes...)
+		observer.mu.Unlock()
+		if len(flushes) > 0 {
+			// Первые две вставки откатились вместе с батчем.
+			if flushes[0].size != 3 || flushes[0].inserted != 0 || flushes[0].err == nil {
+				t.Fatalf("unexpected flush: %+v", flushes[0])
+			}
+			sender.mu.Lock()
+			batches := len(sender.batches)
+			sender.mu.Unlock()
+			if batches != 1 {
+				t.Fatalf("users must not be written after a failed flush, got %d batches", batches)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("flush was not observed")
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/catalog"
+	"twitch-chat-logger/model"
+)
+
+// CatalogStore хранит значки и эмоуты в catalog_badges и catalog_emotes, а
+// хэши наборов — в catalog_sets. Реализует catalog.Store.
+type CatalogStore struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+// NewCatalogStore создаёт хранилище каталога поверх пула.
+func NewCatalogStore(pool *pgxpool.Pool, timeout time.Duration) *CatalogStore {
+	return &CatalogStore{pool: pool, timeout: timeout}
+}
+
+// LoadBadges возвращает все значки каталога.
+func (s *CatalogStore) LoadBadges(ctx context.Context) ([]model.Badge, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `
+select scope, set_id, version, title, description, image_url_1x, image_url_2x, image_url_4x
+from catalog_badges;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("load badges: %w", err)
+	}
+	badges, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Badge, error) {
+		var badge model.Badge
+		err := row.Scan(&badge.Scope, &badge.SetID, &badge.Version, &badge.Title, &badge.Description,
+			&badge.ImageURL1x, &badge.ImageURL2x, &badge.ImageURL4x)
+		return badge, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load badges: %w", err)
+	}
+	return badges, nil
+}
+
+// LoadEmotes возвращает все эмоуты каталога.
+func (s *CatalogStore) LoadEmotes(ctx context.Context) ([]model.Emote, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `
+select scope, provider, emote_id, name, type, image_url_1x, image_url_2x, image_url_4x
+from catalog_emotes;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("load emotes: %w", err)
+	}
+	emotes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Emote, error) {
+		var emote model.Emote
+		err := row.Scan(&emote.Scope, &emote.Provider, &emote.ID, &emote.Name, &emote.Type,
+			&emote.ImageURL1x, &emote.ImageURL2x, &emote.ImageURL4x)
+		return emote, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load emotes: %w", err)
+	}
+	return emotes, nil
+}
+
+// LoadHashes возвращает хэши сохранённых наборов по ключам catalog.SetKey.
+func (s *CatalogStore) LoadHashes(ctx context.Context) (map[string]string, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `select kind, provider, scope, hash from catalog_sets;`)
+	if err != nil {
+		return nil, fmt.Errorf("load catalog hashes: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var kind, provider, scope, hash string
+		if err := rows.Scan(&kind, &provider, &scope, &hash); err != nil {
+			return nil, fmt.Errorf("load catalog hashes: %w", err)
+		}
+		hashes[catalog.SetKey(kind, provider, scope)] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load catalog hashes: %w", err)
+	}
+	return hashes, nil
+}
+
+// ReplaceBadges заменяет значки области scope одной транзакцией.
+func (s *CatalogStore) ReplaceBadges(ctx context.Context, scope, hash string, badges []model.Badge) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(dbCtx, s.pool, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		batch.Queue(`delete from catalog_badges where scope = $1;`, scope)
+		for _, badge := range badges {
+			batch.Queue(`
+insert into catalog_badges (
+  scope, set_id, version, title, description, image_url_1x, image_url_2x, image_url_4x
+) values ($1, $2, $3, $4, $5, $6, $7, $8);
+`, scope, badge.SetID, badge.Version, badge.Title, badge.Description, badge.ImageURL1x, badge.ImageURL2x, badge.ImageURL4x)
+		}
+		queueSetHash(batch, catalog.KindBadges, model.EmoteProviderTwitch, scope, hash)
+		return tx.SendBatch(dbCtx, batch).Close()
+	})
+}
+
+// ReplaceEmotes заменяет эмоуты источника provider в области scope одной транзакцией.
+func (s *CatalogStore) ReplaceEmotes(ctx context.Context, provider, scope, hash string, emotes []model.Emote) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(dbCtx, s.pool, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		batch.Queue(`delete from catalog_emotes where provider = $1 and scope = $2;`, provider, scope)
+		for _, emote := range emotes {
+			batch.Queue(`
+insert into catalog_emotes (
+  provider, scope, emote_id, name, type, image_url_1x, image_url_2x, image_url_4x
+) values ($1, $2, $3, $4, $5, $6, $7, $8);
+`, provider, scope, emote.ID, emote.Name, emote.Type, emote.ImageURL1x, emote.ImageURL2x, emote.ImageURL4x)
+		}
+		queueSetHash(batch, catalog.KindEmotes, provider, scope, hash)
+		return tx.SendBatch(dbCtx, batch).Close()
+	})
+}
+
+func queueSetHash(batch *pgx.Batch, kind, provider, scope, hash string) {
+	batch.Queue(`
+insert into catalog_sets (kind, provider, scope, hash, refreshed_at)
+values ($1, $2, $3, $4, now())
+on conflict (kind, provider, scope) do update
+  set hash = excluded.hash, refreshed_at = excluded.refreshed_at;
+`, kind, provider, scope, hash)
+}
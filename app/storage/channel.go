@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+// SaveRoom регистрирует канал в реестре channels по его room-id. Если логин
+// канала изменился, новый логин записывается в channel_login_history.
+func SaveRoom(ctx context.Context, pool *pgxpool.Pool, room model.Room, timeout time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(dbCtx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(dbCtx, `
+insert into channel_login_history (room_id, login, seen_at)
+select $1, $2, $3
+where not exists (select 1 from channels where room_id = $1 and login = $2);
+`, room.ID, room.Channel, room.SeenAt.UTC()); err != nil {
+			return err
+		}
+		_, err := tx.Exec(dbCtx, `
+insert into channels (room_id, login, first_seen, updated_at)
+values ($1, $2, $3, $3)
+on conflict (room_id) do update
+  set login      = excluded.login,
+      updated_at = excluded.updated_at
+  where channels.login <> excluded.login;
+`, room.ID, room.Channel, room.SeenAt.UTC())
+		return err
+	})
+}
+
+// LoadChannels возвращает реестр каналов с их настройками.
+func LoadChannels(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) ([]model.ChannelSettings, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rows, err := pool.Query(dbCtx, `
+select room_id, login, enabled, capture_membership,
+       coalesce(extract(epoch from retention)::bigint, 0), raw_tags
+from channels
+order by login;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("load channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []model.ChannelSettings
+	for rows.Next() {
+		var channel model.ChannelSettings
+		var retentionSeconds int64
+		if err := rows.Scan(&channel.RoomID, &channel.Login, &channel.Enabled, &channel.CaptureMembership,
+			&retentionSeconds, &channel.RawTags); err != nil {
+			return nil, fmt.Errorf("load channels: %w", err)
+		}
+		channel.Retention = time.Duration(retentionSeconds) * time.Second
+		channels = append(channels, channel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load channels: %w", err)
+	}
+	return channels, nil
+}
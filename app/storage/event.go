@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+// SaveEvent сохраняет уведомление EventSub; повторная доставка того же message_id игнорируется.
+func SaveEvent(ctx context.Context, pool *pgxpool.Pool, event model.ChannelEvent, timeout time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	payload := []byte(event.Event)
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	_, err := pool.Exec(dbCtx, `
+insert into eventsub_events (
+  message_id, subscription_id, type, version, broadcaster_user_id, channel,
+  user_id, user_login, event, occurred_at
+) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+on conflict (message_id) do nothing;
+`, event.MessageID, event.SubscriptionID, event.Type, event.Version, event.BroadcasterID, event.Channel,
+		event.UserID, event.UserLogin, payload, event.OccurredAt.UTC())
+
+	return err
+}
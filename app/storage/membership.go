@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+// SaveMembership сохраняет JOIN или PART зрителя с учётом заданного таймаута.
+func SaveMembership(ctx context.Context, pool *pgxpool.Pool, membership model.Membership, timeout time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := pool.Exec(dbCtx, `
+insert into channel_membership (channel, room_id, username, action, seen_at)
+values ($1, $2, $3, $4, $5);
+`, membership.Channel, nullString(membership.RoomID), membership.Username, membership.Action, membership.SeenAt)
+
+	return err
+}
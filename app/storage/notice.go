@@ -19,9 +19,9 @@ func SaveNotice(ctx context.Context, pool *pgxpool.Pool, notice model.Notice, ti
 
 	_, err := pool.Exec(dbCtx, `
 insert into channel_notices (
-  channel, msg_id, message, tags, notice_at
-) values ($1, $2, $3, $4, $5);
-`, notice.Channel, notice.ID, notice.Message, tagsJSON, notice.NoticeAt)
+  channel, room_id, msg_id, message, tags, notice_at
+) values ($1, $2, $3, $4, $5, $6);
+`, notice.Channel, nullString(notice.RoomID), notice.ID, notice.Message, tagsJSON, notice.NoticeAt)
 
 	return err
 }
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// purgeChunk ограничивает число строк, удаляемых одним запросом, чтобы
+// очистка не держала долгие блокировки рядом с вставками батчера.
+const purgeChunk = 10000
+
+// Запросы очистки по сроку хранения channels.retention. Строки без room_id
+// (записанные до реестра) сопоставляются с каналом по логину.
+const (
+	purgeMessagesQuery = `
+delete from chat_messages
+where id in (
+  select m.id
+  from chat_messages m
+  join channels c on c.room_id = m.room_id or (m.room_id is null and c.login = m.channel)
+  where c.retention is not null
+    and coalesce(m.sent_at, m.received_at) < now() - c.retention
+  limit $1
+);`
+
+	purgeMembershipQuery = `
+delete from channel_membership
+where id in (
+  select p.id
+  from channel_membership p
+  join channels c on c.room_id = p.room_id or (p.room_id is null and c.login = p.channel)
+  where c.retention is not null
+    and p.seen_at < now() - c.retention
+  limit $1
+);`
+)
+
+// RetentionStore удаляет сообщения и JOIN/PART старше срока хранения канала.
+type RetentionStore struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+// NewRetentionStore создаёт очистку по сроку хранения поверх пула.
+func NewRetentionStore(pool *pgxpool.Pool, timeout time.Duration) *RetentionStore {
+	return &RetentionStore{pool: pool, timeout: timeout}
+}
+
+// PurgeExpired удаляет устаревшие строки порциями и возвращает, сколько
+// сообщений и JOIN/PART удалено. Каналы без retention не затрагиваются.
+func (s *RetentionStore) PurgeExpired(ctx context.Context) (messages, membership int64, err error) {
+	messages, err = s.purge(ctx, purgeMessagesQuery)
+	if err != nil {
+		return messages, 0, fmt.Errorf("purge chat messages: %w", err)
+	}
+	membership, err = s.purge(ctx, purgeMembershipQuery)
+	if err != nil {
+		return messages, membership, fmt.Errorf("purge channel membership: %w", err)
+	}
+	return messages, membership, nil
+}
+
+func (s *RetentionStore) purge(ctx context.Context, query string) (int64, error) {
+	var total int64
+	for {
+		dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		tag, err := s.pool.Exec(dbCtx, query, purgeChunk)
+		cancel()
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < purgeChunk {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+// SaveSession создаёт или обновляет запись о сессии подключения.
+func SaveSession(ctx context.Context, pool *pgxpool.Pool, session model.ConnectionSession, timeout time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var disconnectedAt *time.Time
+	if !session.DisconnectedAt.IsZero() {
+		disconnectedAt = ptr(session.DisconnectedAt.UTC())
+	}
+
+	_, err := pool.Exec(dbCtx, `
+insert into connection_sessions (
+  session_id, server, connected_at, disconnected_at, reason
+) values ($1, $2, $3, $4, $5)
+on conflict (session_id) do update
+  set disconnected_at = excluded.disconnected_at,
+      reason          = excluded.reason;
+`, session.ID, session.Server, session.ConnectedAt.UTC(), disconnectedAt, session.Reason)
+
+	return err
+}
+
+// SaveGap сохраняет маркер разрыва логирования для канала.
+func SaveGap(ctx context.Context, pool *pgxpool.Pool, gap model.ChatGap, timeout time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := pool.Exec(dbCtx, `
+insert into chat_gaps (
+  channel, session_id, gap_start, gap_end, reason
+) values ($1, $2, $3, $4, $5);
+`, gap.Channel, gap.SessionID, gap.StartedAt.UTC(), gap.EndedAt.UTC(), gap.Reason)
+
+	return err
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+// SnapshotStore хранит временной ряд состояний каналов в channel_snapshots.
+type SnapshotStore struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+// NewSnapshotStore создаёт хранилище снимков каналов поверх пула.
+func NewSnapshotStore(pool *pgxpool.Pool, timeout time.Duration) *SnapshotStore {
+	return &SnapshotStore{pool: pool, timeout: timeout}
+}
+
+// LastSnapshots возвращает последний снимок каждого канала.
+func (s *SnapshotStore) LastSnapshots(ctx context.Context) ([]model.ChannelSnapshot, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `
+select distinct on (channel)
+  channel, broadcaster_id, title, game_id, game_name, language, tags,
+  is_live, coalesce(stream_id, ''), coalesce(viewer_count, 0), captured_at
+from channel_snapshots
+order by channel, captured_at desc;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("load channel snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []model.ChannelSnapshot
+	for rows.Next() {
+		var snapshot model.ChannelSnapshot
+		if err := rows.Scan(&snapshot.Channel, &snapshot.BroadcasterID, &snapshot.Title, &snapshot.GameID,
+			&snapshot.GameName, &snapshot.Language, &snapshot.Tags, &snapshot.IsLive, &snapshot.StreamID,
+			&snapshot.ViewerCount, &snapshot.CapturedAt); err != nil {
+			return nil, fmt.Errorf("load channel snapshots: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load channel snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// SaveSnapshots записывает снимки одним батчем. Для оффлайн канала
+// stream_id и viewer_count остаются NULL.
+func (s *SnapshotStore) SaveSnapshots(ctx context.Context, snapshots []model.ChannelSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, snapshot := range snapshots {
+		tags := snapshot.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		var viewers *int
+		if snapshot.IsLive {
+			viewers = intPtr(snapshot.ViewerCount)
+		}
+		batch.Queue(`
+insert into channel_snapshots (
+  channel, broadcaster_id, title, game_id, game_name, language, tags,
+  is_live, stream_id, viewer_count, captured_at
+) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+`, snapshot.Channel, snapshot.BroadcasterID, snapshot.Title, snapshot.GameID, snapshot.GameName,
+			snapshot.Language, tags, snapshot.IsLive, nullString(snapshot.StreamID), viewers, snapshot.CapturedAt.UTC())
+	}
+
+	return s.pool.SendBatch(dbCtx, batch).Close()
+}
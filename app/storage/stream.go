@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/model"
+)
+
+const upsertStreamQuery = `
+insert into streams (
+  stream_id, channel, broadcaster_id, title, game_id, game_name,
+  started_at, ended_at, peak_viewers
+) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+on conflict (stream_id) do update
+  set title        = excluded.title,
+      game_id      = excluded.game_id,
+      game_name    = excluded.game_name,
+      ended_at     = coalesce(streams.ended_at, excluded.ended_at),
+      peak_viewers = greatest(streams.peak_viewers, excluded.peak_viewers),
+      updated_at   = now();
+`
+
+// StreamStore хранит трансляции в таблице streams и периоды между ними в
+// stream_offline_periods. Записи идемпотентны: если трекеры нескольких реплик
+// заметили один и тот же переход, остаётся первая запись.
+type StreamStore struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+// NewStreamStore создаёт хранилище трансляций поверх пула.
+func NewStreamStore(pool *pgxpool.Pool, timeout time.Duration) *StreamStore {
+	return &StreamStore{pool: pool, timeout: timeout}
+}
+
+// OpenStreams возвращает трансляции без ended_at — те, что шли при остановке
+// процесса.
+func (s *StreamStore) OpenStreams(ctx context.Context) ([]model.Stream, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `
+select stream_id, channel, broadcaster_id, title, game_id, game_name, started_at, peak_viewers
+from streams
+where ended_at is null;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("load open streams: %w", err)
+	}
+	defer rows.Close()
+
+	var streams []model.Stream
+	for rows.Next() {
+		var stream model.Stream
+		if err := rows.Scan(&stream.ID, &stream.Channel, &stream.BroadcasterID, &stream.Title,
+			&stream.GameID, &stream.GameName, &stream.StartedAt, &stream.PeakViewers); err != nil {
+			return nil, fmt.Errorf("load open streams: %w", err)
+		}
+		streams = append(streams, stream)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load open streams: %w", err)
+	}
+	return streams, nil
+}
+
+// StartStream сохраняет начавшуюся трансляцию, закрывает период оффлайна
+// канала и привязывает к трансляции сообщения, записанные с её начала до
+// того, как она была замечена.
+func (s *StreamStore) StartStream(ctx context.Context, stream model.Stream) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(dbCtx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(dbCtx, upsertStreamQuery, streamArgs(stream)...); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(dbCtx, `
+update stream_offline_periods
+set ended_at = $2, next_stream_id = $3
+where channel = $1 and ended_at is null;
+`, stream.Channel, stream.StartedAt.UTC(), stream.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(dbCtx, `
+update chat_messages
+set stream_id = $3
+where channel = $1 and sent_at >= $2 and stream_id is null;
+`, stream.Channel, stream.StartedAt.UTC(), stream.ID)
+		return err
+	})
+}
+
+// UpdateStream обновляет название, категорию и пиковое число зрителей идущей трансляции.
+func (s *StreamStore) UpdateStream(ctx context.Context, stream model.Stream) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(dbCtx, upsertStreamQuery, streamArgs(stream)...)
+	return err
+}
+
+// EndStream закрывает трансляцию моментом stream.EndedAt и открывает с него
+// период оффлайна канала.
+func (s *StreamStore) EndStream(ctx context.Context, stream model.Stream) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(dbCtx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(dbCtx, upsertStreamQuery, streamArgs(stream)...); err != nil {
+			return err
+		}
+		_, err := tx.Exec(dbCtx, `
+insert into stream_offline_periods (channel, started_at, previous_stream_id)
+values ($1, $2, $3)
+on conflict do nothing;
+`, stream.Channel, stream.EndedAt.UTC(), stream.ID)
+		return err
+	})
+}
+
+// OpenOfflinePeriod открывает период оффлайна канала, который не в эфире с
+// запуска. Если открытый период уже есть, например с прошлого запуска, он
+// сохраняется.
+func (s *StreamStore) OpenOfflinePeriod(ctx context.Context, channel string, at time.Time) error {
+	dbCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(dbCtx, `
+insert into stream_offline_periods (channel, started_at)
+values ($1, $2)
+on conflict do nothing;
+`, channel, at.UTC())
+	return err
+}
+
+func streamArgs(stream model.Stream) []any {
+	var endedAt *time.Time
+	if !stream.EndedAt.IsZero() {
+		endedAt = ptr(stream.EndedAt.UTC())
+	}
+	return []any{
+		stream.ID, stream.Channel, stream.BroadcasterID, stream.Title, stream.GameID, stream.GameName,
+		stream.StartedAt.UTC(), endedAt, stream.PeakViewers,
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"twitch-chat-logger/tokens"
+)
+
+// TokenStore хранит токены в таблице twitch_tokens, общей для всех реплик.
+// Реализует tokens.CredentialStore и tokens.CredentialLocker: обновление
+// токена сериализуется advisory lock-ом на его ключ, поэтому токен обновляет
+// один процесс, а остальные читают уже сохранённый.
+type TokenStore struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+// NewTokenStore создаёт хранилище токенов поверх пула.
+func NewTokenStore(pool *pgxpool.Pool, timeout time.Duration) *TokenStore {
+	return &TokenStore{pool: pool, timeout: timeout}
+}
+
+// LoadCredential загружает токен по ключу; если его нет, ошибка оборачивает os.ErrNotExist.
+func (s *TokenStore) LoadCredential(key tokens.Key) (*tokens.Credential, error) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	credential := tokens.Credential{Key: key}
+	err := s.pool.QueryRow(dbCtx, `
+select access_token, refresh_token, scopes, expires_at
+from twitch_tokens
+where name = $1;
+`, key.String()).Scan(&credential.Access, &credential.Refresh, &credential.Scopes, &credential.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("load token %s: %w", key, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load token %s: %w", key, err)
+	}
+
+	return &credential, nil
+}
+
+// SaveCredential сохраняет токен, заменяя токен с тем же ключом.
+func (s *TokenStore) SaveCredential(credential tokens.Credential) error {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	scopes := credential.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key := credential.Key
+	_, err := s.pool.Exec(dbCtx, `
+insert into twitch_tokens (
+  name, client_id, kind, login, access_token, refresh_token, scopes, expires_at, updated_at
+) values ($1, $2, $3, $4, $5, $6, $7, $8, now())
+on conflict (name) do update
+  set access_token  = excluded.access_token,
+      refresh_token = excluded.refresh_token,
+      scopes        = excluded.scopes,
+      expires_at    = excluded.expires_at,
+      updated_at    = now();
+`, key.String(), key.ClientID, key.Kind, key.Login, credential.Access, credential.Refresh, scopes, credential.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("save token %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteCredential удаляет токен по ключу; отсутствие токена — не ошибка.
+func (s *TokenStore) DeleteCredential(key tokens.Key) error {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(dbCtx, `delete from twitch_tokens where name = $1;`, key.String()); err != nil {
+		return fmt.Errorf("delete token %s: %w", key, err)
+	}
+	return nil
+}
+
+// ListCredentials возвращает все сохранённые токены.
+func (s *TokenStore) ListCredentials() ([]tokens.Credential, error) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(dbCtx, `
+select client_id, kind, login, access_token, refresh_token, scopes, expires_at
+from twitch_tokens
+order by name;
+`)
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []tokens.Credential
+	for rows.Next() {
+		var credential tokens.Credential
+		if err := rows.Scan(
+			&credential.Key.ClientID, &credential.Key.Kind, &credential.Key.Login,
+			&credential.Access, &credential.Refresh, &credential.Scopes, &credential.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("list tokens: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	return credentials, nil
+}
+
+// LockCredential берёт advisory lock на токен с ключом key и держит его на
+// отдельном соединении до вызова unlock. Ожидание прерывается отменой ctx.
+func (s *TokenStore) LockCredential(ctx context.Context, key tokens.Key) (func(), error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock token: acquire connection: %w", err)
+	}
+
+	lockKey := "twitch_tokens:" + key.String()
+	if _, err := conn.Exec(ctx, `select pg_advisory_lock(hashtext($1))`, lockKey); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("lock token: %w", err)
+	}
+
+	return func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, `select pg_advisory_unlock(hashtext($1))`, lockKey); err != nil {
+			// Соединение с неснятой блокировкой нельзя возвращать в пул.
+			_ = conn.Conn().Close(unlockCtx)
+		}
+		conn.Release()
+	}, nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"twitch-chat-logger/model"
+)
+
+// maxCachedUsers ограничивает кэш известных имён; при переполнении кэш
+// очищается, и имена пользователей один раз перепроверяются в базе.
+const maxCachedUsers = 100_000
+
+const (
+	// Имя пишется в историю, только если отличается от последнего записанного.
+	insertUserNameQuery = `
+insert into user_name_history (user_id, login, display_name, color, seen_at)
+select $1, $2, $3, $4, $5
+where not exists (
+  select 1
+  from (
+    select login, display_name, color
+    from user_name_history
+    where user_id = $1
+    order by seen_at desc, id desc
+    limit 1
+  ) last
+  where last.login = $2 and last.display_name = $3 and last.color = $4
+);`
+
+	upsertUserQuery = `
+insert into users (user_id, login, display_name, color, first_seen, last_seen, message_count)
+values ($1, $2, $3, $4, $5, $6, $7)
+on conflict (user_id) do update
+  set login         = excluded.login,
+      display_name  = excluded.display_name,
+      color         = excluded.color,
+      first_seen    = least(users.first_seen, excluded.first_seen),
+      last_seen     = greatest(users.last_seen, excluded.last_seen),
+      message_count = users.message_count + excluded.message_count;`
+)
+
+// userIdentity — имя, отображаемое имя и цвет ника, история которых ведётся.
+type userIdentity struct {
+	login       string
+	displayName string
+	color       string
+}
+
+type userChange struct {
+	identity userIdentity
+	at       time.Time
+}
+
+// pendingUser накапливает сообщения пользователя до флаша.
+type pendingUser struct {
+	identity  userIdentity
+	firstSeen time.Time
+	lastSeen  time.Time
+	messages  int
+	changes   []userChange
+}
+
+// userDirectory ведёт таблицы users и user_name_history по вставленным
+// сообщениям. Изменения пишутся отдельным батчем после сообщений: одна строка
+// users на пользователя за флаш, а проверка истории имён — только если имя
+// отличается от известного по кэшу.
+type userDirectory struct {
+	known   map[string]userIdentity
+	pending map[string]*pendingUser
+}
+
+func newUserDirectory() *userDirectory {
+	return &userDirectory{
+		known:   make(map[string]userIdentity),
+		pending: make(map[string]*pendingUser),
+	}
+}
+
+// observe учитывает вставленное сообщение пользователя.
+func (d *userDirectory) observe(msg model.ChatMessage) {
+	if msg.UserID == "" {
+		return
+	}
+
+	at := msg.SentAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	identity := userIdentity{login: msg.Username, displayName: msg.DisplayName, color: msg.Color}
+
+	user, ok := d.pending[msg.UserID]
+	if !ok {
+		user = &pendingUser{firstSeen: at, lastSeen: at}
+		d.pending[msg.UserID] = user
+		if known, ok := d.known[msg.UserID]; !ok || known != identity {
+			user.changes = append(user.changes, userChange{identity: identity, at: at})
+		}
+	} else if user.identity != identity {
+		user.changes = append(user.changes, userChange{identity: identity, at: at})
+	}
+
+	user.identity = identity
+	user.firstSeen = minTime(user.firstSeen, at)
+	user.lastSeen = maxTime(user.lastSeen, at)
+	user.messages++
+}
+
+// queue добавляет в батч изменения накопленных пользователей.
+func (d *userDirectory) queue(batch *pgx.Batch) {
+	ids := make([]string, 0, len(d.pending))
+	for id := range d.pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		user := d.pending[id]
+		for _, change := range user.changes {
+			batch.Queue(insertUserNameQuery, id, change.identity.login, change.identity.displayName, change.identity.color, change.at.UTC())
+		}
+		batch.Queue(upsertUserQuery, id, user.identity.login, user.identity.displayName, user.identity.color,
+			user.firstSeen.UTC(), user.lastSeen.UTC(), user.messages)
+	}
+}
+
+func (d *userDirectory) size() int {
+	return len(d.pending)
+}
+
+// flushed подводит итог записи. После успешной имена запоминаются в кэше.
+// После ошибки накопленное остаётся и уходит со следующим флашем; если
+// пользователей стало больше maxCachedUsers, оно сбрасывается, а имена будут
+// проверены в базе заново.
+func (d *userDirectory) flushed(ok bool) {
+	if !ok {
+		if len(d.pending) <= maxCachedUsers {
+			return
+		}
+		for id := range d.pending {
+			delete(d.known, id)
+		}
+		d.pending = make(map[string]*pendingUser)
+		return
+	}
+
+	if len(d.known)+len(d.pending) > maxCachedUsers {
+		d.known = make(map[string]userIdentity)
+	}
+	for id, user := range d.pending {
+		d.known[id] = user.identity
+	}
+	d.pending = make(map[string]*pendingUser)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"twitch-chat-logger/model"
+)
+
+// queuedKinds сводит запросы батча к "history:<login>" и "user:<id>:<count>".
+func queuedKinds(batch *pgx.Batch) []string {
+	var kinds []string
+	for _, query := range batch.QueuedQueries {
+		switch query.SQL {
+		case insertUserNameQuery:
+			kinds = append(kinds, "history:"+query.Arguments[1].(string))
+		case upsertUserQuery:
+			kinds = append(kinds, "user:"+query.Arguments[0].(string)+":"+strconv.Itoa(query.Arguments[6].(int)))
+		}
+	}
+	return kinds
+}
+
+func assertKinds(t *testing.T, batch *pgx.Batch, expected ...string) {
+	t.Helper()
+	got := queuedKinds(batch)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestUserDirectoryRecordsNameChangesOnce(t *testing.T) {
+	directory := newUserDirectory()
+	at := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	message := func(userID, login string, offset time.Duration) model.ChatMessage {
+		return model.ChatMessage{UserID: userID, Username: login, DisplayName: login, SentAt: at.Add(offset)}
+	}
+
+	directory.observe(message("1", "foo", 0))
+	directory.observe(message("1", "foo", time.Second))
+	directory.observe(message("2", "baz", 0))
+	directory.observe(model.ChatMessage{Username: "anonymous"})
+
+	batch := &pgx.Batch{}
+	directory.queue(batch)
+	assertKinds(t, batch, "history:foo", "user:1:2", "history:baz", "user:2:1")
+	directory.flushed(true)
+
+	// Известное имя не проверяется повторно, смена имени попадает в историю.
+	directory.observe(message("1", "foo", time.Minute))
+	directory.observe(message("2", "qux", time.Minute))
+	batch = &pgx.Batch{}
+	directory.queue(batch)
+	assertKinds(t, batch, "user:1:1", "history:qux", "user:2:1")
+
+	// После неудачной записи накопленное повторяется вместе с новыми сообщениями.
+	directory.flushed(false)
+	directory.observe(message("2", "qux", time.Hour))
+	batch = &pgx.Batch{}
+	directory.queue(batch)
+	assertKinds(t, batch, "user:1:1", "history:qux", "user:2:2")
+}
+
+func TestUserDirectoryKeepsFirstAndLastSeen(t *testing.T) {
+	directory := newUserDirectory()
+	at := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	directory.observe(model.ChatMessage{UserID: "1", Username: "foo", SentAt: at})
+	directory.observe(model.ChatMessage{UserID: "1", Username: "foo", SentAt: at.Add(-time.Minute)})
+	directory.observe(model.ChatMessage{UserID: "1", Username: "bar", SentAt: at.Add(time.Minute)})
+
+	batch := &pgx.Batch{}
+	directory.queue(batch)
+	assertKinds(t, batch, "history:foo", "history:bar", "user:1:3")
+
+	upsert := batch.QueuedQueries[2]
+	if upsert.Arguments[1] != "bar" || !upsert.Arguments[4].(time.Time).Equal(at.Add(-time.Minute)) || !upsert.Arguments[5].(time.Time).Equal(at.Add(time.Minute)) {
+		t.Fatalf("unexpected upsert arguments: %v", upsert.Arguments)
+	}
+}
@@ -0,0 +1,170 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Key идентифицирует токен: приложение (ClientID), вид (AppTokenKind или
+// UserTokenKind) и аккаунт (Login, только для токенов пользователя).
+// Ключ с пустыми ClientID и Login — токен из однотокенного формата до
+// появления ключей; он переносится под полный ключ при первом обращении.
+type Key struct {
+	ClientID string
+	Kind     string
+	Login    string
+}
+
+// AppKey возвращает ключ токена приложения clientID.
+func AppKey(clientID string) Key {
+	return Key{ClientID: clientID, Kind: AppTokenKind}
+}
+
+// UserKey возвращает ключ токена пользователя login в приложении clientID.
+func UserKey(clientID, login string) Key {
+	return Key{ClientID: clientID, Kind: UserTokenKind, Login: strings.ToLower(login)}
+}
+
+// String возвращает ключ в виде "kind:client_id[:login]"; для ключа старого
+// формата — просто вид токена.
+func (k Key) String() string {
+	if k.ClientID == "" && k.Login == "" {
+		return k.Kind
+	}
+	if k.Login == "" {
+		return k.Kind + ":" + k.ClientID
+	}
+	return k.Kind + ":" + k.ClientID + ":" + k.Login
+}
+
+func (k Key) legacy() Key {
+	return Key{Kind: k.Kind}
+}
+
+// Credential — токен, сохранённый под ключом.
+type Credential struct {
+	Key       Key
+	Access    string
+	Refresh   string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// CredentialStore хранит токены нескольких приложений и аккаунтов.
+// LoadCredential возвращает ошибку, оборачивающую os.ErrNotExist, если токена нет.
+type CredentialStore interface {
+	LoadCredential(key Key) (*Credential, error)
+	SaveCredential(credential Credential) error
+	DeleteCredential(key Key) error
+	ListCredentials() ([]Credential, error)
+}
+
+// CredentialLocker реализуется хранилищами, общими для нескольких процессов:
+// блокировка берётся на один ключ, остальные токены обновляются независимо.
+type CredentialLocker interface {
+	LockCredential(ctx context.Context, key Key) (unlock func(), err error)
+}
+
+// AppTokens возвращает хранилище токена приложения clientID для AppTokenManager.
+func AppTokens(store CredentialStore, clientID string) TokenStore {
+	return keyed(store, AppKey(clientID))
+}
+
+// UserTokens возвращает хранилище токена пользователя login для UserTokenRefresher.
+func UserTokens(store CredentialStore, clientID, login string) UserTokenStore {
+	return keyed(store, UserKey(clientID, login))
+}
+
+// keyed выбирает обёртку с TokenLocker, если хранилище умеет блокировать ключи.
+func keyed(store CredentialStore, key Key) interface {
+	TokenStore
+	UserTokenStore
+} {
+	base := keyedStore{store: store, key: key}
+	if locker, ok := store.(CredentialLocker); ok {
+		return lockingKeyedStore{keyedStore: base, locker: locker}
+	}
+	return base
+}
+
+// keyedStore — CredentialStore, сведённый к одному ключу.
+type keyedStore struct {
+	store CredentialStore
+	key   Key
+}
+
+func (s keyedStore) LoadAppToken() (*Token, error) {
+	credential, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Access: credential.Access, ExpiresAt: credential.ExpiresAt}, nil
+}
+
+func (s keyedStore) SaveAppToken(token Token) error {
+	return s.store.SaveCredential(Credential{Key: s.key, Access: token.Access, ExpiresAt: token.ExpiresAt})
+}
+
+func (s keyedStore) LoadUserToken() (*UserToken, error) {
+	credential, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return &UserToken{
+		Access:    credential.Access,
+		Refresh:   credential.Refresh,
+		Scopes:    credential.Scopes,
+		ExpiresAt: credential.ExpiresAt,
+	}, nil
+}
+
+func (s keyedStore) SaveUserToken(token UserToken) error {
+	return s.store.SaveCredential(Credential{
+		Key:       s.key,
+		Access:    token.Access,
+		Refresh:   token.Refresh,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+// load читает токен по ключу; если его нет, забирает токен старого формата
+// того же вида и переносит его под ключ.
+func (s keyedStore) load() (*Credential, error) {
+	credential, err := s.store.LoadCredential(s.key)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return credential, err
+	}
+
+	legacy := s.key.legacy()
+	if legacy == s.key {
+		return nil, err
+	}
+	credential, legacyErr := s.store.LoadCredential(legacy)
+	if legacyErr != nil {
+		return nil, err
+	}
+
+	credential.Key = s.key
+	if err := s.store.SaveCredential(*credential); err != nil {
+		return nil, fmt.Errorf("migrate %s to %s: %w", legacy, s.key, err)
+	}
+	if err := s.store.DeleteCredential(legacy); err != nil {
+		return nil, fmt.Errorf("migrate %s to %s: %w", legacy, s.key, err)
+	}
+	return credential, nil
+}
+
+type lockingKeyedStore struct {
+	keyedStore
+	locker CredentialLocker
+}
+
+// LockToken блокирует ключ этого хранилища; kind уже входит в ключ.
+func (s lockingKeyedStore) LockToken(ctx context.Context, _ string) (func(), error) {
+	return s.locker.LockCredential(ctx, s.key)
+}
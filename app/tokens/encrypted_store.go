@@ -0,0 +1,183 @@
+package tokens
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	encryptedFormat = "aes-256-gcm"
+	keySize         = 32
+)
+
+// ErrTokenTampered возвращается, если зашифрованный файл изменён или ключ не подходит.
+var ErrTokenTampered = errors.New("token file was tampered with or the key is wrong")
+
+// tokensFileAAD — дополнительные данные AEAD файла токенов версии 2. Файлы
+// старого формата шифровались с видом токена, поэтому подмена файла
+// токена приложения файлом пользователя не проходила проверку.
+const tokensFileAAD = "tokens"
+
+// NewFileStore возвращает EncryptedFileTokenStore, если задан ключ, иначе FileTokenStore.
+func NewFileStore(path, userPath string, key []byte) CredentialStore {
+	if len(key) > 0 {
+		return EncryptedFileTokenStore{Path: path, UserPath: userPath, Key: key}
+	}
+	return FileTokenStore{Path: path, UserPath: userPath}
+}
+
+// EncryptedFileTokenStore хранит токены в том же файле, что и FileTokenStore,
+// но зашифрованными AES-256-GCM. Файлы в открытом виде или зашифрованные
+// в старом формате читаются один раз и сразу перезаписываются.
+// Изменённый зашифрованный файл не загружается: возвращается ErrTokenTampered.
+type EncryptedFileTokenStore struct {
+	Path     string
+	UserPath string
+	Key      []byte
+}
+
+// encryptedFile — содержимое зашифрованного файла токенов.
+type encryptedFile struct {
+	Format     string `json:"format"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// LoadCredential загружает и расшифровывает токен по ключу.
+func (store EncryptedFileTokenStore) LoadCredential(key Key) (*Credential, error) {
+	return store.file().load(key)
+}
+
+// SaveCredential шифрует и сохраняет токен.
+func (store EncryptedFileTokenStore) SaveCredential(credential Credential) error {
+	return store.file().save(credential)
+}
+
+// DeleteCredential удаляет токен по ключу.
+func (store EncryptedFileTokenStore) DeleteCredential(key Key) error {
+	return store.file().delete(key)
+}
+
+// ListCredentials возвращает все сохранённые токены.
+func (store EncryptedFileTokenStore) ListCredentials() ([]Credential, error) {
+	return store.file().list()
+}
+
+func (store EncryptedFileTokenStore) file() credentialFile {
+	return credentialFile{
+		path:     pathOrDefault(store.Path, TOKEN_FILE),
+		userPath: pathOrDefault(store.UserPath, USER_TOKEN_FILE),
+		open:     store.open,
+		seal:     store.seal,
+	}
+}
+
+// open возвращает расшифрованное содержимое файла; rewrite == true, если
+// файл не зашифрован или зашифрован в старом формате с видом токена kind.
+func (store EncryptedFileTokenStore) open(data []byte, kind string) ([]byte, bool, error) {
+	var envelope encryptedFile
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Format == "" {
+		slog.Warn("файл токенов не зашифрован, шифруем", "component", "tokens", "kind", kind)
+		return data, true, nil
+	}
+	if envelope.Format != encryptedFormat {
+		return nil, false, fmt.Errorf("unsupported format %q", envelope.Format)
+	}
+
+	aead, err := newAEAD(store.Key)
+	if err != nil {
+		return nil, false, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, false, ErrTokenTampered
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, false, ErrTokenTampered
+	}
+
+	if plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(tokensFileAAD)); err == nil {
+		return plaintext, false, nil
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(kind))
+	if err != nil {
+		return nil, false, ErrTokenTampered
+	}
+	return plaintext, true, nil
+}
+
+func (store EncryptedFileTokenStore) seal(plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(store.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	data, err := json.Marshal(encryptedFile{
+		Format:     encryptedFormat,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, []byte(tokensFileAAD))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode json: %w", err)
+	}
+	return data, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadKey возвращает ключ шифрования из key (32 байта в base64 или hex) или,
+// если key пустой, из файла keyFile. Если пусты оба, ключа нет: (nil, nil).
+func LoadKey(key, keyFile string) ([]byte, error) {
+	value := strings.TrimSpace(key)
+	if value == "" && strings.TrimSpace(keyFile) != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load token key: %w", err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == keySize {
+		return decoded, nil
+	}
+	if decoded, err := hex.DecodeString(value); err == nil && len(decoded) == keySize {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("load token key: expected %d bytes in base64 or hex", keySize)
+}
+
+// GenerateKey создаёт случайный ключ шифрования в base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generate token key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
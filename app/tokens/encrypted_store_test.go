@@ -0,0 +1,179 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key, err := LoadKey(encoded, "")
+	if err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+	return key
+}
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := EncryptedFileTokenStore{Path: filepath.Join(dir, "tokens.json"), UserPath: filepath.Join(dir, "user.json"), Key: testKey(t)}
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	if err := AppTokens(store, "client").SaveAppToken(Token{Access: "secret-app-token", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("SaveAppToken: %v", err)
+	}
+	if err := UserTokens(store, "client", "bot").SaveUserToken(UserToken{Access: "secret-user-token", Refresh: "secret-refresh", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("SaveUserToken: %v", err)
+	}
+
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("bot")) {
+		t.Fatalf("file contains plaintext token: %s", data)
+	}
+
+	app, err := AppTokens(store, "client").LoadAppToken()
+	if err != nil || app.Access != "secret-app-token" || !app.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("LoadAppToken: %+v, %v", app, err)
+	}
+	user, err := UserTokens(store, "client", "bot").LoadUserToken()
+	if err != nil || user.Access != "secret-user-token" || user.Refresh != "secret-refresh" {
+		t.Fatalf("LoadUserToken: %+v, %v", user, err)
+	}
+}
+
+func TestEncryptedStoreMigratesPlaintextFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	writeLegacyFiles(t, path, "")
+
+	store := EncryptedFileTokenStore{Path: path, UserPath: filepath.Join(dir, "user.json"), Key: testKey(t)}
+	credential, err := store.LoadCredential(Key{Kind: AppTokenKind})
+	if err != nil || credential.Access != "legacy-app" {
+		t.Fatalf("LoadCredential: %+v, %v", credential, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if bytes.Contains(data, []byte("legacy")) {
+		t.Fatalf("plaintext file was not re-encrypted: %s", data)
+	}
+	if _, err := store.LoadCredential(Key{Kind: AppTokenKind}); err != nil {
+		t.Fatalf("LoadCredential after migration: %v", err)
+	}
+}
+
+func TestEncryptedStoreMigratesLegacyEncryptedFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(t)
+	store := EncryptedFileTokenStore{Path: filepath.Join(dir, "tokens.json"), UserPath: filepath.Join(dir, "user.json"), Key: key}
+	writeLegacyEncrypted(t, key, store.Path, AppTokenKind, `{"access":"legacy-app","expires_at":"2030-01-01T00:00:00Z"}`)
+	writeLegacyEncrypted(t, key, store.UserPath, UserTokenKind, `{"access":"legacy-user","refresh":"r","expires_at":"2030-01-01T00:00:00Z"}`)
+
+	credentials, err := store.ListCredentials()
+	if err != nil || len(credentials) != 2 {
+		t.Fatalf("ListCredentials: %+v, %v", credentials, err)
+	}
+	if _, err := os.Stat(store.UserPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("legacy user file was not removed: %v", err)
+	}
+	user, err := store.LoadCredential(Key{Kind: UserTokenKind})
+	if err != nil || user.Access != "legacy-user" {
+		t.Fatalf("LoadCredential: %+v, %v", user, err)
+	}
+}
+
+func TestEncryptedStoreRejectsTamperedFile(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(t)
+	store := EncryptedFileTokenStore{Path: filepath.Join(dir, "tokens.json"), UserPath: filepath.Join(dir, "user.json"), Key: key}
+	if err := store.SaveCredential(Credential{Key: AppKey("client"), Access: "token", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("SaveCredential: %v", err)
+	}
+
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var envelope encryptedFile
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	ciphertext, _ := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	ciphertext[0] ^= 0xff
+	envelope.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+	tampered, _ := json.Marshal(envelope)
+	if err := os.WriteFile(store.Path, tampered, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := store.LoadCredential(AppKey("client")); !errors.Is(err, ErrTokenTampered) {
+		t.Fatalf("expected ErrTokenTampered, got %v", err)
+	}
+
+	// Файл токена приложения старого формата, подложенный вместо файла пользователя, тоже отвергается.
+	if err := os.WriteFile(store.Path, data, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	writeLegacyEncrypted(t, key, store.UserPath, AppTokenKind, `{"access":"app","expires_at":"2030-01-01T00:00:00Z"}`)
+	if _, err := store.LoadCredential(Key{Kind: UserTokenKind}); !errors.Is(err, ErrTokenTampered) {
+		t.Fatalf("expected ErrTokenTampered for swapped file, got %v", err)
+	}
+
+	wrongKey := EncryptedFileTokenStore{Path: store.Path, UserPath: filepath.Join(dir, "missing.json"), Key: testKey(t)}
+	if _, err := wrongKey.LoadCredential(AppKey("client")); !errors.Is(err, ErrTokenTampered) {
+		t.Fatalf("expected ErrTokenTampered for wrong key, got %v", err)
+	}
+}
+
+// writeLegacyEncrypted записывает файл токена в зашифрованном формате до
+// появления ключей: AAD — вид токена.
+func writeLegacyEncrypted(t *testing.T, key []byte, path, kind, plaintext string) {
+	t.Helper()
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatalf("newAEAD: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	data, _ := json.Marshal(encryptedFile{
+		Format:     encryptedFormat,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, []byte(plaintext), []byte(kind))),
+	})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestLoadKeyFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	encoded, _ := GenerateKey()
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	key, err := LoadKey("", path)
+	if err != nil || len(key) != keySize {
+		t.Fatalf("LoadKey: %v, %d bytes", err, len(key))
+	}
+	if key, err := LoadKey("", ""); key != nil || err != nil {
+		t.Fatalf("expected no key, got %v, %v", key, err)
+	}
+	if _, err := LoadKey("short", ""); err == nil {
+		t.Fatal("expected error for invalid key")
+	}
+}
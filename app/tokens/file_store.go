@@ -2,18 +2,51 @@ package tokens
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 const TOKEN_FILE = ".secrets/twitch_tokens.json"
 
-// FileTokenStore сохраняет токены в JSON файле.
+const USER_TOKEN_FILE = ".secrets/twitch_user_token.json"
+
+// tokenFileVersion — версия формата файла токенов. Файл без версии — формат
+// до появления ключей: один токен приложения в Path и один токен
+// пользователя в UserPath.
+const tokenFileVersion = 2
+
+// fileMu сериализует чтение-изменение-запись файлов токенов внутри процесса.
+var fileMu sync.Mutex
+
+// FileTokenStore хранит все токены в одном JSON файле Path. Файлы старого
+// формата (токен приложения в Path и токен пользователя в UserPath) при
+// первом обращении переносятся в новый формат под ключи без client id и
+// логина, а UserPath удаляется.
 type FileTokenStore struct {
-	Path string
+	Path     string
+	UserPath string
+}
+
+// tokensFile — содержимое файла токенов версии 2.
+type tokensFile struct {
+	Version int              `json:"version"`
+	Tokens  []fileCredential `json:"tokens"`
+}
+
+type fileCredential struct {
+	ClientID  string   `json:"client_id,omitempty"`
+	Kind      string   `json:"kind"`
+	Login     string   `json:"login,omitempty"`
+	Access    string   `json:"access"`
+	Refresh   string   `json:"refresh,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresAt string   `json:"expires_at"`
 }
 
 type fileToken struct {
@@ -21,21 +54,282 @@ type fileToken struct {
 	ExpiresAt string `json:"expires_at"`
 }
 
-func (store FileTokenStore) tokenPath() string {
-	if strings.TrimSpace(store.Path) == "" {
-		return TOKEN_FILE
+type fileUserToken struct {
+	Access    string   `json:"access"`
+	Refresh   string   `json:"refresh"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+// LoadCredential загружает токен по ключу.
+func (store FileTokenStore) LoadCredential(key Key) (*Credential, error) {
+	return store.file().load(key)
+}
+
+// SaveCredential сохраняет токен, заменяя токен с тем же ключом.
+func (store FileTokenStore) SaveCredential(credential Credential) error {
+	return store.file().save(credential)
+}
+
+// DeleteCredential удаляет токен по ключу; отсутствие токена — не ошибка.
+func (store FileTokenStore) DeleteCredential(key Key) error {
+	return store.file().delete(key)
+}
+
+// ListCredentials возвращает все сохранённые токены.
+func (store FileTokenStore) ListCredentials() ([]Credential, error) {
+	return store.file().list()
+}
+
+func (store FileTokenStore) file() credentialFile {
+	return credentialFile{
+		path:     pathOrDefault(store.Path, TOKEN_FILE),
+		userPath: pathOrDefault(store.UserPath, USER_TOKEN_FILE),
+		open: func(data []byte, _ string) ([]byte, bool, error) {
+			return data, false, nil
+		},
+		seal: func(data []byte) ([]byte, error) {
+			return data, nil
+		},
+	}
+}
+
+// credentialFile реализует CredentialStore поверх файла; open и seal
+// расшифровывают и шифруют его содержимое. open получает вид токена,
+// хранившегося в файле старого формата, и сообщает, нужно ли перезаписать файл.
+type credentialFile struct {
+	path     string
+	userPath string
+	open     func(data []byte, kind string) ([]byte, bool, error)
+	seal     func(data []byte) ([]byte, error)
+}
+
+func (f credentialFile) load(key Key) (*Credential, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	credentials, err := f.readMigrated()
+	if err != nil {
+		return nil, fmt.Errorf("load token %s: %w", key, err)
+	}
+	for _, credential := range credentials {
+		if credential.Key == key {
+			return &credential, nil
+		}
+	}
+	return nil, fmt.Errorf("load token %s: %w", key, os.ErrNotExist)
+}
+
+func (f credentialFile) save(credential Credential) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	credentials, _, err := f.read()
+	if err != nil {
+		return fmt.Errorf("save token %s: %w", credential.Key, err)
+	}
+	credentials = removeCredential(credentials, credential.Key)
+	if err := f.write(append(credentials, credential)); err != nil {
+		return fmt.Errorf("save token %s: %w", credential.Key, err)
+	}
+	return nil
+}
+
+func (f credentialFile) delete(key Key) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	credentials, _, err := f.read()
+	if err != nil {
+		return fmt.Errorf("delete token %s: %w", key, err)
+	}
+	if err := f.write(removeCredential(credentials, key)); err != nil {
+		return fmt.Errorf("delete token %s: %w", key, err)
+	}
+	return nil
+}
+
+func (f credentialFile) list() ([]Credential, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	credentials, err := f.readMigrated()
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	return credentials, nil
+}
+
+// readMigrated читает токены и, если файлы были в старом формате,
+// сразу перезаписывает их в новом.
+func (f credentialFile) readMigrated() ([]Credential, error) {
+	credentials, migrate, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	if migrate {
+		if err := f.write(credentials); err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return credentials, nil
+}
+
+// read возвращает токены из Path и файла UserPath старого формата;
+// migrate == true, если файлы нужно перезаписать в новом формате.
+func (f credentialFile) read() (credentials []Credential, migrate bool, err error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("read file: %w", err)
+	}
+	if err == nil {
+		plain, rewrite, err := f.open(data, AppTokenKind)
+		if err != nil {
+			return nil, false, err
+		}
+		var legacy bool
+		credentials, legacy, err = decodeTokensFile(plain)
+		if err != nil {
+			return nil, false, err
+		}
+		migrate = rewrite || legacy
+	}
+
+	if f.userPath == f.path {
+		return credentials, migrate, nil
+	}
+	data, err = os.ReadFile(f.userPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials, migrate, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read file: %w", err)
+	}
+	plain, _, err := f.open(data, UserTokenKind)
+	if err != nil {
+		return nil, false, err
+	}
+	token, err := decodeUserToken(plain)
+	if err != nil {
+		return nil, false, err
+	}
+	legacyKey := Key{Kind: UserTokenKind}
+	if !hasCredential(credentials, legacyKey) {
+		credentials = append(credentials, Credential{
+			Key:       legacyKey,
+			Access:    token.Access,
+			Refresh:   token.Refresh,
+			Scopes:    token.Scopes,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+	return credentials, true, nil
+}
+
+// write записывает токены в Path в формате версии 2 и удаляет файл
+// UserPath старого формата, содержимое которого уже перенесено.
+func (f credentialFile) write(credentials []Credential) error {
+	data, err := encodeTokensFile(credentials)
+	if err != nil {
+		return err
 	}
-	return store.Path
+	data, err = f.seal(data)
+	if err != nil {
+		return err
+	}
+	if err := writeTokenFile(f.path, data); err != nil {
+		return err
+	}
+	if f.userPath != f.path {
+		if err := os.Remove(f.userPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove legacy user token file: %w", err)
+		}
+	}
+	return nil
 }
 
-// LoadAppToken загружает OAuth токен приложения из JSON файла.
-func (store FileTokenStore) LoadAppToken() (*Token, error) {
-	path := store.tokenPath()
-	data, err := os.ReadFile(path)
+// decodeTokensFile разбирает файл версии 2 или токен приложения старого
+// формата; legacy == true для старого формата.
+func decodeTokensFile(data []byte) ([]Credential, bool, error) {
+	var payload tokensFile
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, false, fmt.Errorf("decode json: %w", err)
+	}
+
+	switch payload.Version {
+	case 0:
+		token, err := decodeAppToken(data)
+		if err != nil {
+			return nil, false, err
+		}
+		return []Credential{{Key: Key{Kind: AppTokenKind}, Access: token.Access, ExpiresAt: token.ExpiresAt}}, true, nil
+	case tokenFileVersion:
+	default:
+		return nil, false, fmt.Errorf("unsupported token file version %d", payload.Version)
+	}
+
+	credentials := make([]Credential, 0, len(payload.Tokens))
+	for _, token := range payload.Tokens {
+		expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+		if err != nil {
+			return nil, false, fmt.Errorf("parse expires_at: %w", err)
+		}
+		credentials = append(credentials, Credential{
+			Key:       Key{ClientID: token.ClientID, Kind: token.Kind, Login: token.Login},
+			Access:    token.Access,
+			Refresh:   token.Refresh,
+			Scopes:    token.Scopes,
+			ExpiresAt: expiresAt,
+		})
+	}
+	return credentials, false, nil
+}
+
+func encodeTokensFile(credentials []Credential) ([]byte, error) {
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].Key.String() < credentials[j].Key.String()
+	})
+
+	payload := tokensFile{Version: tokenFileVersion, Tokens: make([]fileCredential, 0, len(credentials))}
+	for _, credential := range credentials {
+		payload.Tokens = append(payload.Tokens, fileCredential{
+			ClientID:  credential.Key.ClientID,
+			Kind:      credential.Key.Kind,
+			Login:     credential.Key.Login,
+			Access:    credential.Access,
+			Refresh:   credential.Refresh,
+			Scopes:    credential.Scopes,
+			ExpiresAt: credential.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+
+	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("load app token: read file: %w", err)
+		return nil, fmt.Errorf("encode json: %w", err)
+	}
+	return data, nil
+}
+
+func hasCredential(credentials []Credential, key Key) bool {
+	for _, credential := range credentials {
+		if credential.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func removeCredential(credentials []Credential, key Key) []Credential {
+	kept := credentials[:0]
+	for _, credential := range credentials {
+		if credential.Key != key {
+			kept = append(kept, credential)
+		}
 	}
+	return kept
+}
 
+func decodeAppToken(data []byte) (*Token, error) {
 	var payload fileToken
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return nil, fmt.Errorf("load app token: decode json: %w", err)
@@ -52,30 +346,70 @@ func (store FileTokenStore) LoadAppToken() (*Token, error) {
 	}, nil
 }
 
-// SaveAppToken сохраняет OAuth токен приложения в JSON файл.
-func (store FileTokenStore) SaveAppToken(token Token) error {
-	path := store.tokenPath()
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o700); err != nil {
-		return fmt.Errorf("save app token: create dir: %w", err)
+func decodeUserToken(data []byte) (*UserToken, error) {
+	var payload fileUserToken
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("load user token: decode json: %w", err)
 	}
 
-	payload := fileToken{
-		Access:    token.Access,
-		ExpiresAt: token.ExpiresAt.Format(time.RFC3339),
+	expiresAt, err := time.Parse(time.RFC3339, payload.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("load user token: parse expires_at: %w", err)
 	}
 
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("save app token: encode json: %w", err)
+	return &UserToken{
+		Access:    payload.Access,
+		Refresh:   payload.Refresh,
+		Scopes:    payload.Scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func pathOrDefault(path, def string) string {
+	if strings.TrimSpace(path) == "" {
+		return def
 	}
+	return path
+}
 
-	if err := os.WriteFile(path, data, 0o600); err != nil {
-		return fmt.Errorf("save app token: write file: %w", err)
+// writeTokenFile создаёт каталог и записывает файл с правами 0600.
+func writeTokenFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create dir: %w", err)
 	}
-	if err := os.Chmod(path, 0o600); err != nil {
-		return fmt.Errorf("save app token: chmod file: %w", err)
+	return writeSecretFile(path, data)
+}
+
+// writeSecretFile атомарно заменяет файл: данные пишутся во временный файл
+// в том же каталоге, сбрасываются на диск и переименовываются поверх старого.
+// Сбой посреди записи оставляет прежний файл со всеми токенами целым.
+func writeSecretFile(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
 
+	// CreateTemp создаёт файл с правами 0600, но umask и ОС бывают разными.
+	if err := tmp.Chmod(0o600); err != nil {
+		return fmt.Errorf("chmod file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace file: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,140 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLegacyFiles записывает файлы токенов в формате до появления ключей.
+func writeLegacyFiles(t *testing.T, path, userPath string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(`{"access":"legacy-app","expires_at":"2030-01-01T00:00:00Z"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if userPath == "" {
+		return
+	}
+	if err := os.WriteFile(userPath, []byte(`{"access":"legacy-user","refresh":"legacy-refresh","scopes":["chat:read"],"expires_at":"2030-01-01T00:00:00Z"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestFileStoreMigratesVersion1Files(t *testing.T) {
+	dir := t.TempDir()
+	store := FileTokenStore{Path: filepath.Join(dir, "tokens.json"), UserPath: filepath.Join(dir, "user.json")}
+	writeLegacyFiles(t, store.Path, store.UserPath)
+
+	credentials, err := store.ListCredentials()
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if len(credentials) != 2 || credentials[0].Key != (Key{Kind: AppTokenKind}) || credentials[1].Key != (Key{Kind: UserTokenKind}) {
+		t.Fatalf("unexpected credentials: %+v", credentials)
+	}
+	if credentials[1].Refresh != "legacy-refresh" || len(credentials[1].Scopes) != 1 {
+		t.Fatalf("user token lost fields: %+v", credentials[1])
+	}
+
+	data, err := os.ReadFile(store.Path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var payload tokensFile
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Version != tokenFileVersion || len(payload.Tokens) != 2 {
+		t.Fatalf("file was not rewritten as version %d: %s", tokenFileVersion, data)
+	}
+	if _, err := os.Stat(store.UserPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("legacy user file was not removed: %v", err)
+	}
+}
+
+func TestKeyedStoreAdoptsLegacyToken(t *testing.T) {
+	dir := t.TempDir()
+	store := FileTokenStore{Path: filepath.Join(dir, "tokens.json"), UserPath: filepath.Join(dir, "user.json")}
+	writeLegacyFiles(t, store.Path, store.UserPath)
+
+	user, err := UserTokens(store, "client", "Bot").LoadUserToken()
+	if err != nil || user.Access != "legacy-user" {
+		t.Fatalf("LoadUserToken: %+v, %v", user, err)
+	}
+	app, err := AppTokens(store, "client").LoadAppToken()
+	if err != nil || app.Access != "legacy-app" {
+		t.Fatalf("LoadAppToken: %+v, %v", app, err)
+	}
+
+	credentials, err := store.ListCredentials()
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if len(credentials) != 2 || credentials[0].Key != AppKey("client") || credentials[1].Key != UserKey("client", "bot") {
+		t.Fatalf("legacy tokens were not moved under keys: %+v", credentials)
+	}
+
+	// Второй аккаунт того же приложения не получает чужой токен.
+	if _, err := UserTokens(store, "client", "other").LoadUserToken(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist for another login, got %v", err)
+	}
+}
+
+func TestFileStoreKeepsTokensPerKey(t *testing.T) {
+	store := FileTokenStore{Path: filepath.Join(t.TempDir(), "tokens.json")}
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	keys := []Key{AppKey("first"), AppKey("second"), UserKey("first", "bot"), UserKey("first", "mod"), UserKey("second", "bot")}
+	for _, key := range keys {
+		if err := store.SaveCredential(Credential{Key: key, Access: key.String(), ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("SaveCredential %s: %v", key, err)
+		}
+	}
+	if err := store.SaveCredential(Credential{Key: UserKey("first", "bot"), Access: "updated", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("SaveCredential: %v", err)
+	}
+
+	credential, err := store.LoadCredential(UserKey("first", "bot"))
+	if err != nil || credential.Access != "updated" || !credential.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("LoadCredential: %+v, %v", credential, err)
+	}
+	credential, err = store.LoadCredential(UserKey("second", "bot"))
+	if err != nil || credential.Access != UserKey("second", "bot").String() {
+		t.Fatalf("LoadCredential: %+v, %v", credential, err)
+	}
+
+	if err := store.DeleteCredential(UserKey("first", "mod")); err != nil {
+		t.Fatalf("DeleteCredential: %v", err)
+	}
+	if _, err := store.LoadCredential(UserKey("first", "mod")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist after delete, got %v", err)
+	}
+	credentials, err := store.ListCredentials()
+	if err != nil || len(credentials) != len(keys)-1 {
+		t.Fatalf("ListCredentials: %+v, %v", credentials, err)
+	}
+}
+
+func TestWriteSecretFileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if err := writeSecretFile(path, []byte("new")); err != nil {
+		t.Fatalf("writeSecretFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Fatalf("unexpected content %q, %v", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected mode 0600, got %v, %v", info.Mode(), err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+}
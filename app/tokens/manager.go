@@ -3,70 +3,286 @@ package tokens
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"math/rand/v2"
 	"os"
 	"sync"
 	"time"
 )
 
+const (
+	defaultAppRefreshMargin = 5 * time.Minute
+	defaultAppRetryBase     = 5 * time.Second
+	defaultAppRetryMax      = 5 * time.Minute
+)
+
 // AppTokenFetcher запрашивает токен приложения.
-type AppTokenFetcher func() (accessToken string, expiresIn time.Duration, err error)
+type AppTokenFetcher func(ctx context.Context) (accessToken string, expiresIn time.Duration, err error)
+
+// Clock — источник времени и таймеров. В тестах подменяется, чтобы проверять
+// сроки токенов без ожидания.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock — Clock на основе пакета time.
+var SystemClock Clock = systemClock{}
+
+// AppTokenManagerConfig задаёт необязательные параметры AppTokenManager;
+// нулевые значения заменяются значениями по умолчанию.
+type AppTokenManagerConfig struct {
+	// Margin — за сколько до истечения токен считается устаревшим (5 минут).
+	Margin time.Duration
+	// Jitter — наибольший случайный сдвиг фонового обновления раньше срока,
+	// чтобы реплики не обновляли токен одновременно (Margin/5; < 0 — без сдвига).
+	Jitter time.Duration
+	// RetryBase и RetryMax — начальная и наибольшая задержка между повторами
+	// неудачного фонового обновления (5 секунд и 5 минут).
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// Clock — источник времени (SystemClock).
+	Clock Clock
+}
 
 // AppTokenManager управляет OAuth токеном приложения.
 type AppTokenManager struct {
-	store    TokenStore
-	getToken AppTokenFetcher
-	mu       sync.Mutex
+	store     TokenStore
+	getToken  AppTokenFetcher
+	margin    time.Duration
+	jitter    time.Duration
+	retryBase time.Duration
+	retryMax  time.Duration
+	clock     Clock
+	logger    *slog.Logger
+
+	mu          sync.Mutex
+	current     *Token
+	subscribers []func(Token)
 }
 
 // NewAppTokenManager создает менеджер токенов приложения.
-func NewAppTokenManager(store TokenStore, getToken AppTokenFetcher) *AppTokenManager {
+func NewAppTokenManager(store TokenStore, getToken AppTokenFetcher, cfg AppTokenManagerConfig) *AppTokenManager {
+	if cfg.Margin <= 0 {
+		cfg.Margin = defaultAppRefreshMargin
+	}
+	if cfg.Jitter == 0 {
+		cfg.Jitter = cfg.Margin / 5
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = defaultAppRetryBase
+	}
+	if cfg.RetryMax <= 0 {
+		cfg.RetryMax = defaultAppRetryMax
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+
 	return &AppTokenManager{
-		store:    store,
-		getToken: getToken,
+		store:     store,
+		getToken:  getToken,
+		margin:    cfg.Margin,
+		jitter:    cfg.Jitter,
+		retryBase: cfg.RetryBase,
+		retryMax:  cfg.RetryMax,
+		clock:     cfg.Clock,
+		logger:    slog.Default().With("component", "tokens"),
 	}
 }
 
+// OnRefresh регистрирует колбэк, который получает каждый новый токен:
+// полученный этим менеджером или обновлённый другим процессом.
+func (manager *AppTokenManager) OnRefresh(fn func(Token)) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.subscribers = append(manager.subscribers, fn)
+}
+
 // Get возвращает OAuth токен приложения, обновляя его при необходимости.
+// Если хранилище реализует TokenLocker, обновление выполняется под его
+// блокировкой, и токен, уже обновлённый другим процессом, переиспользуется.
 func (manager *AppTokenManager) Get(ctx context.Context) (Token, error) {
+	return manager.get(ctx, manager.margin, "")
+}
+
+// ForceRefresh заменяет токен rejected, который отверг сервер (например, Helix
+// ответил 401), даже если срок его действия не истёк. Если токен уже заменён
+// этим или другим процессом, возвращается новый без повторного запроса.
+func (manager *AppTokenManager) ForceRefresh(ctx context.Context, rejected string) (Token, error) {
+	return manager.get(ctx, manager.margin, rejected)
+}
+
+// Start запускает фоновое обновление токена (см. Run) до отмены ctx.
+func (manager *AppTokenManager) Start(ctx context.Context) {
+	go func() {
+		_ = manager.Run(ctx)
+	}()
+}
+
+// Run обновляет токен заранее, за Margin плюс случайный Jitter до истечения
+// (но не раньше середины срока токена и не чаще раза в RetryBase),
+// и блокируется до отмены контекста. Неудачное обновление повторяется с
+// экспоненциальной задержкой от RetryBase до RetryMax.
+func (manager *AppTokenManager) Run(ctx context.Context) error {
+	failures := 0
+	ahead := manager.margin
+	var scheduled time.Time
+	for {
+		token, err := manager.get(ctx, ahead, "")
+
+		var wait time.Duration
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			wait = manager.retryDelay(failures)
+			failures++
+			manager.logger.Warn("не удалось обновить токен приложения", "retry_in", wait, "err", err)
+		default:
+			failures = 0
+			// Сдвиг выбирается один раз на токен: после сна токен должен
+			// считаться устаревшим с тем же запасом.
+			now := manager.clock.Now()
+			if !token.ExpiresAt.Equal(scheduled) {
+				scheduled = token.ExpiresAt
+				ahead = manager.margin + manager.randomJitter()
+				// Токен, живущий меньше запаса, иначе обновлялся бы снова сразу
+				// после получения; такой токен обновляется на середине срока.
+				if lifetime := token.ExpiresAt.Sub(now); ahead > lifetime/2 {
+					ahead = lifetime / 2
+				}
+			}
+			wait = max(token.ExpiresAt.Sub(now)-ahead, manager.retryBase)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-manager.clock.After(wait):
+		}
+	}
+}
+
+// get возвращает токен, обновляя его, если он истекает раньше чем через margin
+// или совпадает с отвергнутым rejected.
+func (manager *AppTokenManager) get(ctx context.Context, margin time.Duration, rejected string) (Token, error) {
 	if err := ctx.Err(); err != nil {
 		return Token{}, err
 	}
 
 	manager.mu.Lock()
-	defer manager.mu.Unlock()
+	token, fetched, err := manager.getLocked(ctx, margin, rejected)
+	if err != nil {
+		manager.mu.Unlock()
+		return Token{}, err
+	}
+	subscribers := manager.rememberLocked(token, fetched)
+	manager.mu.Unlock()
 
-	token, err := manager.store.LoadAppToken()
+	for _, fn := range subscribers {
+		fn(token)
+	}
+	return token, nil
+}
+
+// getLocked возвращает токен из хранилища или новый; fetched == true, если
+// токен получен этим вызовом.
+func (manager *AppTokenManager) getLocked(ctx context.Context, margin time.Duration, rejected string) (Token, bool, error) {
+	token, err := manager.load()
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return Token{}, err
-		}
+		return Token{}, false, err
 	}
+	if manager.usable(token, margin, rejected) {
+		return *token, false, nil
+	}
+
+	if locker, ok := manager.store.(TokenLocker); ok {
+		unlock, err := locker.LockToken(ctx, AppTokenKind)
+		if err != nil {
+			return Token{}, false, err
+		}
+		defer unlock()
 
-	if token != nil && !isTokenExpiringSoon(token) {
-		return *token, nil
+		token, err = manager.load()
+		if err != nil {
+			return Token{}, false, err
+		}
+		if manager.usable(token, margin, rejected) {
+			return *token, false, nil
+		}
 	}
 
 	if err := ctx.Err(); err != nil {
-		return Token{}, err
+		return Token{}, false, err
 	}
 
-	accessToken, expiresIn, err := manager.getToken()
+	accessToken, expiresIn, err := manager.getToken(ctx)
 	if err != nil {
-		return Token{}, err
+		return Token{}, false, err
 	}
 
 	newToken := Token{
 		Access:    accessToken,
-		ExpiresAt: time.Now().Add(expiresIn),
+		ExpiresAt: manager.clock.Now().Add(expiresIn),
 	}
 
 	if err := manager.store.SaveAppToken(newToken); err != nil {
-		return Token{}, err
+		return Token{}, false, err
 	}
 
-	return newToken, nil
+	return newToken, true, nil
 }
 
-func isTokenExpiringSoon(token *Token) bool {
-	return token.ExpiresAt.Before(time.Now().Add(5 * time.Minute))
+// rememberLocked запоминает токен и возвращает подписчиков, которых нужно
+// уведомить: токен получен этим менеджером или отличается от известного ранее.
+func (manager *AppTokenManager) rememberLocked(token Token, fetched bool) []func(Token) {
+	previous := manager.current
+	manager.current = &token
+	if !fetched && (previous == nil || previous.Access == token.Access) {
+		return nil
+	}
+	return append(make([]func(Token), 0, len(manager.subscribers)), manager.subscribers...)
+}
+
+// load читает токен из хранилища; отсутствие токена — не ошибка.
+func (manager *AppTokenManager) load() (*Token, error) {
+	token, err := manager.store.LoadAppToken()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (manager *AppTokenManager) usable(token *Token, margin time.Duration, rejected string) bool {
+	if token == nil || (rejected != "" && token.Access == rejected) {
+		return false
+	}
+	return token.ExpiresAt.After(manager.clock.Now().Add(margin))
+}
+
+func (manager *AppTokenManager) randomJitter() time.Duration {
+	if manager.jitter <= 0 {
+		return 0
+	}
+	return rand.N(manager.jitter)
+}
+
+func (manager *AppTokenManager) retryDelay(failures int) time.Duration {
+	delay := manager.retryBase
+	for i := 0; i < failures && delay < manager.retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, manager.retryMax)
 }
@@ -0,0 +1,321 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sharedStore имитирует хранилище, общее для нескольких процессов, с блокировкой.
+type sharedStore struct {
+	mu      sync.Mutex
+	lock    sync.Mutex
+	app     *Token
+	user    *UserToken
+	onLock  func()
+	lockLog []string
+}
+
+func (s *sharedStore) LoadAppToken() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.app == nil {
+		return nil, os.ErrNotExist
+	}
+	token := *s.app
+	return &token, nil
+}
+
+func (s *sharedStore) SaveAppToken(token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.app = &token
+	return nil
+}
+
+func (s *sharedStore) LoadUserToken() (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.user == nil {
+		return nil, os.ErrNotExist
+	}
+	token := *s.user
+	return &token, nil
+}
+
+func (s *sharedStore) SaveUserToken(token UserToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = &token
+	return nil
+}
+
+func (s *sharedStore) LockToken(_ context.Context, kind string) (func(), error) {
+	s.lock.Lock()
+	s.mu.Lock()
+	s.lockLog = append(s.lockLog, kind)
+	s.mu.Unlock()
+	if s.onLock != nil {
+		s.onLock()
+	}
+	return s.lock.Unlock, nil
+}
+
+func TestAppTokenManagersShareRefreshThroughLocker(t *testing.T) {
+	store := &sharedStore{}
+	var fetches atomic.Int32
+	fetch := func(context.Context) (string, time.Duration, error) {
+		fetches.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return "app-token", time.Hour, nil
+	}
+
+	// Несколько менеджеров — как несколько реплик с общим хранилищем.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		manager := NewAppTokenManager(store, fetch, AppTokenManagerConfig{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := manager.Get(context.Background())
+			if err != nil || token.Access != "app-token" {
+				t.Errorf("Get: %+v, %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches.Load() != 1 {
+		t.Fatalf("expected a single refresh across managers, got %d", fetches.Load())
+	}
+	if len(store.lockLog) == 0 || store.lockLog[0] != AppTokenKind {
+		t.Fatalf("expected lock on %q, got %v", AppTokenKind, store.lockLog)
+	}
+}
+
+func TestUserTokenRefresherPicksUpTokenRefreshedElsewhere(t *testing.T) {
+	store := &sharedStore{user: &UserToken{Access: "old", Refresh: "r1", ExpiresAt: time.Now().Add(time.Minute)}}
+	refresher := NewUserTokenRefresher(store, func(context.Context, string) (UserToken, error) {
+		t.Fatal("token refreshed by another process must not be refreshed again")
+		return UserToken{}, nil
+	}, 10*time.Minute)
+
+	// Пока refresher ждёт блокировку, другой процесс обновляет токен.
+	store.onLock = func() {
+		store.user = &UserToken{Access: "new", Refresh: "r2", ExpiresAt: time.Now().Add(4 * time.Hour)}
+	}
+
+	var notified []string
+	refresher.OnRefresh(func(token UserToken) { notified = append(notified, token.Access) })
+
+	token, err := refresher.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if token.Access != "new" || token.Refresh != "r2" {
+		t.Fatalf("expected token from the store, got %+v", token)
+	}
+	if len(notified) != 1 || notified[0] != "new" {
+		t.Fatalf("subscribers must learn about the new token, got %v", notified)
+	}
+}
+
+// fakeClock — Clock, время которого двигает тест.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), waiting: make(chan time.Duration, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	}
+	c.waiting <- d
+	return ch
+}
+
+// Advance сдвигает время и срабатывает таймеры, срок которых наступил.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// nextWait ждёт, пока фоновый цикл не заснёт, и возвращает длительность сна.
+func (c *fakeClock) nextWait(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.waiting:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("manager did not schedule the next refresh")
+		return 0
+	}
+}
+
+func TestAppTokenManagerUsesMarginAndClock(t *testing.T) {
+	clock := newFakeClock()
+	store := &sharedStore{app: &Token{Access: "stored", ExpiresAt: clock.Now().Add(10 * time.Minute)}}
+	var fetches atomic.Int32
+	manager := NewAppTokenManager(store, func(context.Context) (string, time.Duration, error) {
+		fetches.Add(1)
+		return "fresh", time.Hour, nil
+	}, AppTokenManagerConfig{Margin: 8 * time.Minute, Clock: clock})
+
+	token, err := manager.Get(context.Background())
+	if err != nil || token.Access != "stored" {
+		t.Fatalf("Get: %+v, %v", token, err)
+	}
+
+	clock.Advance(3 * time.Minute)
+	token, err = manager.Get(context.Background())
+	if err != nil || token.Access != "fresh" || fetches.Load() != 1 {
+		t.Fatalf("expected refresh within the margin, got %+v, %v, %d fetches", token, err, fetches.Load())
+	}
+	if !token.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("expiry must come from the clock, got %s", token.ExpiresAt)
+	}
+}
+
+func TestAppTokenManagerRefreshesAheadOfExpiry(t *testing.T) {
+	clock := newFakeClock()
+	store := &sharedStore{}
+	var fetches atomic.Int32
+	manager := NewAppTokenManager(store, func(context.Context) (string, time.Duration, error) {
+		n := fetches.Add(1)
+		return "token-" + string(rune('0'+n)), time.Hour, nil
+	}, AppTokenManagerConfig{Margin: 5 * time.Minute, Jitter: -1, Clock: clock})
+
+	refreshed := make(chan string, 4)
+	manager.OnRefresh(func(token Token) { refreshed <- token.Access })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	if wait := clock.nextWait(t); wait != 55*time.Minute {
+		t.Fatalf("expected to sleep until margin before expiry, got %s", wait)
+	}
+	if access := <-refreshed; access != "token-1" {
+		t.Fatalf("unexpected first token %q", access)
+	}
+
+	clock.Advance(54 * time.Minute)
+	if fetches.Load() != 1 {
+		t.Fatalf("refreshed too early: %d fetches", fetches.Load())
+	}
+
+	clock.Advance(time.Minute)
+	clock.nextWait(t)
+	if access := <-refreshed; access != "token-2" || fetches.Load() != 2 {
+		t.Fatalf("expected proactive refresh, got %q after %d fetches", access, fetches.Load())
+	}
+}
+
+func TestAppTokenManagerRetriesWithBackoff(t *testing.T) {
+	clock := newFakeClock()
+	var fetches atomic.Int32
+	manager := NewAppTokenManager(&sharedStore{}, func(context.Context) (string, time.Duration, error) {
+		if fetches.Add(1) <= 3 {
+			return "", 0, os.ErrDeadlineExceeded
+		}
+		return "token", time.Hour, nil
+	}, AppTokenManagerConfig{Jitter: -1, RetryBase: time.Second, RetryMax: 3 * time.Second, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	var waits []time.Duration
+	for i := 0; i < 4; i++ {
+		wait := clock.nextWait(t)
+		waits = append(waits, wait)
+		clock.Advance(wait)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 55 * time.Minute}
+	for i := range expected {
+		if waits[i] != expected[i] {
+			t.Fatalf("expected waits %v, got %v", expected, waits)
+		}
+	}
+}
+
+func TestAppTokenManagerJitterRefreshesEarlier(t *testing.T) {
+	clock := newFakeClock()
+	manager := NewAppTokenManager(&sharedStore{}, func(context.Context) (string, time.Duration, error) {
+		return "token", time.Hour, nil
+	}, AppTokenManagerConfig{Margin: 5 * time.Minute, Jitter: 10 * time.Minute, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	wait := clock.nextWait(t)
+	if wait <= 45*time.Minute || wait > 55*time.Minute {
+		t.Fatalf("expected wait within jitter window, got %s", wait)
+	}
+
+	// После сна с учётом сдвига токен обновляется, хотя до Margin ещё есть время.
+	clock.Advance(wait)
+	clock.nextWait(t)
+	token, err := manager.Get(context.Background())
+	if err != nil || !token.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("expected token refreshed at %s, got %+v, %v", clock.Now(), token, err)
+	}
+}
+
+func TestAppTokenManagerDoesNotSpinOnShortLivedTokens(t *testing.T) {
+	clock := newFakeClock()
+	var fetches atomic.Int32
+	manager := NewAppTokenManager(&sharedStore{}, func(context.Context) (string, time.Duration, error) {
+		fetches.Add(1)
+		return "short", 4 * time.Minute, nil
+	}, AppTokenManagerConfig{Margin: 10 * time.Minute, Jitter: -1, RetryBase: time.Second, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	for i := 1; i <= 3; i++ {
+		wait := clock.nextWait(t)
+		if wait != 2*time.Minute || fetches.Load() != int32(i) {
+			t.Fatalf("refresh %d: expected to wait half the lifetime, got %s after %d fetches", i, wait, fetches.Load())
+		}
+		clock.Advance(wait)
+	}
+}
@@ -1,6 +1,15 @@
 package tokens
 
-import "time"
+import (
+	"context"
+	"time"
+)
+
+// Виды токенов. Входят в Key и используются как ключ блокировки в TokenLocker.
+const (
+	AppTokenKind  = "app"
+	UserTokenKind = "user"
+)
 
 // Token описывает OAuth токен приложения.
 type Token struct {
@@ -13,3 +22,36 @@ type TokenStore interface {
 	LoadAppToken() (*Token, error)
 	SaveAppToken(Token) error
 }
+
+// UserToken описывает OAuth токен пользователя (бота) с refresh token и скоупами.
+type UserToken struct {
+	Access    string
+	Refresh   string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// UserTokenStore описывает хранилище токена пользователя.
+type UserTokenStore interface {
+	LoadUserToken() (*UserToken, error)
+	SaveUserToken(UserToken) error
+}
+
+// TokenLocker реализуется хранилищами, общими для нескольких процессов.
+// Перед обновлением токена менеджеры берут блокировку на его вид и
+// перечитывают токен: если его уже обновил другой процесс, используется он.
+type TokenLocker interface {
+	LockToken(ctx context.Context, kind string) (unlock func(), err error)
+}
+
+// StaticToken — токен, который не обновляется, например заданный через переменную окружения.
+// Реализует тот же метод Get, что и AppTokenManager.
+type StaticToken Token
+
+// Get возвращает токен как есть.
+func (t StaticToken) Get(ctx context.Context) (Token, error) {
+	if err := ctx.Err(); err != nil {
+		return Token{}, err
+	}
+	return Token(t), nil
+}
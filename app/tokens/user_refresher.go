@@ -0,0 +1,252 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserRefreshMargin = 10 * time.Minute
+	userRefreshRetry         = 30 * time.Second
+)
+
+// ErrNoUserToken возвращается, если токена пользователя нет ни в кеше, ни в хранилище.
+var ErrNoUserToken = errors.New("user token not found")
+
+// UserTokenRefreshFunc обновляет токен пользователя по refresh token.
+type UserTokenRefreshFunc func(ctx context.Context, refreshToken string) (UserToken, error)
+
+// UserTokenRefresher обновляет токен пользователя до истечения срока,
+// сохраняет его в хранилище и уведомляет подписчиков.
+type UserTokenRefresher struct {
+	store   UserTokenStore
+	refresh UserTokenRefreshFunc
+	margin  time.Duration
+	logger  *slog.Logger
+
+	mu          sync.Mutex
+	token       *UserToken
+	subscribers []func(UserToken)
+}
+
+// NewUserTokenRefresher создаёт refresher; margin <= 0 означает запас по умолчанию (10 минут).
+func NewUserTokenRefresher(store UserTokenStore, refresh UserTokenRefreshFunc, margin time.Duration) *UserTokenRefresher {
+	if margin <= 0 {
+		margin = defaultUserRefreshMargin
+	}
+	return &UserTokenRefresher{store: store, refresh: refresh, margin: margin, logger: slog.Default().With("component", "tokens")}
+}
+
+// OnRefresh регистрирует колбэк, который получает каждый обновлённый токен.
+func (r *UserTokenRefresher) OnRefresh(fn func(UserToken)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Seed сохраняет начальный токен, если в хранилище ещё нет токена пользователя.
+func (r *UserTokenRefresher) Seed(token UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.loadLocked(); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrNoUserToken) {
+		return err
+	}
+
+	if err := r.store.SaveUserToken(token); err != nil {
+		return err
+	}
+	r.token = &token
+	return nil
+}
+
+// Current возвращает токен пользователя, обновляя его, если срок подходит к концу.
+func (r *UserTokenRefresher) Current(ctx context.Context) (UserToken, error) {
+	return r.current(ctx, false, "")
+}
+
+// ForceRefresh обновляет токен независимо от срока действия — например, когда
+// сервер сообщил, что текущий токен отозван.
+func (r *UserTokenRefresher) ForceRefresh(ctx context.Context) (UserToken, error) {
+	return r.current(ctx, true, "")
+}
+
+// Get возвращает access token в виде Token — так refresher можно передать
+// туда же, куда и AppTokenManager (например, в EventSub).
+func (r *UserTokenRefresher) Get(ctx context.Context) (Token, error) {
+	token, err := r.Current(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Access: token.Access, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// AccessTokens возвращает refresher как источник access token с заменой
+// отвергнутого токена — с тем же ForceRefresh, что у AppTokenManager, так
+// что helix.Client с токеном пользователя тоже обновляет его на 401.
+func (r *UserTokenRefresher) AccessTokens() UserAccessTokens {
+	return UserAccessTokens{refresher: r}
+}
+
+// UserAccessTokens — UserTokenRefresher в виде источника Token.
+type UserAccessTokens struct {
+	refresher *UserTokenRefresher
+}
+
+// Get возвращает текущий access token пользователя.
+func (t UserAccessTokens) Get(ctx context.Context) (Token, error) {
+	return t.refresher.Get(ctx)
+}
+
+// ForceRefresh заменяет токен rejected, который отверг сервер. Если токен уже
+// заменён, возвращается новый без повторного обновления.
+func (t UserAccessTokens) ForceRefresh(ctx context.Context, rejected string) (Token, error) {
+	token, err := t.refresher.current(ctx, true, rejected)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Access: token.Access, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// Run обновляет токен за margin до истечения, но не чаще раза в 30 секунд,
+// и блокируется до отмены контекста. Неудачное обновление повторяется
+// каждые 30 секунд.
+func (r *UserTokenRefresher) Run(ctx context.Context) error {
+	for {
+		wait := userRefreshRetry
+		token, err := r.Current(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			r.logger.Warn("не удалось обновить токен пользователя", "err", err)
+		default:
+			// Токен, живущий меньше margin, обновлялся бы без остановки.
+			wait = max(time.Until(token.ExpiresAt.Add(-r.margin)), userRefreshRetry)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// current возвращает токен, обновляя его при скором истечении или по force.
+// Если задан rejected, принудительно обновляется только он: уже заменённый
+// токен возвращается как есть.
+func (r *UserTokenRefresher) current(ctx context.Context, force bool, rejected string) (UserToken, error) {
+	if err := ctx.Err(); err != nil {
+		return UserToken{}, err
+	}
+
+	r.mu.Lock()
+	token, err := r.loadLocked()
+	if err != nil {
+		r.mu.Unlock()
+		return UserToken{}, err
+	}
+	forced := force && (rejected == "" || token.Access == rejected)
+	if !forced && !r.expiring(*token) {
+		r.mu.Unlock()
+		return *token, nil
+	}
+
+	if locker, ok := r.store.(TokenLocker); ok {
+		unlock, err := locker.LockToken(ctx, UserTokenKind)
+		if err != nil {
+			r.mu.Unlock()
+			return UserToken{}, err
+		}
+		defer unlock()
+
+		// Другой процесс мог уже обновить токен, пока мы ждали блокировку.
+		stored, err := r.store.LoadUserToken()
+		if err != nil {
+			r.mu.Unlock()
+			return UserToken{}, err
+		}
+		if stored.Access != token.Access && !r.expiring(*stored) {
+			r.token = stored
+			subscribers := r.subscribersLocked()
+			r.mu.Unlock()
+			notify(subscribers, *stored)
+			return *stored, nil
+		}
+		token = stored
+	}
+
+	refreshed, err := r.refreshLocked(ctx, *token)
+	subscribers := r.subscribersLocked()
+	r.mu.Unlock()
+	if err != nil {
+		return UserToken{}, err
+	}
+
+	notify(subscribers, refreshed)
+	return refreshed, nil
+}
+
+func (r *UserTokenRefresher) expiring(token UserToken) bool {
+	return token.ExpiresAt.Before(time.Now().Add(r.margin))
+}
+
+func (r *UserTokenRefresher) subscribersLocked() []func(UserToken) {
+	return append(make([]func(UserToken), 0, len(r.subscribers)), r.subscribers...)
+}
+
+func (r *UserTokenRefresher) loadLocked() (*UserToken, error) {
+	if r.token != nil {
+		return r.token, nil
+	}
+
+	token, err := r.store.LoadUserToken()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoUserToken
+		}
+		return nil, err
+	}
+	r.token = token
+	return token, nil
+}
+
+func (r *UserTokenRefresher) refreshLocked(ctx context.Context, current UserToken) (UserToken, error) {
+	if current.Refresh == "" {
+		return UserToken{}, fmt.Errorf("refresh user token: refresh token is empty")
+	}
+
+	refreshed, err := r.refresh(ctx, current.Refresh)
+	if err != nil {
+		return UserToken{}, fmt.Errorf("refresh user token: %w", err)
+	}
+	if refreshed.Refresh == "" {
+		refreshed.Refresh = current.Refresh
+	}
+	if len(refreshed.Scopes) == 0 {
+		refreshed.Scopes = current.Scopes
+	}
+
+	if err := r.store.SaveUserToken(refreshed); err != nil {
+		return UserToken{}, err
+	}
+	r.token = &refreshed
+
+	return refreshed, nil
+}
+
+func notify(subscribers []func(UserToken), token UserToken) {
+	for _, fn := range subscribers {
+		fn(token)
+	}
+}
@@ -0,0 +1,127 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+type memoryUserStore struct {
+	token *UserToken
+	saves int
+}
+
+func (s *memoryUserStore) LoadUserToken() (*UserToken, error) {
+	if s.token == nil {
+		return nil, os.ErrNotExist
+	}
+	token := *s.token
+	return &token, nil
+}
+
+func (s *memoryUserStore) SaveUserToken(token UserToken) error {
+	s.token = &token
+	s.saves++
+	return nil
+}
+
+func TestUserTokenRefresherRefreshesBeforeExpiry(t *testing.T) {
+	store := &memoryUserStore{token: &UserToken{
+		Access:    "old",
+		Refresh:   "refresh-1",
+		Scopes:    []string{"chat:read"},
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+	}}
+
+	var gotRefresh string
+	refresher := NewUserTokenRefresher(store, func(_ context.Context, refresh string) (UserToken, error) {
+		gotRefresh = refresh
+		return UserToken{Access: "new", ExpiresAt: time.Now().Add(4 * time.Hour)}, nil
+	}, 10*time.Minute)
+
+	var notified []string
+	refresher.OnRefresh(func(token UserToken) { notified = append(notified, token.Access) })
+
+	token, err := refresher.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if token.Access != "new" || gotRefresh != "refresh-1" {
+		t.Fatalf("unexpected refresh: token=%+v refresh=%q", token, gotRefresh)
+	}
+	if token.Refresh != "refresh-1" || len(token.Scopes) != 1 {
+		t.Fatalf("refresh token and scopes should be kept, got %+v", token)
+	}
+	if store.token.Access != "new" {
+		t.Fatalf("refreshed token not saved: %+v", store.token)
+	}
+	if len(notified) != 1 || notified[0] != "new" {
+		t.Fatalf("expected one notification, got %v", notified)
+	}
+
+	if _, err := refresher.Current(context.Background()); err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if store.saves != 1 {
+		t.Fatalf("fresh token should not be refreshed again, saves=%d", store.saves)
+	}
+}
+
+func TestUserTokenRefresherSeedKeepsStoredToken(t *testing.T) {
+	store := &memoryUserStore{token: &UserToken{Access: "stored", Refresh: "r", ExpiresAt: time.Now().Add(time.Hour)}}
+	refresher := NewUserTokenRefresher(store, nil, 0)
+
+	if err := refresher.Seed(UserToken{Access: "env", Refresh: "r2"}); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	token, err := refresher.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if token.Access != "stored" {
+		t.Fatalf("seed must not overwrite stored token, got %q", token.Access)
+	}
+}
+
+func TestUserTokenRefresherWithoutToken(t *testing.T) {
+	refresher := NewUserTokenRefresher(&memoryUserStore{}, nil, 0)
+	if _, err := refresher.Current(context.Background()); err != ErrNoUserToken {
+		t.Fatalf("expected ErrNoUserToken, got %v", err)
+	}
+}
+
+func TestUserTokenRefresherForceRefresh(t *testing.T) {
+	store := &memoryUserStore{token: &UserToken{Access: "revoked", Refresh: "r", ExpiresAt: time.Now().Add(3 * time.Hour)}}
+	refresher := NewUserTokenRefresher(store, func(_ context.Context, _ string) (UserToken, error) {
+		return UserToken{Access: "fresh", ExpiresAt: time.Now().Add(4 * time.Hour)}, nil
+	}, 0)
+
+	token, err := refresher.ForceRefresh(context.Background())
+	if err != nil {
+		t.Fatalf("ForceRefresh: %v", err)
+	}
+	if token.Access != "fresh" || store.token.Access != "fresh" {
+		t.Fatalf("token was not refreshed: %+v", token)
+	}
+}
+
+func TestUserAccessTokensRefreshOnlyRejectedToken(t *testing.T) {
+	store := &memoryUserStore{token: &UserToken{Access: "revoked", Refresh: "r", ExpiresAt: time.Now().Add(3 * time.Hour)}}
+	refreshes := 0
+	refresher := NewUserTokenRefresher(store, func(_ context.Context, _ string) (UserToken, error) {
+		refreshes++
+		return UserToken{Access: "fresh", ExpiresAt: time.Now().Add(4 * time.Hour)}, nil
+	}, 0)
+	source := refresher.AccessTokens()
+
+	token, err := source.ForceRefresh(context.Background(), "revoked")
+	if err != nil || token.Access != "fresh" {
+		t.Fatalf("ForceRefresh: %+v, %v", token, err)
+	}
+	// Токен уже заменён другим запросом — повторного обновления нет.
+	token, err = source.ForceRefresh(context.Background(), "revoked")
+	if err != nil || token.Access != "fresh" || refreshes != 1 {
+		t.Fatalf("expected the replaced token without a refresh, got %+v, %v, %d refreshes", token, err, refreshes)
+	}
+}
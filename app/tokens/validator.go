@@ -0,0 +1,66 @@
+package tokens
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DefaultValidateInterval — как часто проверять токен на сервере; Twitch требует
+// проверять user token не реже раза в час.
+const DefaultValidateInterval = time.Hour
+
+// TokenSource возвращает актуальный токен: StaticToken, AppTokenManager или UserTokenRefresher.
+type TokenSource interface {
+	Get(ctx context.Context) (Token, error)
+}
+
+// ValidateFunc проверяет access token на сервере. Реакция на отозванный токен
+// (обновление, остановка) остаётся на стороне вызывающего кода.
+type ValidateFunc func(ctx context.Context, accessToken string) error
+
+// Validator периодически проверяет токен из source через validate.
+type Validator struct {
+	source   TokenSource
+	validate ValidateFunc
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewValidator создаёт проверку токена; interval <= 0 означает раз в час.
+func NewValidator(source TokenSource, validate ValidateFunc, interval time.Duration) *Validator {
+	if interval <= 0 {
+		interval = DefaultValidateInterval
+	}
+	return &Validator{source: source, validate: validate, interval: interval, logger: slog.Default().With("component", "tokens")}
+}
+
+// Run проверяет токен сразу и затем каждые interval до отмены контекста.
+func (v *Validator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		v.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (v *Validator) check(ctx context.Context) {
+	token, err := v.source.Get(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			v.logger.Warn("не удалось получить токен для проверки", "err", err)
+		}
+		return
+	}
+
+	if err := v.validate(ctx, token.Access); err != nil && ctx.Err() == nil {
+		v.logger.Warn("проверка токена не прошла", "err", err)
+	}
+}
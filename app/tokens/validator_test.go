@@ -0,0 +1,36 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatorChecksImmediatelyAndPeriodically(t *testing.T) {
+	checked := make(chan string, 4)
+	validator := NewValidator(StaticToken{Access: "abc"}, func(_ context.Context, access string) error {
+		checked <- access
+		return errors.New("revoked")
+	}, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- validator.Run(ctx) }()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case access := <-checked:
+			if access != "abc" {
+				t.Fatalf("unexpected token %q", access)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("validation %d did not happen", i+1)
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
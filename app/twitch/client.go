@@ -2,78 +2,441 @@ package twitch
 
 import (
 	"context"
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	twitchirc "github.com/gempir/go-twitch-irc/v4"
-
 	"twitch-chat-logger/config"
 	"twitch-chat-logger/model"
 )
 
+const (
+	reasonServerReconnect = "server RECONNECT"
+	reasonConnectionLost  = "connection lost"
+	reasonShutdown        = "shutdown"
+	reasonTokenRefreshed  = "token refreshed"
+)
+
 // Handler принимает Twitch-события, преобразованные в доменные модели.
 type Handler interface {
 	HandleChat(context.Context, model.ChatMessage)
 	HandleNotice(context.Context, model.Notice)
+	HandleSession(context.Context, model.ConnectionSession)
+	HandleGap(context.Context, model.ChatGap)
+}
+
+// RoomHandler реализуется Handler, которому нужен id канала: NewClient
+// передаёт в HandleRoom каждый канал при первом ROOMSTATE и при смене логина
+// или id.
+type RoomHandler interface {
+	HandleRoom(context.Context, model.Room)
+}
+
+// MembershipHandler реализуется Handler, которому нужны JOIN/PART зрителей
+// (twitch.tv/membership). Собственные JOIN/PART бота сюда не попадают.
+type MembershipHandler interface {
+	HandleMembership(context.Context, model.Membership)
 }
 
-// Client оборачивает go-twitch-irc и настраивает обработчики.
+// ConnectionStats — счётчики подключений и здоровья соединения с момента запуска.
+// Received — число полученных сообщений чата по каналам. Connected сообщает,
+// открыта ли сессия, а NotJoined — каналы, в которые бот в этой сессии ещё не вошёл.
+type ConnectionStats struct {
+	Sessions   uint64
+	Reconnects uint64
+	Gaps       uint64
+	Received   map[string]uint64
+	Connected  bool
+	NotJoined  []string
+	Health     HealthStats
+}
+
+// transport — низкоуровневое подключение к Twitch IRC. Connect блокируется до
+// разрыва соединения и возвращает nil, если был вызван Disconnect.
+// Drop рвёт текущее соединение, не запрещая переподключение.
+type transport interface {
+	Connect() error
+	Disconnect()
+	Drop()
+	Join(channels ...string)
+	Ping() error
+	Say(channel, text string) error
+	Reply(channel, parentID, text string) error
+	SetToken(token string)
+	Server() string
+}
+
+// transportEvents — колбэки, через которые транспорт передаёт события в Client.
+// onTraffic вызывается для входящих строк, не попавших в остальные колбэки.
+type transportEvents struct {
+	onConnect   func()
+	onReconnect func()
+	onSelfJoin  func(channel string)
+	onChat      func(model.ChatMessage)
+	onNotice    func(model.Notice)
+	onPingSent  func()
+	onPong      func()
+	onTraffic   func()
+	// onUserState получает бэйджи бота в канале (USERSTATE),
+	// onGlobalUserState — его user-id и отображаемое имя (GLOBALUSERSTATE),
+	// onRoomState — id канала (ROOMSTATE).
+	onUserState       func(channel string, badges map[string]int)
+	onRoomState       func(channel, roomID string)
+	onGlobalUserState func(userID, displayName string)
+	// onMembership получает JOIN/PART других пользователей.
+	onMembership func(model.Membership)
+}
+
+// Client подключается к Twitch IRC через выбранный транспорт и передаёт события в Handler.
 type Client struct {
-	client   *twitchirc.Client
-	handler  Handler
-	channels []string
-	baseCtx  context.Context
+	transport transport
+	handler   Handler
+	channels  []string
+	reconnect config.ReconnectConfig
+	health    *healthMonitor
+	limiter   *sendLimiter
+	router    *Router
+	logger    *slog.Logger
+	baseCtx   context.Context
+
+	mu            sync.Mutex
+	session       *model.ConnectionSession
+	pendingReason string
+	gaps          map[string]model.ChatGap
+	self          model.ChatMessage // автор исходящих сообщений
+	privileged    map[string]bool   // каналы, где бот модератор, VIP или владелец
+	rooms         map[string]string // логин канала -> room-id
+	received      map[string]uint64 // логин канала -> полученные сообщения
+	joined        map[string]bool   // каналы, в которые бот вошёл в текущей сессии
+
+	sessions   atomic.Uint64
+	reconnects atomic.Uint64
+	gapCount   atomic.Uint64
 }
 
-// NewClient инициализирует IRC-клиент и регистрирует колбэки.
-func NewClient(cfg config.TwitchConfig, handler Handler) *Client {
-	client := twitchirc.NewClient(cfg.Username, cfg.OAuthToken)
+// NewClient инициализирует IRC-клиент с транспортом из cfg.Transport.
+// nil logger — slog.Default().
+func NewClient(cfg config.TwitchConfig, handler Handler, logger *slog.Logger) *Client {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("component", "twitch")
 
 	c := &Client{
-		client:   client,
-		handler:  handler,
-		channels: cfg.Channels,
+		handler:   handler,
+		channels:  normalizeChannels(cfg.Channels),
+		reconnect: cfg.Reconnect,
+		logger:    logger,
+		health:    newHealthMonitor(cfg.Health, logger),
+		limiter:   newSendLimiter(),
+		gaps:      make(map[string]model.ChatGap),
+		self: model.ChatMessage{
+			Username:    strings.ToLower(cfg.Username),
+			DisplayName: cfg.Username,
+		},
+		privileged: make(map[string]bool),
+		rooms:      make(map[string]string),
+		received:   make(map[string]uint64),
+		joined:     make(map[string]bool),
 	}
 
-	client.OnPrivateMessage(func(m twitchirc.PrivateMessage) {
-		c.handler.HandleChat(c.context(), toChatMessage(m))
-	})
+	// Блоки настроек каналов переопределяют префикс команд и порог тишины.
+	prefixes := make(map[string]string)
+	commands := cfg.CommandPrefix != ""
+	c.health.silence = make(map[string]time.Duration)
+	for channel, opts := range cfg.Options {
+		if opts.CommandPrefix != nil {
+			prefixes[channel] = *opts.CommandPrefix
+			commands = commands || *opts.CommandPrefix != ""
+		}
+		if opts.ChannelSilence > 0 {
+			c.health.silence[channel] = opts.ChannelSilence
+		}
+	}
+
+	if registrar, ok := handler.(CommandRegistrar); ok && commands {
+		c.router = NewRouter(cfg.CommandPrefix)
+		c.router.prefixes = prefixes
+		registrar.RegisterCommands(c.router)
+	}
 
-	client.OnConnect(func() {
-		log.Printf("twitch: подключено, подписка на каналы: %v", cfg.Channels)
-		for _, ch := range cfg.Channels {
-			if ch == "" {
-				continue
+	events := transportEvents{
+		onConnect: func() {
+			c.startSession(time.Now().UTC())
+
+			logger.Info("подключено, подписка на каналы", "channels", c.channels)
+			for _, ch := range c.channels {
+				c.transport.Join(ch)
 			}
-			client.Join(ch)
-		}
-	})
+		},
+		onReconnect: func() {
+			logger.Info("сервер запросил RECONNECT")
+			c.mu.Lock()
+			c.pendingReason = reasonServerReconnect
+			c.mu.Unlock()
+		},
+		onSelfJoin: func(channel string) {
+			now := time.Now().UTC()
+			c.health.joined(channel, now)
+			c.mu.Lock()
+			c.joined[channel] = true
+			c.mu.Unlock()
+			c.closeGap(channel, now)
+		},
+		onChat: func(msg model.ChatMessage) {
+			if msg.RoomID == "" {
+				msg.RoomID = c.roomID(msg.Channel)
+			}
+			c.health.chat(msg.Channel, time.Now().UTC())
+			c.mu.Lock()
+			c.received[msg.Channel]++
+			c.mu.Unlock()
+			c.handler.HandleChat(c.context(), msg)
+			c.dispatch(c.context(), msg)
+		},
+		onNotice: func(notice model.Notice) {
+			if notice.RoomID == "" {
+				notice.RoomID = c.roomID(notice.Channel)
+			}
+			c.health.traffic(time.Now().UTC())
+			c.handler.HandleNotice(c.context(), notice)
+		},
+		onMembership: func(membership model.Membership) {
+			membership.RoomID = c.roomID(membership.Channel)
+			c.health.traffic(time.Now().UTC())
+			if members, ok := handler.(MembershipHandler); ok {
+				members.HandleMembership(c.context(), membership)
+			}
+		},
+		onPingSent: func() {
+			c.health.pingSent(time.Now().UTC())
+		},
+		onPong: func() {
+			c.health.pong(time.Now().UTC())
+		},
+		onTraffic: func() {
+			c.health.traffic(time.Now().UTC())
+		},
+		onUserState: func(channel string, badges map[string]int) {
+			c.health.traffic(time.Now().UTC())
+			c.mu.Lock()
+			c.privileged[channel] = badges["moderator"] > 0 || badges["vip"] > 0 || badges["broadcaster"] > 0
+			c.mu.Unlock()
+		},
+		onRoomState: func(channel, roomID string) {
+			c.health.traffic(time.Now().UTC())
+			if roomID == "" {
+				return
+			}
+			c.mu.Lock()
+			known := c.rooms[channel] == roomID
+			c.rooms[channel] = roomID
+			c.mu.Unlock()
 
-	client.OnReconnectMessage(func(message twitchirc.ReconnectMessage) {
-		log.Printf("twitch: сервер запросил RECONNECT: %+v", message)
-	})
+			if rooms, ok := handler.(RoomHandler); ok && !known {
+				rooms.HandleRoom(c.context(), model.Room{ID: roomID, Channel: channel, SeenAt: time.Now().UTC()})
+			}
+		},
+		onGlobalUserState: func(userID, displayName string) {
+			c.health.traffic(time.Now().UTC())
+			c.mu.Lock()
+			c.self.UserID = userID
+			if displayName != "" {
+				c.self.DisplayName = displayName
+			}
+			c.mu.Unlock()
+		},
+	}
 
-	client.OnNoticeMessage(func(msg twitchirc.NoticeMessage) {
-		c.handler.HandleNotice(c.context(), toNotice(msg))
-	})
+	switch cfg.Transport {
+	case config.TransportWebSocket:
+		c.transport = newWSTransport(cfg, events, logger)
+	default:
+		c.transport = newGempirTransport(cfg, events)
+	}
 
 	return c
 }
 
-// Run подключает клиента и блокируется до отмены контекста или ошибки.
+// Run подключает клиента и блокируется до отмены контекста или исчерпания попыток переподключения.
 func (c *Client) Run(ctx context.Context) error {
 	c.baseCtx = ctx
+
+	if c.health.enabled() {
+		monitorCtx, stopMonitor := context.WithCancel(ctx)
+		defer stopMonitor()
+		go c.monitor(monitorCtx)
+	}
+
+	attempt := 0
+	for {
+		sessionsBefore := c.sessions.Load()
+
+		err := c.connect(ctx)
+		if ctx.Err() != nil {
+			c.endSession(time.Now().UTC(), reasonShutdown)
+			return ctx.Err()
+		}
+
+		c.mu.Lock()
+		reason := c.pendingReason
+		c.pendingReason = ""
+		c.mu.Unlock()
+		switch {
+		case reason != "":
+		case err != nil:
+			reason = err.Error()
+		default:
+			reason = reasonConnectionLost
+		}
+		c.endSession(time.Now().UTC(), reason)
+
+		if c.sessions.Load() != sessionsBefore {
+			attempt = 0
+		}
+		attempt++
+
+		if c.reconnect.MaxAttempts > 0 && attempt > c.reconnect.MaxAttempts {
+			return fmt.Errorf("twitch: исчерпаны попытки переподключения (%d): %w", c.reconnect.MaxAttempts, err)
+		}
+
+		delay := c.reconnect.Delay(attempt)
+		c.logger.Warn("соединение потеряно", "err", err, "attempt", attempt, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Stats возвращает текущие счётчики подключений и здоровья соединения.
+func (c *Client) Stats() ConnectionStats {
+	c.mu.Lock()
+	received := make(map[string]uint64, len(c.received))
+	for channel, count := range c.received {
+		received[channel] = count
+	}
+	connected := c.session != nil
+	var notJoined []string
+	for _, ch := range c.channels {
+		if !c.joined[ch] {
+			notJoined = append(notJoined, ch)
+		}
+	}
+	c.mu.Unlock()
+
+	return ConnectionStats{
+		Sessions:   c.sessions.Load(),
+		Reconnects: c.reconnects.Load(),
+		Gaps:       c.gapCount.Load(),
+		Received:   received,
+		Connected:  connected,
+		NotJoined:  notJoined,
+		Health:     c.health.stats(),
+	}
+}
+
+// SetToken заменяет OAuth токен IRC и переподключается с ним, если соединение активно.
+// Используется как колбэк обновления токена пользователя.
+func (c *Client) SetToken(token string) {
+	c.transport.SetToken(token)
+
+	c.mu.Lock()
+	connected := c.session != nil
+	if connected {
+		c.pendingReason = reasonTokenRefreshed
+	}
+	c.mu.Unlock()
+
+	if connected {
+		c.logger.Info("токен обновлён, переподключение")
+		c.transport.Drop()
+	}
+}
+
+// Say отправляет сообщение в канал, соблюдая лимиты Twitch на отправку,
+// и передаёт его в Handler как сообщение с IsSelf. Блокируется, пока лимит
+// не позволит отправку, или до отмены контекста.
+func (c *Client) Say(ctx context.Context, channel, text string) error {
+	return c.send(ctx, channel, "", text)
+}
+
+// Reply отвечает на сообщение parentID в канале; ограничения те же, что у Say.
+func (c *Client) Reply(ctx context.Context, channel, parentID, text string) error {
+	return c.send(ctx, channel, parentID, text)
+}
+
+func (c *Client) send(ctx context.Context, channel, parentID, text string) error {
+	channel = strings.ToLower(normalizeChannel(channel))
+	// Перевод строки завершает команду IRC — не даём тексту дописать свою.
+	text = strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(text))
+	if channel == "" || text == "" {
+		return fmt.Errorf("twitch: пустой канал или текст сообщения")
+	}
+
+	c.mu.Lock()
+	limit := sendLimitUser
+	if c.privileged[channel] {
+		limit = sendLimitPrivileged
+	}
+	c.mu.Unlock()
+
+	if err := c.limiter.wait(ctx, limit); err != nil {
+		return err
+	}
+
+	var err error
+	if parentID != "" {
+		err = c.transport.Reply(channel, parentID, text)
+	} else {
+		err = c.transport.Say(channel, text)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	msg := c.self
+	c.mu.Unlock()
+	msg.ID = "self-" + randomID()
+	msg.Channel = channel
+	msg.RoomID = c.roomID(channel)
+	msg.Text = text
+	msg.Badges = map[string]int{}
+	msg.SentAt = time.Now().UTC()
+	msg.IsSelf = true
+	c.handler.HandleChat(ctx, msg)
+
+	return nil
+}
+
+// roomID возвращает id канала из последнего ROOMSTATE.
+func (c *Client) roomID(channel string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rooms[strings.ToLower(channel)]
+}
+
+func (c *Client) connect(ctx context.Context) error {
 	errCh := make(chan error, 1)
 
 	go func() {
-		errCh <- c.client.Connect()
+		errCh <- c.transport.Connect()
 	}()
 
 	select {
 	case <-ctx.Done():
-		c.client.Disconnect()
+		c.transport.Disconnect()
 		<-errCh
 		return ctx.Err()
 	case err := <-errCh:
@@ -81,44 +444,113 @@ func (c *Client) Run(ctx context.Context) error {
 	}
 }
 
-func toChatMessage(m twitchirc.PrivateMessage) model.ChatMessage {
-	badges := make(map[string]int, len(m.User.Badges))
-	for k, v := range m.User.Badges {
-		badges[k] = v
+// startSession открывает новую сессию. Если предыдущая не закрыта, значит
+// транспорт переподключился сам (RECONNECT или таймаут PONG).
+func (c *Client) startSession(now time.Time) {
+	c.mu.Lock()
+	var previous *model.ConnectionSession
+	if c.session != nil {
+		reason := c.pendingReason
+		if reason == "" {
+			reason = reasonConnectionLost
+		}
+		previous = c.endSessionLocked(now, reason)
+	}
+
+	session := model.ConnectionSession{
+		ID:          randomID(),
+		Server:      c.transport.Server(),
+		ConnectedAt: now,
+	}
+	c.session = &session
+	c.pendingReason = ""
+	c.mu.Unlock()
+
+	c.health.reset(now)
+
+	if previous != nil {
+		c.handler.HandleSession(c.context(), *previous)
+	}
+	if c.sessions.Add(1) > 1 {
+		c.reconnects.Add(1)
 	}
+	c.handler.HandleSession(c.context(), session)
+}
 
-	sentAt := m.Time
-	if sentAt.IsZero() {
-		sentAt = time.Now().UTC()
+func (c *Client) endSession(now time.Time, reason string) {
+	c.mu.Lock()
+	if c.session == nil {
+		c.mu.Unlock()
+		return
 	}
+	session := c.endSessionLocked(now, reason)
+	c.mu.Unlock()
+
+	// При остановке контекст уже отменён, но закрыть сессию в БД всё равно нужно.
+	c.handler.HandleSession(context.WithoutCancel(c.context()), *session)
+}
+
+// endSessionLocked закрывает текущую сессию и открывает разрыв по каждому каналу.
+func (c *Client) endSessionLocked(now time.Time, reason string) *model.ConnectionSession {
+	session := *c.session
+	session.DisconnectedAt = now
+	session.Reason = reason
+	c.session = nil
+	c.joined = make(map[string]bool)
 
-	return model.ChatMessage{
-		ID:           m.ID,
-		Channel:      normalizeChannel(m.Channel),
-		UserID:       m.User.ID,
-		Username:     m.User.Name,
-		DisplayName:  m.User.DisplayName,
-		Text:         m.Message,
-		Badges:       badges,
-		Color:        m.User.Color,
-		IsMod:        m.User.Badges["moderator"] > 0 || m.User.Badges["broadcaster"] > 0,
-		IsSubscriber: m.User.Badges["subscriber"] > 0,
-		Bits:         m.Bits,
-		SentAt:       sentAt,
+	for _, ch := range c.channels {
+		if _, open := c.gaps[ch]; open {
+			continue
+		}
+		c.gaps[ch] = model.ChatGap{Channel: ch, StartedAt: now, Reason: reason}
 	}
+
+	return &session
 }
 
-func toNotice(msg twitchirc.NoticeMessage) model.Notice {
-	return model.Notice{
-		Channel:  normalizeChannel(msg.Channel),
-		ID:       msg.MsgID,
-		Message:  msg.Message,
-		Tags:     msg.Tags,
-		NoticeAt: noticeTimestamp(msg.Tags),
+// normalizeChannels приводит логины каналов к виду, в котором их присылает
+// сервер (нижний регистр, без "#"), чтобы разрывы и вход в канал сопоставлялись.
+func normalizeChannels(channels []string) []string {
+	out := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		ch = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ch), "#"))
+		if ch != "" {
+			out = append(out, ch)
+		}
 	}
+	return out
 }
 
-func noticeTimestamp(tags map[string]string) time.Time {
+// closeGap завершает разрыв канала, когда бот снова вошёл в него.
+func (c *Client) closeGap(channel string, now time.Time) {
+	c.mu.Lock()
+	gap, open := c.gaps[channel]
+	if open {
+		delete(c.gaps, channel)
+		gap.EndedAt = now
+		if c.session != nil {
+			gap.SessionID = c.session.ID
+		}
+	}
+	c.mu.Unlock()
+
+	if !open {
+		return
+	}
+
+	c.gapCount.Add(1)
+	c.handler.HandleGap(c.context(), gap)
+}
+
+func randomID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func tagTimestamp(tags map[string]string) time.Time {
 	if ts := tags["tmi-sent-ts"]; ts != "" {
 		if ms, err := strconv.ParseInt(ts, 10, 64); err == nil {
 			return time.UnixMilli(ms).UTC()
@@ -128,6 +560,15 @@ func noticeTimestamp(tags map[string]string) time.Time {
 	return time.Now().UTC()
 }
 
+// ircToken добавляет префикс "oauth:", который IRC ожидает в PASS.
+func ircToken(token string) string {
+	token = strings.TrimSpace(token)
+	if token == "" || strings.HasPrefix(token, "oauth:") {
+		return token
+	}
+	return "oauth:" + token
+}
+
 func normalizeChannel(ch string) string {
 	return strings.TrimPrefix(strings.TrimSpace(ch), "#")
 }
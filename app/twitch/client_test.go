@@ -0,0 +1,129 @@
+package twitch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/model"
+)
+
+type recordingHandler struct {
+	mu       sync.Mutex
+	chats    []model.ChatMessage
+	notices  []model.Notice
+	sessions []model.ConnectionSession
+	gaps     []model.ChatGap
+}
+
+func (h *recordingHandler) HandleChat(_ context.Context, msg model.ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.chats = append(h.chats, msg)
+}
+
+func (h *recordingHandler) HandleNotice(_ context.Context, notice model.Notice) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notices = append(h.notices, notice)
+}
+
+func (h *recordingHandler) HandleSession(_ context.Context, session model.ConnectionSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions = append(h.sessions, session)
+}
+
+func (h *recordingHandler) HandleGap(_ context.Context, gap model.ChatGap) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gaps = append(h.gaps, gap)
+}
+
+func TestReconnectProducesSessionsAndGaps(t *testing.T) {
+	handler := &recordingHandler{}
+	c := NewClient(config.TwitchConfig{
+		Username:   "bot",
+		OAuthToken: "oauth:token",
+		Channels:   []string{"chan1", "chan2"},
+	}, handler, nil)
+
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.startSession(t0)
+	c.closeGap("chan1", t0)
+
+	if len(handler.gaps) != 0 {
+		t.Fatalf("expected no gaps on first connect, got %d", len(handler.gaps))
+	}
+
+	c.endSession(t0.Add(time.Minute), "connection lost")
+	c.startSession(t0.Add(2 * time.Minute))
+	c.closeGap("chan1", t0.Add(3*time.Minute))
+	c.closeGap("chan2", t0.Add(4*time.Minute))
+
+	if len(handler.sessions) != 3 {
+		t.Fatalf("expected 3 session events, got %d", len(handler.sessions))
+	}
+	closed := handler.sessions[1]
+	if closed.ID != handler.sessions[0].ID || closed.DisconnectedAt.IsZero() || closed.Reason != "connection lost" {
+		t.Fatalf("unexpected closed session: %+v", closed)
+	}
+
+	if len(handler.gaps) != 2 {
+		t.Fatalf("expected 2 gaps, got %d", len(handler.gaps))
+	}
+	gap := handler.gaps[0]
+	if gap.Channel != "chan1" || !gap.StartedAt.Equal(t0.Add(time.Minute)) || !gap.EndedAt.Equal(t0.Add(3*time.Minute)) {
+		t.Fatalf("unexpected gap: %+v", gap)
+	}
+	if gap.SessionID != handler.sessions[2].ID {
+		t.Fatalf("gap should reference the new session, got %q", gap.SessionID)
+	}
+
+	stats := c.Stats()
+	if stats.Sessions != 2 || stats.Reconnects != 1 || stats.Gaps != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestImplicitReconnectClosesPreviousSession(t *testing.T) {
+	handler := &recordingHandler{}
+	c := NewClient(config.TwitchConfig{Channels: []string{"chan1"}}, handler, nil)
+
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.startSession(t0)
+	c.pendingReason = reasonServerReconnect
+	c.startSession(t0.Add(time.Second))
+
+	if len(handler.sessions) != 3 {
+		t.Fatalf("expected 3 session events, got %d", len(handler.sessions))
+	}
+	if handler.sessions[1].Reason != reasonServerReconnect {
+		t.Fatalf("expected reason %q, got %q", reasonServerReconnect, handler.sessions[1].Reason)
+	}
+}
+
+func TestMixedCaseChannelClosesGapAndJoins(t *testing.T) {
+	handler := &recordingHandler{}
+	c := NewClient(config.TwitchConfig{Channels: []string{"#SomeChannel"}}, handler, nil)
+
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.startSession(t0)
+	c.endSession(t0.Add(time.Minute), "connection lost")
+	c.startSession(t0.Add(2 * time.Minute))
+
+	// Сервер сообщает о входе в канал логином в нижнем регистре.
+	c.mu.Lock()
+	c.joined["somechannel"] = true
+	c.mu.Unlock()
+	c.closeGap("somechannel", t0.Add(3*time.Minute))
+
+	if len(handler.gaps) != 1 || handler.gaps[0].Channel != "somechannel" {
+		t.Fatalf("expected closed gap for somechannel, got %+v", handler.gaps)
+	}
+	if stats := c.Stats(); len(stats.NotJoined) != 0 {
+		t.Fatalf("expected channel to be joined, got %v", stats.NotJoined)
+	}
+}
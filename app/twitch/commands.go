@@ -0,0 +1,122 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"twitch-chat-logger/model"
+)
+
+// CommandRegistrar реализуется Handler, которому нужны команды чата.
+// NewClient вызывает RegisterCommands один раз при создании клиента.
+type CommandRegistrar interface {
+	RegisterCommands(*Router)
+}
+
+// CommandFunc обрабатывает команду чата. Вызывается в отдельной горутине,
+// поэтому может отвечать через Command.Reply, не блокируя чтение чата.
+type CommandFunc func(ctx context.Context, cmd Command)
+
+// Command — разобранная команда из сообщения чата, например "!uptime now".
+type Command struct {
+	Name    string
+	Args    []string
+	Message model.ChatMessage
+
+	client *Client
+}
+
+// Reply отвечает на сообщение с командой в том же канале.
+func (c Command) Reply(ctx context.Context, text string) error {
+	return c.client.Reply(ctx, c.Message.Channel, c.Message.ID, text)
+}
+
+// Say пишет сообщение в канал команды без привязки к исходному сообщению.
+func (c Command) Say(ctx context.Context, text string) error {
+	return c.client.Say(ctx, c.Message.Channel, text)
+}
+
+// Router сопоставляет сообщения с префиксом и зарегистрированные команды.
+// prefixes переопределяет префикс в отдельных каналах; пустой отключает там команды.
+type Router struct {
+	prefix   string
+	prefixes map[string]string
+
+	mu       sync.RWMutex
+	commands map[string]CommandFunc
+}
+
+// NewRouter создаёт роутер команд с префиксом вроде "!".
+func NewRouter(prefix string) *Router {
+	return &Router{prefix: prefix, commands: make(map[string]CommandFunc)}
+}
+
+// Handle регистрирует команду; имя сравнивается без учёта регистра и без префикса.
+func (r *Router) Handle(name string, fn CommandFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[strings.ToLower(strings.TrimPrefix(name, r.prefix))] = fn
+}
+
+// Len возвращает число зарегистрированных команд.
+func (r *Router) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.commands)
+}
+
+// prefixFor возвращает префикс команд в канале.
+func (r *Router) prefixFor(channel string) string {
+	if prefix, ok := r.prefixes[channel]; ok {
+		return prefix
+	}
+	return r.prefix
+}
+
+// match разбирает сообщение и возвращает обработчик, если это известная команда.
+func (r *Router) match(msg model.ChatMessage) (CommandFunc, Command, bool) {
+	prefix := r.prefixFor(msg.Channel)
+	if prefix == "" || !strings.HasPrefix(msg.Text, prefix) {
+		return nil, Command{}, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(msg.Text, prefix))
+	if len(fields) == 0 {
+		return nil, Command{}, false
+	}
+
+	name := strings.ToLower(fields[0])
+	r.mu.RLock()
+	fn, ok := r.commands[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, Command{}, false
+	}
+
+	return fn, Command{Name: name, Args: fields[1:], Message: msg}, true
+}
+
+// dispatch запускает команду из сообщения, если она зарегистрирована.
+func (c *Client) dispatch(ctx context.Context, msg model.ChatMessage) {
+	if c.router == nil || msg.IsSelf {
+		return
+	}
+
+	fn, cmd, ok := c.router.match(msg)
+	if !ok {
+		return
+	}
+	cmd.client = c
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logger.Error("команда упала", "command", c.router.prefixFor(msg.Channel)+cmd.Name, "channel", msg.Channel,
+					"message_id", msg.ID, "err", fmt.Sprint(r))
+			}
+		}()
+		fn(ctx, cmd)
+	}()
+}
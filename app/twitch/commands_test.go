@@ -0,0 +1,119 @@
+package twitch
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"twitch-chat-logger/model"
+)
+
+type commandHandler struct {
+	recordingHandler
+}
+
+func (h *commandHandler) RegisterCommands(r *Router) {
+	r.Handle("ping", func(ctx context.Context, cmd Command) {
+		_ = cmd.Reply(ctx, "pong "+strings.Join(cmd.Args, " "))
+	})
+}
+
+func TestRouterMatchesPrefixCommands(t *testing.T) {
+	r := NewRouter("!")
+	r.Handle("!Uptime", func(context.Context, Command) {})
+
+	if _, cmd, ok := r.match(model.ChatMessage{Text: "!UPTIME now please"}); !ok || cmd.Name != "uptime" || len(cmd.Args) != 2 {
+		t.Fatalf("expected uptime command, got %+v ok=%v", cmd, ok)
+	}
+	for _, text := range []string{"uptime", "!", "!unknown", " !uptime"} {
+		if _, _, ok := r.match(model.ChatMessage{Text: text}); ok {
+			t.Fatalf("%q must not match", text)
+		}
+	}
+
+	r.prefixes = map[string]string{"chan2": "?", "chan3": ""}
+	if _, cmd, ok := r.match(model.ChatMessage{Channel: "chan2", Text: "?uptime"}); !ok || cmd.Name != "uptime" {
+		t.Fatalf("expected channel prefix to match, got %+v ok=%v", cmd, ok)
+	}
+	for _, msg := range []model.ChatMessage{{Channel: "chan2", Text: "!uptime"}, {Channel: "chan3", Text: "!uptime"}} {
+		if _, _, ok := r.match(msg); ok {
+			t.Fatalf("%+v must not match", msg)
+		}
+	}
+}
+
+func TestCommandRepliesAndLogsSelfMessage(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &commandHandler{}
+	cfg := wsConfig(server.url(), "token")
+	cfg.CommandPrefix = "!"
+	client := NewClient(cfg, handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "join", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1
+	})
+
+	server.broadcast("@badges=moderator/1 :tmi.twitch.tv USERSTATE #chan1\r\n" +
+		"@id=parent-1;user-id=7;display-name=Viewer :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #chan1 :!ping a b")
+
+	waitFor(t, "reply", func() bool {
+		for _, line := range server.lines() {
+			if line == "@reply-parent-msg-id=parent-1 PRIVMSG #chan1 :pong a b" {
+				return true
+			}
+		}
+		return false
+	})
+
+	waitFor(t, "self message", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		for _, msg := range handler.chats {
+			if msg.IsSelf && msg.Text == "pong a b" && msg.Channel == "chan1" && msg.Username == "bot" {
+				return true
+			}
+		}
+		return false
+	})
+
+	client.mu.Lock()
+	privileged := client.privileged["chan1"]
+	client.mu.Unlock()
+	if !privileged {
+		t.Fatalf("USERSTATE with moderator badge must raise the send limit")
+	}
+}
+
+func TestSayRejectsLineBreakInjection(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &recordingHandler{}
+	client := NewClient(wsConfig(server.url(), "token"), handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "join", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1
+	})
+
+	if err := client.Say(ctx, "#Chan1", "hi\r\nPART #chan1"); err != nil {
+		t.Fatalf("Say returned error: %v", err)
+	}
+	waitFor(t, "privmsg", func() bool {
+		for _, line := range server.lines() {
+			if line == "PRIVMSG #chan1 :hi  PART #chan1" {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,185 @@
+package twitch
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	twitchirc "github.com/gempir/go-twitch-irc/v4"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/model"
+)
+
+// gempirTransport подключается к Twitch IRC через go-twitch-irc.
+type gempirTransport struct {
+	client *twitchirc.Client
+}
+
+func newGempirTransport(cfg config.TwitchConfig, events transportEvents) *gempirTransport {
+	client := twitchirc.NewClient(cfg.Username, ircToken(cfg.OAuthToken))
+	// JOIN/PART зрителей приходят только с twitch.tv/membership.
+	client.Capabilities = []string{twitchirc.TagsCapability, twitchirc.CommandsCapability, twitchirc.MembershipCapability}
+
+	// go-twitch-irc сам отправляет PING после IdlePingInterval без входящих
+	// сообщений и сам переподключается без PONG; мы только снимаем RTT.
+	if cfg.Health.PingInterval > 0 {
+		client.IdlePingInterval = cfg.Health.PingInterval
+	}
+	if cfg.Health.PongTimeout > 0 {
+		client.PongTimeout = cfg.Health.PongTimeout
+	}
+
+	client.OnConnect(events.onConnect)
+	client.OnPingSent(events.onPingSent)
+
+	client.OnPongMessage(func(twitchirc.PongMessage) {
+		events.onPong()
+	})
+
+	client.OnPingMessage(func(twitchirc.PingMessage) {
+		events.onTraffic()
+	})
+
+	client.OnUnsetMessage(func(twitchirc.RawMessage) {
+		events.onTraffic()
+	})
+
+	client.OnPrivateMessage(func(m twitchirc.PrivateMessage) {
+		events.onChat(toChatMessage(m))
+	})
+
+	client.OnSelfJoinMessage(func(m twitchirc.UserJoinMessage) {
+		events.onSelfJoin(normalizeChannel(m.Channel))
+	})
+
+	client.OnUserJoinMessage(func(m twitchirc.UserJoinMessage) {
+		events.onMembership(toMembership(m.Channel, m.User, model.MembershipJoin))
+	})
+
+	client.OnUserPartMessage(func(m twitchirc.UserPartMessage) {
+		events.onMembership(toMembership(m.Channel, m.User, model.MembershipPart))
+	})
+
+	client.OnReconnectMessage(func(twitchirc.ReconnectMessage) {
+		events.onReconnect()
+	})
+
+	client.OnNoticeMessage(func(msg twitchirc.NoticeMessage) {
+		events.onNotice(toNotice(msg))
+	})
+
+	client.OnRoomStateMessage(func(m twitchirc.RoomStateMessage) {
+		events.onRoomState(normalizeChannel(m.Channel), m.RoomID)
+	})
+
+	client.OnUserStateMessage(func(m twitchirc.UserStateMessage) {
+		events.onUserState(normalizeChannel(m.Channel), m.User.Badges)
+	})
+
+	client.OnGlobalUserStateMessage(func(m twitchirc.GlobalUserStateMessage) {
+		events.onGlobalUserState(m.User.ID, m.User.DisplayName)
+	})
+
+	return &gempirTransport{client: client}
+}
+
+func (t *gempirTransport) Connect() error {
+	err := t.client.Connect()
+	if errors.Is(err, twitchirc.ErrClientDisconnected) {
+		return nil
+	}
+	return err
+}
+
+func (t *gempirTransport) Disconnect() {
+	_ = t.client.Disconnect()
+}
+
+// Drop рвёт соединение; Connect вернёт nil, и Client переподключится сам.
+func (t *gempirTransport) Drop() {
+	_ = t.client.Disconnect()
+}
+
+// Ping ничего не делает: go-twitch-irc отправляет PING самостоятельно.
+func (t *gempirTransport) Ping() error {
+	return nil
+}
+
+func (t *gempirTransport) Say(channel, text string) error {
+	t.client.Say(channel, text)
+	return nil
+}
+
+func (t *gempirTransport) Reply(channel, parentID, text string) error {
+	t.client.Reply(channel, parentID, text)
+	return nil
+}
+
+// SetToken применяется go-twitch-irc при следующем подключении.
+func (t *gempirTransport) SetToken(token string) {
+	t.client.SetIRCToken(ircToken(token))
+}
+
+func (t *gempirTransport) Join(channels ...string) {
+	t.client.Join(channels...)
+}
+
+func (t *gempirTransport) Server() string {
+	return t.client.IrcAddress
+}
+
+func toChatMessage(m twitchirc.PrivateMessage) model.ChatMessage {
+	badges := make(map[string]int, len(m.User.Badges))
+	for k, v := range m.User.Badges {
+		badges[k] = v
+	}
+
+	var emotes []model.EmoteUsage
+	for _, emote := range m.Emotes {
+		emotes = append(emotes, model.EmoteUsage{Provider: model.EmoteProviderTwitch, ID: emote.ID, Name: emote.Name, Count: emote.Count})
+	}
+
+	sentAt := m.Time.UTC()
+	if m.Time.IsZero() {
+		sentAt = time.Now().UTC()
+	}
+
+	return model.ChatMessage{
+		ID:           m.ID,
+		Channel:      normalizeChannel(m.Channel),
+		RoomID:       m.RoomID,
+		UserID:       m.User.ID,
+		Username:     m.User.Name,
+		DisplayName:  m.User.DisplayName,
+		Text:         m.Message,
+		Badges:       badges,
+		Color:        m.User.Color,
+		IsMod:        m.User.Badges["moderator"] > 0 || m.User.Badges["broadcaster"] > 0,
+		IsSubscriber: m.User.Badges["subscriber"] > 0,
+		Bits:         m.Bits,
+		SentAt:       sentAt,
+		Emotes:       emotes,
+		RawTags:      m.Tags,
+	}
+}
+
+func toMembership(channel, user, action string) model.Membership {
+	return model.Membership{
+		Channel:  normalizeChannel(channel),
+		Username: strings.ToLower(user),
+		Action:   action,
+		SeenAt:   time.Now().UTC(),
+	}
+}
+
+func toNotice(msg twitchirc.NoticeMessage) model.Notice {
+	return model.Notice{
+		Channel:  normalizeChannel(msg.Channel),
+		RoomID:   msg.Tags["room-id"],
+		ID:       msg.MsgID,
+		Message:  msg.Message,
+		Tags:     msg.Tags,
+		NoticeAt: tagTimestamp(msg.Tags),
+	}
+}
@@ -0,0 +1,240 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"twitch-chat-logger/config"
+)
+
+const (
+	// silenceFactor: канал подозрителен, если молчит дольше, чем
+	// silenceFactor средних интервалов между его сообщениями (но не меньше порога).
+	silenceFactor = 10
+	// silenceMinMessages — сколько сообщений нужно, чтобы судить о «нормальной» активности канала.
+	silenceMinMessages = 20
+	// gapWeight — вес нового интервала в экспоненциальном среднем.
+	gapWeight = 0.1
+)
+
+// HealthStats — состояние соединения по данным PING/PONG и трафика.
+type HealthStats struct {
+	RTT            time.Duration
+	PingsSent      uint64
+	PongsReceived  uint64
+	WatchdogResets uint64
+	LastTraffic    time.Time
+	SilentChannels []string
+}
+
+// channelActivity — история сообщений одного канала для поиска подозрительной тишины.
+type channelActivity struct {
+	last   time.Time
+	avgGap time.Duration
+	count  uint64
+	silent bool
+}
+
+// healthMonitor отслеживает PING/PONG, входящий трафик и активность каналов.
+// silence переопределяет cfg.ChannelSilence в отдельных каналах.
+type healthMonitor struct {
+	cfg     config.HealthConfig
+	silence map[string]time.Duration
+	logger  *slog.Logger
+
+	mu          sync.Mutex
+	lastTraffic time.Time
+	lastPing    time.Time
+	pingPending bool
+	rtt         time.Duration
+	pings       uint64
+	pongs       uint64
+	resets      uint64
+	channels    map[string]*channelActivity
+}
+
+func newHealthMonitor(cfg config.HealthConfig, logger *slog.Logger) *healthMonitor {
+	return &healthMonitor{cfg: cfg, logger: logger, channels: make(map[string]*channelActivity)}
+}
+
+func (h *healthMonitor) enabled() bool {
+	return h.cfg.PingInterval > 0 && h.cfg.PongTimeout > 0
+}
+
+// reset начинает отсчёт заново после нового подключения.
+func (h *healthMonitor) reset(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTraffic = now
+	h.lastPing = now
+	h.pingPending = false
+}
+
+func (h *healthMonitor) traffic(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTraffic = now
+}
+
+func (h *healthMonitor) pingSent(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPing = now
+	h.pingPending = true
+	h.pings++
+}
+
+func (h *healthMonitor) pong(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTraffic = now
+	h.pongs++
+	if h.pingPending {
+		h.rtt = now.Sub(h.lastPing)
+		h.pingPending = false
+	}
+}
+
+// joined обнуляет тишину канала: после входа в канал отсчёт начинается заново.
+func (h *healthMonitor) joined(channel string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a := h.activity(channel)
+	a.last = now
+	a.silent = false
+}
+
+func (h *healthMonitor) chat(channel string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTraffic = now
+
+	a := h.activity(channel)
+	if a.count > 0 {
+		gap := now.Sub(a.last)
+		if a.avgGap == 0 {
+			a.avgGap = gap
+		} else {
+			a.avgGap = time.Duration(float64(a.avgGap)*(1-gapWeight) + float64(gap)*gapWeight)
+		}
+	}
+	if a.silent {
+		h.logger.Info("канал снова активен", "channel", channel, "silence", now.Sub(a.last).Round(time.Second))
+		a.silent = false
+	}
+	a.last = now
+	a.count++
+}
+
+func (h *healthMonitor) activity(channel string) *channelActivity {
+	a, ok := h.channels[channel]
+	if !ok {
+		a = &channelActivity{}
+		h.channels[channel] = a
+	}
+	return a
+}
+
+// check возвращает, нужно ли отправить PING, и причину принудительного
+// переподключения (пустая строка — соединение здорово).
+func (h *healthMonitor) check(now time.Time) (sendPing bool, resetReason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pingPending && now.Sub(h.lastPing) > h.cfg.PongTimeout {
+		h.resets++
+		return false, fmt.Sprintf("watchdog: нет PONG %s", h.cfg.PongTimeout)
+	}
+	if h.cfg.IdleTimeout > 0 && now.Sub(h.lastTraffic) > h.cfg.IdleTimeout {
+		h.resets++
+		return false, fmt.Sprintf("watchdog: нет трафика %s", h.cfg.IdleTimeout)
+	}
+
+	for channel, a := range h.channels {
+		if a.silent || a.count < silenceMinMessages {
+			continue
+		}
+		threshold := h.cfg.ChannelSilence
+		if override, ok := h.silence[channel]; ok {
+			threshold = override
+		}
+		if expected := a.avgGap * silenceFactor; expected > threshold {
+			threshold = expected
+		}
+		if silence := now.Sub(a.last); silence > threshold {
+			a.silent = true
+			h.logger.Warn("канал подозрительно молчит", "channel", channel,
+				"silence", silence.Round(time.Second), "avg_gap", a.avgGap.Round(time.Millisecond))
+		}
+	}
+
+	return !h.pingPending && now.Sub(h.lastPing) >= h.cfg.PingInterval, ""
+}
+
+func (h *healthMonitor) stats() HealthStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := HealthStats{
+		RTT:            h.rtt,
+		PingsSent:      h.pings,
+		PongsReceived:  h.pongs,
+		WatchdogResets: h.resets,
+		LastTraffic:    h.lastTraffic,
+	}
+	for channel, a := range h.channels {
+		if a.silent {
+			stats.SilentChannels = append(stats.SilentChannels, channel)
+		}
+	}
+	sort.Strings(stats.SilentChannels)
+	return stats
+}
+
+// monitor периодически проверяет здоровье активного соединения.
+func (c *Client) monitor(ctx context.Context) {
+	tick := c.health.cfg.PongTimeout / 2
+	if c.health.cfg.PingInterval/2 < tick {
+		tick = c.health.cfg.PingInterval / 2
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkHealth(time.Now().UTC())
+		}
+	}
+}
+
+func (c *Client) checkHealth(now time.Time) {
+	c.mu.Lock()
+	connected := c.session != nil
+	c.mu.Unlock()
+	if !connected {
+		return
+	}
+
+	sendPing, reason := c.health.check(now)
+	if reason != "" {
+		c.logger.Warn("принудительное переподключение", "reason", reason)
+		c.mu.Lock()
+		c.pendingReason = reason
+		c.mu.Unlock()
+		c.transport.Drop()
+		return
+	}
+
+	if sendPing {
+		if err := c.transport.Ping(); err != nil {
+			c.logger.Warn("PING не отправлен", "err", err)
+		}
+	}
+}
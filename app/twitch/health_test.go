@@ -0,0 +1,136 @@
+package twitch
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"twitch-chat-logger/config"
+)
+
+var healthCfg = config.HealthConfig{
+	PingInterval:   time.Minute,
+	PongTimeout:    10 * time.Second,
+	IdleTimeout:    5 * time.Minute,
+	ChannelSilence: 30 * time.Minute,
+}
+
+func TestHealthMonitorMeasuresRTT(t *testing.T) {
+	h := newHealthMonitor(healthCfg, slog.Default())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.reset(t0)
+
+	if ping, reason := h.check(t0.Add(30 * time.Second)); ping || reason != "" {
+		t.Fatalf("unexpected check result before interval: ping=%v reason=%q", ping, reason)
+	}
+	if ping, _ := h.check(t0.Add(time.Minute)); !ping {
+		t.Fatalf("expected ping after interval")
+	}
+
+	h.pingSent(t0.Add(time.Minute))
+	h.pong(t0.Add(time.Minute + 120*time.Millisecond))
+
+	stats := h.stats()
+	if stats.RTT != 120*time.Millisecond || stats.PingsSent != 1 || stats.PongsReceived != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestHealthMonitorResetsWithoutPong(t *testing.T) {
+	h := newHealthMonitor(healthCfg, slog.Default())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.reset(t0)
+	h.pingSent(t0)
+
+	if _, reason := h.check(t0.Add(5 * time.Second)); reason != "" {
+		t.Fatalf("unexpected reset before pong timeout: %q", reason)
+	}
+	if _, reason := h.check(t0.Add(11 * time.Second)); !strings.Contains(reason, "PONG") {
+		t.Fatalf("expected PONG watchdog, got %q", reason)
+	}
+	if h.stats().WatchdogResets != 1 {
+		t.Fatalf("expected one watchdog reset")
+	}
+}
+
+func TestHealthMonitorResetsWithoutTraffic(t *testing.T) {
+	h := newHealthMonitor(healthCfg, slog.Default())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.reset(t0)
+	h.traffic(t0.Add(4 * time.Minute))
+
+	if _, reason := h.check(t0.Add(6 * time.Minute)); reason != "" {
+		t.Fatalf("traffic must postpone watchdog, got %q", reason)
+	}
+	if _, reason := h.check(t0.Add(10 * time.Minute)); !strings.Contains(reason, "трафика") {
+		t.Fatalf("expected idle watchdog, got %q", reason)
+	}
+}
+
+func TestHealthMonitorFlagsSuspiciousSilence(t *testing.T) {
+	h := newHealthMonitor(config.HealthConfig{
+		PingInterval:   time.Minute,
+		PongTimeout:    10 * time.Second,
+		ChannelSilence: time.Minute,
+	}, slog.Default())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.reset(t0)
+
+	now := t0
+	for i := 0; i < silenceMinMessages; i++ {
+		now = now.Add(time.Second)
+		h.chat("busy", now)
+	}
+	h.chat("quiet", now)
+
+	h.check(now.Add(30 * time.Second))
+	if silent := h.stats().SilentChannels; len(silent) != 0 {
+		t.Fatalf("no channel should be silent yet, got %v", silent)
+	}
+
+	h.check(now.Add(2 * time.Minute))
+	if silent := h.stats().SilentChannels; !reflect.DeepEqual(silent, []string{"busy"}) {
+		t.Fatalf("expected busy to be flagged, got %v", silent)
+	}
+
+	h.chat("busy", now.Add(3*time.Minute))
+	if silent := h.stats().SilentChannels; len(silent) != 0 {
+		t.Fatalf("new message must clear the flag, got %v", silent)
+	}
+}
+
+func TestWatchdogReconnectsWhenServerIgnoresPing(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &recordingHandler{}
+	cfg := wsConfig(server.url(), "token")
+	cfg.Reconnect.MaxAttempts = 0
+	cfg.Health = config.HealthConfig{
+		PingInterval:   20 * time.Millisecond,
+		PongTimeout:    40 * time.Millisecond,
+		IdleTimeout:    time.Minute,
+		ChannelSilence: time.Minute,
+	}
+	client := NewClient(cfg, handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "watchdog reconnect", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		for _, s := range handler.sessions {
+			if strings.HasPrefix(s.Reason, "watchdog") {
+				return true
+			}
+		}
+		return false
+	})
+
+	if client.Stats().Health.PingsSent == 0 {
+		t.Fatalf("expected pings to be sent")
+	}
+}
@@ -0,0 +1,127 @@
+package twitch
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrEmptyMessage возвращается ParseMessage для пустой строки.
+var ErrEmptyMessage = errors.New("irc: empty message")
+
+// Message — одна строка протокола IRCv3: теги, префикс, команда и параметры.
+// Последний параметр с префиксом ":" (trailing) хранится в Params как есть, без двоеточия.
+type Message struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Nick возвращает ник из префикса вида nick!user@host.
+func (m Message) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Param возвращает i-й параметр или пустую строку.
+func (m Message) Param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
+// ParseMessage разбирает строку IRC без завершающего CRLF.
+func ParseMessage(line string) (Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return Message{}, ErrEmptyMessage
+	}
+
+	msg := Message{Tags: map[string]string{}}
+
+	if strings.HasPrefix(line, "@") {
+		rawTags, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return Message{}, errors.New("irc: message has only tags")
+		}
+		msg.Tags = parseTags(rawTags)
+		line = strings.TrimLeft(rest, " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		prefix, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return Message{}, errors.New("irc: message has no command")
+		}
+		msg.Prefix = prefix
+		line = strings.TrimLeft(rest, " ")
+	}
+
+	command, rest, _ := strings.Cut(line, " ")
+	if command == "" {
+		return Message{}, errors.New("irc: message has no command")
+	}
+	msg.Command = strings.ToUpper(command)
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ")
+		if rest == "" {
+			break
+		}
+		if strings.HasPrefix(rest, ":") {
+			msg.Params = append(msg.Params, rest[1:])
+			break
+		}
+		var param string
+		param, rest, _ = strings.Cut(rest, " ")
+		msg.Params = append(msg.Params, param)
+	}
+
+	return msg, nil
+}
+
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		tags[key] = unescapeTagValue(value)
+	}
+	return tags
+}
+
+// unescapeTagValue раскрывает экранирование значений тегов IRCv3.
+func unescapeTagValue(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+
+	var b strings.Builder
+	b.Grow(len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			b.WriteByte(v[i])
+			continue
+		}
+		if i+1 == len(v) {
+			break
+		}
+		i++
+		switch v[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
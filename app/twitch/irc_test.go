@@ -0,0 +1,113 @@
+package twitch
+
+import (
+	"reflect"
+	"testing"
+
+	twitchirc "github.com/gempir/go-twitch-irc/v4"
+
+	"twitch-chat-logger/model"
+)
+
+const rawPrivmsg = `@badge-info=subscriber/14;badges=moderator/1,subscriber/12;color=#1E90FF;display-name=Foo\sBar;emotes=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;room-id=1337;tmi-sent-ts=1714566896000;user-id=12345 :foo!foo@foo.tmi.twitch.tv PRIVMSG #chan1 :hello there`
+
+func TestParseMessageSplitsTagsPrefixCommandParams(t *testing.T) {
+	msg, err := ParseMessage(rawPrivmsg + "\r\n")
+	if err != nil {
+		t.Fatalf("ParseMessage returned error: %v", err)
+	}
+
+	if msg.Command != "PRIVMSG" || msg.Prefix != "foo!foo@foo.tmi.twitch.tv" || msg.Nick() != "foo" {
+		t.Fatalf("unexpected message head: %+v", msg)
+	}
+	if !reflect.DeepEqual(msg.Params, []string{"#chan1", "hello there"}) {
+		t.Fatalf("unexpected params: %q", msg.Params)
+	}
+	if msg.Tags["display-name"] != "Foo Bar" || msg.Tags["emotes"] != "" || msg.Tags["room-id"] != "1337" {
+		t.Fatalf("unexpected tags: %v", msg.Tags)
+	}
+}
+
+func TestParseMessageWithoutTagsOrPrefix(t *testing.T) {
+	msg, err := ParseMessage("PING :tmi.twitch.tv")
+	if err != nil {
+		t.Fatalf("ParseMessage returned error: %v", err)
+	}
+	if msg.Command != "PING" || msg.Prefix != "" || msg.Param(0) != "tmi.twitch.tv" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	msg, err = ParseMessage(":tmi.twitch.tv 001 bot :Welcome, GLHF!")
+	if err != nil {
+		t.Fatalf("ParseMessage returned error: %v", err)
+	}
+	if msg.Command != "001" || msg.Param(0) != "bot" || msg.Param(1) != "Welcome, GLHF!" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+}
+
+func TestParseMessageRejectsGarbage(t *testing.T) {
+	for _, line := range []string{"", "   ", "@a=b", ":prefix-only"} {
+		if _, err := ParseMessage(line); err == nil {
+			t.Fatalf("expected error for %q", line)
+		}
+	}
+}
+
+func TestUnescapeTagValue(t *testing.T) {
+	cases := map[string]string{
+		`a\sb`:   "a b",
+		`a\:b`:   "a;b",
+		`a\\b`:   `a\b`,
+		`a\nb`:   "a\nb",
+		`trail\`: "trail",
+		`plain`:  "plain",
+	}
+	for in, want := range cases {
+		if got := unescapeTagValue(in); got != want {
+			t.Fatalf("unescape %q: expected %q got %q", in, want, got)
+		}
+	}
+}
+
+func TestTransportsProduceSameChatMessage(t *testing.T) {
+	native, err := ParseMessage(rawPrivmsg)
+	if err != nil {
+		t.Fatalf("ParseMessage returned error: %v", err)
+	}
+
+	parsed, ok := twitchirc.ParseMessage(rawPrivmsg).(*twitchirc.PrivateMessage)
+	if !ok {
+		t.Fatalf("go-twitch-irc did not parse PRIVMSG")
+	}
+
+	got := chatFromIRC(native)
+	want := toChatMessage(*parsed)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("transports disagree:\nnative: %+v\ngempir: %+v", got, want)
+	}
+}
+
+func TestTransportsParseNativeEmotes(t *testing.T) {
+	raw := `@badges=;color=;display-name=foo;emotes=25:0-4,12-16/1902:6-10;id=1;room-id=1337;tmi-sent-ts=1714566896000;user-id=12345 :foo!foo@foo.tmi.twitch.tv PRIVMSG #chan1 :Kappa Keepo Kappa`
+	native, err := ParseMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseMessage returned error: %v", err)
+	}
+	parsed, ok := twitchirc.ParseMessage(raw).(*twitchirc.PrivateMessage)
+	if !ok {
+		t.Fatalf("go-twitch-irc did not parse PRIVMSG")
+	}
+
+	got := chatFromIRC(native)
+	want := []model.EmoteUsage{
+		{Provider: "twitch", ID: "25", Name: "Kappa", Count: 2},
+		{Provider: "twitch", ID: "1902", Name: "Keepo", Count: 1},
+	}
+	if !reflect.DeepEqual(got.Emotes, want) {
+		t.Fatalf("unexpected emotes: %+v", got.Emotes)
+	}
+	if gempir := toChatMessage(*parsed); !reflect.DeepEqual(gempir.Emotes, want) {
+		t.Fatalf("transports disagree on emotes: %+v", gempir.Emotes)
+	}
+}
@@ -0,0 +1,68 @@
+package twitch
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Лимиты Twitch на отправку сообщений одним аккаунтом: 20 за 30 секунд,
+// 100 за 30 секунд в каналах, где бот модератор, VIP или владелец.
+const (
+	sendWindow          = 30 * time.Second
+	sendLimitUser       = 20
+	sendLimitPrivileged = 100
+)
+
+// sendLimiter — скользящее окно отправленных сообщений.
+type sendLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	sent   []time.Time
+	now    func() time.Time
+}
+
+func newSendLimiter() *sendLimiter {
+	return &sendLimiter{window: sendWindow, now: time.Now}
+}
+
+// reserve учитывает отправку, если в окне меньше limit сообщений, и возвращает 0.
+// Иначе возвращает, сколько ждать до освобождения места.
+func (l *sendLimiter) reserve(limit int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(l.sent) && !l.sent[i].After(cutoff) {
+		i++
+	}
+	l.sent = l.sent[i:]
+
+	if len(l.sent) < limit {
+		l.sent = append(l.sent, now)
+		return 0
+	}
+
+	// Освободится место, когда из окна выйдет сообщение, превышающее лимит.
+	return l.sent[len(l.sent)-limit].Add(l.window).Sub(now)
+}
+
+// wait блокируется, пока отправка не уложится в limit, или до отмены контекста.
+func (l *sendLimiter) wait(ctx context.Context, limit int) error {
+	for {
+		delay := l.reserve(limit)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendLimiterEnforcesWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := newSendLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < sendLimitUser; i++ {
+		if d := l.reserve(sendLimitUser); d != 0 {
+			t.Fatalf("message %d should pass, got wait %s", i, d)
+		}
+		now = now.Add(time.Second)
+	}
+
+	// 20 сообщений за 20 секунд: следующее — только когда первое выйдет из окна.
+	if d := l.reserve(sendLimitUser); d != 10*time.Second {
+		t.Fatalf("expected 10s wait, got %s", d)
+	}
+
+	// В канале с правами модератора лимит выше, окно общее.
+	if d := l.reserve(sendLimitPrivileged); d != 0 {
+		t.Fatalf("privileged send should pass, got wait %s", d)
+	}
+
+	// Привилегированная отправка заняла 21-е место, поэтому из окна должны выйти два первых сообщения.
+	now = now.Add(11 * time.Second)
+	if d := l.reserve(sendLimitUser); d != 0 {
+		t.Fatalf("expected free slot after window, got wait %s", d)
+	}
+}
@@ -0,0 +1,329 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/model"
+)
+
+var errReconnectRequested = errors.New("twitch ws: server requested reconnect")
+
+// wsCapabilities запрашиваются при каждом подключении, как и в go-twitch-irc.
+const wsCapabilities = "twitch.tv/tags twitch.tv/commands twitch.tv/membership"
+
+// wsTransport — собственный клиент Twitch IRC поверх WebSocket.
+// После Disconnect транспорт больше не подключается.
+type wsTransport struct {
+	url      string
+	username string
+	token    string
+	events   transportEvents
+	dialer   *websocket.Dialer
+	logger   *slog.Logger
+
+	mu           sync.Mutex
+	conn         *websocket.Conn
+	disconnected bool
+}
+
+func newWSTransport(cfg config.TwitchConfig, events transportEvents, logger *slog.Logger) *wsTransport {
+	return &wsTransport{
+		logger:   logger.With("transport", "websocket"),
+		url:      cfg.WebSocketURL,
+		username: strings.ToLower(cfg.Username),
+		token:    ircToken(cfg.OAuthToken),
+		events:   events,
+		dialer:   websocket.DefaultDialer,
+	}
+}
+
+func (t *wsTransport) Connect() error {
+	for {
+		err := t.serve()
+		if errors.Is(err, errReconnectRequested) {
+			continue
+		}
+		return err
+	}
+}
+
+func (t *wsTransport) Disconnect() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.disconnected = true
+	if t.conn != nil {
+		_ = t.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_ = t.conn.Close()
+	}
+}
+
+// Drop закрывает текущее соединение; Connect вернёт ошибку чтения.
+func (t *wsTransport) Drop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil {
+		_ = t.conn.Close()
+	}
+}
+
+func (t *wsTransport) Ping() error {
+	if err := t.send("PING :tmi.twitch.tv"); err != nil {
+		return err
+	}
+	t.events.onPingSent()
+	return nil
+}
+
+func (t *wsTransport) Say(channel, text string) error {
+	return t.send("PRIVMSG #" + channel + " :" + text)
+}
+
+func (t *wsTransport) Reply(channel, parentID, text string) error {
+	return t.send("@reply-parent-msg-id=" + parentID + " PRIVMSG #" + channel + " :" + text)
+}
+
+// SetToken применяется при следующем подключении.
+func (t *wsTransport) SetToken(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ircToken(token)
+}
+
+func (t *wsTransport) Join(channels ...string) {
+	names := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		names = append(names, "#"+strings.ToLower(normalizeChannel(ch)))
+	}
+	if len(names) == 0 {
+		return
+	}
+	if err := t.send("JOIN " + strings.Join(names, ",")); err != nil {
+		t.logger.Warn("JOIN не отправлен", "channels", names, "err", err)
+	}
+}
+
+func (t *wsTransport) Server() string {
+	return t.url
+}
+
+// serve держит одно WebSocket-соединение до его разрыва.
+func (t *wsTransport) serve() error {
+	conn, _, err := t.dialer.Dial(t.url, nil)
+	if err != nil {
+		return fmt.Errorf("twitch ws: dial %s: %w", t.url, err)
+	}
+
+	t.mu.Lock()
+	if t.disconnected {
+		t.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	t.conn = conn
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.conn = nil
+		t.mu.Unlock()
+		conn.Close()
+	}()
+
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+
+	for _, line := range []string{"CAP REQ :" + wsCapabilities, "PASS " + token, "NICK " + t.username} {
+		if err := t.send(line); err != nil {
+			return err
+		}
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if t.isDisconnected() {
+				return nil
+			}
+			return fmt.Errorf("twitch ws: read: %w", err)
+		}
+
+		// Один фрейм может содержать несколько строк IRC.
+		for _, line := range strings.Split(string(data), "\r\n") {
+			msg, err := ParseMessage(line)
+			if err != nil {
+				continue
+			}
+			if err := t.dispatch(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (t *wsTransport) dispatch(msg Message) error {
+	switch msg.Command {
+	case "PING":
+		t.events.onTraffic()
+		return t.send("PONG :" + msg.Param(0))
+	case "PONG":
+		t.events.onPong()
+	case "001":
+		t.events.onConnect()
+	case "JOIN":
+		if strings.EqualFold(msg.Nick(), t.username) {
+			t.events.onSelfJoin(normalizeChannel(msg.Param(0)))
+		} else {
+			t.events.onMembership(membershipFromIRC(msg, model.MembershipJoin))
+		}
+	case "PART":
+		if strings.EqualFold(msg.Nick(), t.username) {
+			t.events.onTraffic()
+		} else {
+			t.events.onMembership(membershipFromIRC(msg, model.MembershipPart))
+		}
+	case "PRIVMSG":
+		t.events.onChat(chatFromIRC(msg))
+	case "ROOMSTATE":
+		t.events.onRoomState(normalizeChannel(msg.Param(0)), msg.Tags["room-id"])
+	case "USERSTATE":
+		t.events.onUserState(normalizeChannel(msg.Param(0)), parseBadges(msg.Tags["badges"]))
+	case "GLOBALUSERSTATE":
+		t.events.onGlobalUserState(msg.Tags["user-id"], msg.Tags["display-name"])
+	case "NOTICE":
+		if msg.Param(0) == "*" && isLoginFailure(msg.Param(1)) {
+			return fmt.Errorf("twitch ws: %s", msg.Param(1))
+		}
+		t.events.onNotice(noticeFromIRC(msg))
+	case "RECONNECT":
+		t.events.onReconnect()
+		return errReconnectRequested
+	default:
+		t.events.onTraffic()
+	}
+	return nil
+}
+
+func (t *wsTransport) send(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return errors.New("twitch ws: not connected")
+	}
+	if err := t.conn.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+		return fmt.Errorf("twitch ws: write: %w", err)
+	}
+	return nil
+}
+
+func (t *wsTransport) isDisconnected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.disconnected
+}
+
+func isLoginFailure(text string) bool {
+	return strings.Contains(text, "Login authentication failed") ||
+		strings.Contains(text, "Improperly formatted auth")
+}
+
+func chatFromIRC(msg Message) model.ChatMessage {
+	badges := parseBadges(msg.Tags["badges"])
+
+	text := msg.Param(1)
+	if strings.HasPrefix(text, "\u0001ACTION ") && strings.HasSuffix(text, "\u0001") {
+		text = text[len("\u0001ACTION ") : len(text)-1]
+	}
+
+	bits, _ := strconv.Atoi(msg.Tags["bits"])
+
+	return model.ChatMessage{
+		ID:           msg.Tags["id"],
+		Channel:      normalizeChannel(msg.Param(0)),
+		RoomID:       msg.Tags["room-id"],
+		UserID:       msg.Tags["user-id"],
+		Username:     msg.Nick(),
+		DisplayName:  msg.Tags["display-name"],
+		Text:         text,
+		Badges:       badges,
+		Color:        msg.Tags["color"],
+		IsMod:        badges["moderator"] > 0 || badges["broadcaster"] > 0,
+		IsSubscriber: badges["subscriber"] > 0,
+		Bits:         bits,
+		SentAt:       tagTimestamp(msg.Tags),
+		Emotes:       parseEmotes(msg.Tags["emotes"], text),
+		RawTags:      msg.Tags,
+	}
+}
+
+func membershipFromIRC(msg Message, action string) model.Membership {
+	return model.Membership{
+		Channel:  normalizeChannel(msg.Param(0)),
+		Username: strings.ToLower(msg.Nick()),
+		Action:   action,
+		SeenAt:   time.Now().UTC(),
+	}
+}
+
+func noticeFromIRC(msg Message) model.Notice {
+	return model.Notice{
+		Channel:  normalizeChannel(msg.Param(0)),
+		RoomID:   msg.Tags["room-id"],
+		ID:       msg.Tags["msg-id"],
+		Message:  msg.Param(1),
+		Tags:     msg.Tags,
+		NoticeAt: tagTimestamp(msg.Tags),
+	}
+}
+
+// parseEmotes разбирает тег emotes вида "25:0-4,12-16/1902:6-10"; позиции
+// указаны в символах текста, по первой из них берётся имя эмоута.
+func parseEmotes(raw, text string) []model.EmoteUsage {
+	if raw == "" {
+		return nil
+	}
+	runes := []rune(text)
+	var emotes []model.EmoteUsage
+	for _, entry := range strings.Split(raw, "/") {
+		id, positions, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || positions == "" {
+			continue
+		}
+		ranges := strings.Split(positions, ",")
+		emote := model.EmoteUsage{Provider: model.EmoteProviderTwitch, ID: id, Count: len(ranges)}
+		startRaw, endRaw, _ := strings.Cut(ranges[0], "-")
+		start, errStart := strconv.Atoi(startRaw)
+		end, errEnd := strconv.Atoi(endRaw)
+		if errStart == nil && errEnd == nil && start >= 0 && start <= end && end < len(runes) {
+			emote.Name = string(runes[start : end+1])
+		}
+		emotes = append(emotes, emote)
+	}
+	return emotes
+}
+
+// parseBadges разбирает тег badges вида "subscriber/12,premium/1".
+// Нечисловые версии, как и в go-twitch-irc, превращаются в 0.
+func parseBadges(raw string) map[string]int {
+	badges := make(map[string]int)
+	if raw == "" {
+		return badges
+	}
+	for _, badge := range strings.Split(raw, ",") {
+		name, version, _ := strings.Cut(badge, "/")
+		badges[name], _ = strconv.Atoi(version)
+	}
+	return badges
+}
@@ -0,0 +1,341 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"twitch-chat-logger/config"
+	"twitch-chat-logger/model"
+)
+
+// fakeIRCServer — минимальный Twitch IRC-over-WebSocket сервер для тестов.
+type fakeIRCServer struct {
+	t        *testing.T
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	received []string
+	conns    []*websocket.Conn
+}
+
+func newFakeIRCServer(t *testing.T) *fakeIRCServer {
+	t.Helper()
+	f := &fakeIRCServer{t: t}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeIRCServer) url() string {
+	return "ws" + strings.TrimPrefix(f.srv.URL, "http")
+}
+
+func (f *fakeIRCServer) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.conns = append(f.conns, conn)
+	f.mu.Unlock()
+
+	var nick string
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		line := string(data)
+
+		f.mu.Lock()
+		f.received = append(f.received, line)
+		f.mu.Unlock()
+
+		msg, err := ParseMessage(line)
+		if err != nil {
+			continue
+		}
+
+		switch msg.Command {
+		case "PASS":
+			if msg.Param(0) == "oauth:wrong" {
+				f.write(conn, ":tmi.twitch.tv NOTICE * :Login authentication failed")
+			}
+		case "NICK":
+			nick = msg.Param(0)
+			f.write(conn, ":tmi.twitch.tv 001 "+nick+" :Welcome, GLHF!")
+		case "JOIN":
+			for _, ch := range strings.Split(msg.Param(0), ",") {
+				f.write(conn,
+					":"+nick+"!"+nick+"@"+nick+".tmi.twitch.tv JOIN "+ch+"\r\n"+
+						"@emote-only=0;room-id=1337;slow=0 :tmi.twitch.tv ROOMSTATE "+ch+"\r\n"+
+						rawPrivmsg+"\r\n"+
+						"@msg-id=slow_on;tmi-sent-ts=1714566896000 :tmi.twitch.tv NOTICE "+ch+" :This room is now in slow mode.")
+			}
+		}
+	}
+}
+
+func (f *fakeIRCServer) write(conn *websocket.Conn, text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+		f.t.Errorf("write: %v", err)
+	}
+}
+
+func (f *fakeIRCServer) broadcast(text string) {
+	f.mu.Lock()
+	conns := append([]*websocket.Conn(nil), f.conns...)
+	f.mu.Unlock()
+	for _, conn := range conns {
+		f.write(conn, text)
+	}
+}
+
+func (f *fakeIRCServer) lines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.received...)
+}
+
+func wsConfig(url, token string) config.TwitchConfig {
+	return config.TwitchConfig{
+		Username:     "Bot",
+		OAuthToken:   token,
+		Channels:     []string{"chan1"},
+		Transport:    config.TransportWebSocket,
+		WebSocketURL: url,
+		Reconnect:    config.ReconnectConfig{Backoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxAttempts: 1},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+// roomRecordingHandler дополнительно реализует RoomHandler.
+type roomRecordingHandler struct {
+	recordingHandler
+	rooms []model.Room
+}
+
+func (h *roomRecordingHandler) HandleRoom(_ context.Context, room model.Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rooms = append(h.rooms, room)
+}
+
+func TestWebSocketTransportDeliversChatAndNotices(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &roomRecordingHandler{}
+	client := NewClient(wsConfig(server.url(), "token"), handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+
+	waitFor(t, "chat and notice", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1 && len(handler.notices) == 1
+	})
+
+	lines := server.lines()
+	if len(lines) < 4 || lines[1] != "PASS oauth:token" || lines[2] != "NICK bot" || lines[3] != "JOIN #chan1" {
+		t.Fatalf("unexpected handshake: %q", lines)
+	}
+
+	handler.mu.Lock()
+	chat, notice := handler.chats[0], handler.notices[0]
+	handler.mu.Unlock()
+	if chat.Channel != "chan1" || chat.Username != "foo" || chat.Text != "hello there" {
+		t.Fatalf("unexpected chat message: %+v", chat)
+	}
+	if chat.RawTags["badge-info"] != "subscriber/14" {
+		t.Fatalf("expected raw IRC tags on the message, got %v", chat.RawTags)
+	}
+	if notice.Channel != "chan1" || notice.ID != "slow_on" {
+		t.Fatalf("unexpected notice: %+v", notice)
+	}
+	// У NOTICE нет room-id: он берётся из ROOMSTATE канала.
+	if chat.RoomID != "1337" || notice.RoomID != "1337" {
+		t.Fatalf("expected room-id 1337, got chat %q and notice %q", chat.RoomID, notice.RoomID)
+	}
+	handler.mu.Lock()
+	rooms := append([]model.Room(nil), handler.rooms...)
+	handler.mu.Unlock()
+	if len(rooms) != 1 || rooms[0].ID != "1337" || rooms[0].Channel != "chan1" {
+		t.Fatalf("expected a single registered room, got %+v", rooms)
+	}
+
+	server.broadcast("PING :tmi.twitch.tv")
+	waitFor(t, "PONG", func() bool {
+		for _, line := range server.lines() {
+			if line == "PONG :tmi.twitch.tv" {
+				return true
+			}
+		}
+		return false
+	})
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.sessions) != 2 || handler.sessions[1].Reason != reasonShutdown {
+		t.Fatalf("expected opened and closed session, got %+v", handler.sessions)
+	}
+}
+
+// membershipRecordingHandler дополнительно реализует MembershipHandler.
+type membershipRecordingHandler struct {
+	recordingHandler
+	members []model.Membership
+}
+
+func (h *membershipRecordingHandler) HandleMembership(_ context.Context, membership model.Membership) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.members = append(h.members, membership)
+}
+
+func TestWebSocketTransportDeliversMembership(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &membershipRecordingHandler{}
+	client := NewClient(wsConfig(server.url(), "token"), handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "first join", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1
+	})
+
+	server.broadcast(":Viewer!viewer@viewer.tmi.twitch.tv JOIN #chan1\r\n" +
+		":bot!bot@bot.tmi.twitch.tv PART #chan1\r\n" +
+		":viewer!viewer@viewer.tmi.twitch.tv PART #chan1")
+
+	waitFor(t, "join and part", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.members) == 2
+	})
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	// Собственный PART бота не считается выходом зрителя.
+	for i, action := range []string{model.MembershipJoin, model.MembershipPart} {
+		got := handler.members[i]
+		if got.Channel != "chan1" || got.RoomID != "1337" || got.Username != "viewer" || got.Action != action || got.SeenAt.IsZero() {
+			t.Fatalf("unexpected membership %d: %+v", i, got)
+		}
+	}
+}
+
+func TestWebSocketTransportReconnectsOnServerRequest(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &recordingHandler{}
+	client := NewClient(wsConfig(server.url(), "token"), handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "first join", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1
+	})
+
+	server.broadcast(":tmi.twitch.tv RECONNECT")
+
+	waitFor(t, "gap after reconnect", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.gaps) == 1
+	})
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.gaps[0].Channel != "chan1" || handler.gaps[0].Reason != reasonServerReconnect {
+		t.Fatalf("unexpected gap: %+v", handler.gaps[0])
+	}
+	if got := client.Stats().Reconnects; got != 1 {
+		t.Fatalf("expected 1 reconnect, got %d", got)
+	}
+}
+
+func TestWebSocketTransportFailsOnBadLogin(t *testing.T) {
+	server := newFakeIRCServer(t)
+	client := NewClient(wsConfig(server.url(), "wrong"), &recordingHandler{}, nil)
+
+	err := client.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Login authentication failed") {
+		t.Fatalf("expected login failure, got %v", err)
+	}
+}
+
+func TestClientSetTokenReconnectsWithNewToken(t *testing.T) {
+	server := newFakeIRCServer(t)
+	handler := &recordingHandler{}
+	client := NewClient(wsConfig(server.url(), "old-token"), handler, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Run(ctx) }()
+
+	waitFor(t, "first join", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.chats) == 1
+	})
+
+	client.SetToken("new-token")
+
+	waitFor(t, "login with new token", func() bool {
+		for _, line := range server.lines() {
+			if line == "PASS oauth:new-token" {
+				return true
+			}
+		}
+		return false
+	})
+	waitFor(t, "gap after token refresh", func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.gaps) == 1
+	})
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.gaps[0].Reason != reasonTokenRefreshed {
+		t.Fatalf("unexpected gap reason: %q", handler.gaps[0].Reason)
+	}
+}
@@ -12,21 +12,69 @@ create table if not exists chat_messages (
   is_subscriber boolean,
   bits         integer,
   sent_at      timestamptz,
+  is_self      boolean not null default false,  -- отправлено самим ботом
+  stream_id    text,                   -- трансляция; null, пока канал оффлайн
+  room_id      text,                   -- id канала, не меняется при переименовании
+  emotes       jsonb,                  -- [{provider, id, name, count}]; null без эмоутов
+  raw_tags     jsonb,                  -- исходные теги IRC; только для каналов с channels.raw_tags
   received_at  timestamptz not null default now()
 );
 
+-- для баз, созданных до появления колонки
+alter table chat_messages add column if not exists is_self boolean not null default false;
+alter table chat_messages add column if not exists stream_id text;  -- null, пока канал оффлайн
+alter table chat_messages add column if not exists room_id text;    -- id канала, не меняется при переименовании
+alter table chat_messages add column if not exists emotes jsonb;     -- [{provider, id, name, count}]
+alter table chat_messages add column if not exists raw_tags jsonb;   -- исходные теги IRC
+
 create index if not exists idx_chat_messages_channel_time
   on chat_messages (channel, sent_at);
 
+create index if not exists idx_chat_messages_room_time
+  on chat_messages (room_id, sent_at) where room_id is not null;
+
+create index if not exists idx_chat_messages_stream
+  on chat_messages (stream_id, sent_at) where stream_id is not null;
+
 -- простая вьюха для чтения последнего
 create or replace view v_last_messages as
 select *
 from chat_messages
 order by sent_at desc nulls last, id desc;
 
+-- пользователи чата, ведутся батчером из потока сообщений
+create table if not exists users (
+  user_id       text primary key,
+  login         text not null,             -- последнее известное имя
+  display_name  text not null default '',
+  color         text not null default '',
+  first_seen    timestamptz not null,
+  last_seen     timestamptz not null,
+  message_count bigint not null default 0
+);
+
+create index if not exists idx_users_login on users (login);
+
+-- каждое новое сочетание имени, отображаемого имени и цвета пользователя
+create table if not exists user_name_history (
+  id           bigserial primary key,
+  user_id      text not null,
+  login        text not null,
+  display_name text not null default '',
+  color        text not null default '',
+  seen_at      timestamptz not null        -- первое сообщение под этим именем
+);
+
+create index if not exists idx_user_name_history_user_time
+  on user_name_history (user_id, seen_at desc, id desc);
+
+create index if not exists idx_user_name_history_login
+  on user_name_history (login);
+
 create table if not exists channel_notices (
   id          bigserial primary key,
   channel     text not null,
+  room_id     text,
   msg_id      text,
   message     text not null,
   tags        jsonb not null default '{}',
@@ -34,5 +82,204 @@ create table if not exists channel_notices (
   received_at timestamptz not null default now()
 );
 
+alter table channel_notices add column if not exists room_id text;
+
+-- реестр каналов по room-id: текущий логин и настройки логирования
+create table if not exists channels (
+  room_id            text primary key,
+  login              text not null,                -- текущий логин
+  enabled            boolean not null default true, -- false — не подключаться к каналу
+  capture_membership boolean not null default false,
+  retention          interval,                     -- null — хранить бессрочно
+  raw_tags           boolean not null default false,
+  first_seen         timestamptz not null default now(),
+  updated_at         timestamptz not null default now()
+);
+
+create index if not exists idx_channels_login on channels (login);
+
+-- логины канала: новая строка при каждом переименовании
+create table if not exists channel_login_history (
+  id      bigserial primary key,
+  room_id text not null,
+  login   text not null,
+  seen_at timestamptz not null
+);
+
+create index if not exists idx_channel_login_history_room
+  on channel_login_history (room_id, seen_at);
+
 create index if not exists idx_channel_notices_channel_time
-  on channel_notices (channel, notice_at desc nulls last, id desc);
\ No newline at end of file
+  on channel_notices (channel, notice_at desc nulls last, id desc);
+
+-- JOIN/PART зрителей для каналов с channels.capture_membership
+create table if not exists channel_membership (
+  id       bigserial primary key,
+  channel  text not null,
+  room_id  text,
+  username text not null,
+  action   text not null,          -- join или part
+  seen_at  timestamptz not null
+);
+
+create index if not exists idx_channel_membership_channel_time
+  on channel_membership (channel, seen_at);
+
+create table if not exists connection_sessions (
+  session_id      text primary key,
+  server          text,
+  connected_at    timestamptz not null,
+  disconnected_at timestamptz,            -- null, пока сессия активна
+  reason          text
+);
+
+create index if not exists idx_connection_sessions_connected_at
+  on connection_sessions (connected_at desc);
+
+-- периоды, когда канал не логировался: "нас не было в чате", а не "в чате молчали"
+create table if not exists chat_gaps (
+  id          bigserial primary key,
+  channel     text not null,
+  session_id  text,                       -- сессия, в которой канал снова подключён
+  gap_start   timestamptz not null,
+  gap_end     timestamptz not null,
+  reason      text,
+  received_at timestamptz not null default now()
+);
+
+create index if not exists idx_chat_gaps_channel_time
+  on chat_gaps (channel, gap_start);
+
+-- трансляции каналов по данным Helix /streams
+create table if not exists streams (
+  stream_id      text primary key,          -- id трансляции в Twitch
+  channel        text not null,
+  broadcaster_id text not null default '',
+  title          text not null default '',  -- последнее известное название
+  game_id        text not null default '',
+  game_name      text not null default '',
+  started_at     timestamptz not null,
+  ended_at       timestamptz,               -- null, пока трансляция идёт
+  peak_viewers   integer not null default 0,
+  updated_at     timestamptz not null default now()
+);
+
+create index if not exists idx_streams_channel_time
+  on streams (channel, started_at desc);
+
+-- периоды между трансляциями канала
+create table if not exists stream_offline_periods (
+  id                 bigserial primary key,
+  channel            text not null,
+  started_at         timestamptz not null,
+  ended_at           timestamptz,           -- null, пока канал оффлайн
+  previous_stream_id text,
+  next_stream_id     text
+);
+
+create index if not exists idx_stream_offline_periods_channel_time
+  on stream_offline_periods (channel, started_at);
+
+-- несколько реплик трекера пишут одни и те же переходы: у канала не больше
+-- одного открытого периода и одного периода после каждой трансляции
+create unique index if not exists uq_stream_offline_periods_open
+  on stream_offline_periods (channel) where ended_at is null;
+create unique index if not exists uq_stream_offline_periods_previous
+  on stream_offline_periods (channel, previous_stream_id);
+
+-- временной ряд состояния каналов: строка пишется при смене названия,
+-- категории, языка, тегов или статуса эфира, а во время эфира ещё и раз в
+-- интервал выборки числа зрителей
+create table if not exists channel_snapshots (
+  id             bigserial primary key,
+  channel        text not null,
+  broadcaster_id text not null,
+  title          text not null default '',
+  game_id        text not null default '',
+  game_name      text not null default '',
+  language       text not null default '',
+  tags           text[] not null default '{}',
+  is_live        boolean not null,
+  stream_id      text,                      -- null, пока канал оффлайн
+  viewer_count   integer,                   -- null, пока канал оффлайн
+  captured_at    timestamptz not null
+);
+
+create index if not exists idx_channel_snapshots_channel_time
+  on channel_snapshots (channel, captured_at desc);
+
+-- каталог значков чата: глобальные (scope = 'global') и канала (scope = room_id)
+create table if not exists catalog_badges (
+  scope        text not null,
+  set_id       text not null,               -- например subscriber
+  version      text not null,               -- например 12
+  title        text not null default '',
+  description  text not null default '',
+  image_url_1x text not null default '',
+  image_url_2x text not null default '',
+  image_url_4x text not null default '',
+  primary key (scope, set_id, version)
+);
+
+-- каталог эмоутов: Twitch и сторонние источники
+create table if not exists catalog_emotes (
+  provider     text not null,               -- twitch, 7tv, bttv или ffz
+  scope        text not null,               -- global или room_id
+  emote_id     text not null,
+  name         text not null,
+  type         text not null default '',
+  image_url_1x text not null default '',
+  image_url_2x text not null default '',
+  image_url_4x text not null default '',
+  primary key (provider, scope, emote_id)
+);
+
+create index if not exists idx_catalog_emotes_name on catalog_emotes (scope, name);
+
+-- хэш содержимого каждого набора: набор перезаписывается, только если изменился
+create table if not exists catalog_sets (
+  kind         text not null,               -- badges или emotes
+  provider     text not null,
+  scope        text not null,
+  hash         text not null,
+  refreshed_at timestamptz not null default now(),
+  primary key (kind, provider, scope)
+);
+
+-- уведомления EventSub: события канала, которых нет в IRC
+create table if not exists eventsub_events (
+  id                  bigserial primary key,
+  message_id          text unique,        -- metadata.message_id, Twitch может доставить повторно
+  subscription_id     text,
+  type                text not null,      -- например channel.follow, stream.online
+  version             text,
+  broadcaster_user_id text,
+  channel             text,               -- broadcaster_user_login
+  user_id             text,
+  user_login          text,
+  event               jsonb not null default '{}',
+  occurred_at         timestamptz,
+  received_at         timestamptz not null default now()
+);
+
+create index if not exists idx_eventsub_events_channel_type_time
+  on eventsub_events (channel, type, occurred_at);
+
+-- OAuth токены, общие для всех реплик (TWITCH_TOKEN_STORE=postgres)
+create table if not exists twitch_tokens (
+  name          text primary key,      -- ключ: kind:client_id[:login] или app/user для старых токенов
+  client_id     text not null default '',
+  kind          text not null default '',  -- app или user
+  login         text not null default '',
+  access_token  text not null,
+  refresh_token text not null default '',
+  scopes        text[] not null default '{}',
+  expires_at    timestamptz not null,
+  updated_at    timestamptz not null default now()
+);
+
+-- для баз, созданных до появления ключей
+alter table twitch_tokens add column if not exists client_id text not null default '';
+alter table twitch_tokens add column if not exists kind text not null default '';
+alter table twitch_tokens add column if not exists login text not null default '';
+update twitch_tokens set kind = name where kind = '';